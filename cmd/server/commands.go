@@ -0,0 +1,353 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"text/tabwriter"
+	"time"
+
+	"github.com/fabfab/airplane-chat/internal/config"
+	"github.com/fabfab/airplane-chat/internal/indexing"
+	"github.com/fabfab/airplane-chat/internal/storage"
+	"github.com/fabfab/airplane-chat/internal/vectorstore"
+)
+
+// subcommands maps the first command-line argument to an offline maintenance
+// task. Without a subcommand the binary runs the HTTP server.
+var subcommands = map[string]func(args []string) error{
+	"eval":          runEval,
+	"eval-answers":  runEvalAnswers,
+	"fsck":          runFsck,
+	"import-sqlite": runImportSQLite,
+	"migrate":       runMigrate,
+	"reindex":       runReindex,
+}
+
+// commandContext returns a context cancelled on Ctrl+C.
+func commandContext() (context.Context, context.CancelFunc) {
+	return signal.NotifyContext(context.Background(), os.Interrupt)
+}
+
+// runMigrate manages the pgvector schema: `migrate up`, `migrate down [-steps
+// N]` and `migrate status`.
+func runMigrate(args []string) error {
+	fs := flag.NewFlagSet("migrate", flag.ExitOnError)
+	steps := fs.Int("steps", 1, "number of migrations to revert with down")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: airplane-chat migrate [-steps N] up|down|status")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return fmt.Errorf("expected exactly one of up, down or status")
+	}
+
+	cfg, err := config.FromEnv()
+	if err != nil {
+		return fmt.Errorf("load configuration: %w", err)
+	}
+
+	ctx, cancel := commandContext()
+	defer cancel()
+
+	pool, err := vectorstore.Connect(ctx, cfg.Database.URL, 1)
+	if err != nil {
+		return err
+	}
+	defer pool.Close()
+
+	migrator, err := vectorstore.NewMigrator(pool, cfg.Embed.Dimension)
+	if err != nil {
+		return err
+	}
+
+	switch fs.Arg(0) {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		for _, m := range applied {
+			fmt.Printf("applied %04d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			return err
+		}
+		if len(applied) == 0 {
+			fmt.Println("schema is up to date")
+		}
+	case "down":
+		if *steps <= 0 {
+			return fmt.Errorf("-steps must be positive")
+		}
+		reverted, err := migrator.Down(ctx, *steps)
+		for _, m := range reverted {
+			fmt.Printf("reverted %04d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			return err
+		}
+		if len(reverted) == 0 {
+			fmt.Println("no migrations to revert")
+		}
+	case "status":
+		current, err := migrator.Current(ctx)
+		if err != nil {
+			return err
+		}
+		states, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("current version: %d (latest known: %d)\n", current, migrator.Latest())
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED")
+		for _, state := range states {
+			applied := "pending"
+			if state.Applied {
+				applied = state.AppliedAt.Local().Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%04d\t%s\t%s\n", state.Version, state.Name, applied)
+		}
+		w.Flush()
+		if current > migrator.Latest() {
+			return &vectorstore.SchemaTooNewError{Current: current, Latest: migrator.Latest()}
+		}
+	default:
+		fs.Usage()
+		return fmt.Errorf("unknown migrate command %q", fs.Arg(0))
+	}
+	return nil
+}
+
+// runImportSQLite copies conversations from the DATA_DIR file layout into the
+// SQLite database used by STORAGE_BACKEND=sqlite.
+func runImportSQLite(args []string) error {
+	fs := flag.NewFlagSet("import-sqlite", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: airplane-chat import-sqlite")
+		fmt.Fprintln(fs.Output(), "Imports DATA_DIR/conversations into SQLITE_PATH. Existing conversations are skipped.")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	cfg, err := config.FromEnv()
+	if err != nil {
+		return fmt.Errorf("load configuration: %w", err)
+	}
+
+	dirLock, err := storage.LockDataDir(cfg.DataDir, "airplane-chat import-sqlite")
+	if err != nil {
+		return err
+	}
+	defer dirLock.Release()
+
+	src, err := storage.NewManager(cfg.DataDir)
+	if err != nil {
+		return err
+	}
+	dst, err := storage.NewSQLiteStore(cfg.Storage.SQLitePath, cfg.DataDir)
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+
+	report, err := storage.ImportFiles(src, dst)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("imported %d conversations (%d messages, %d documents, %d transcripts) into %s; skipped %d already present\n",
+		report.Conversations, report.Messages, report.Documents, report.Transcripts, cfg.Storage.SQLitePath, report.Skipped)
+	return nil
+}
+
+// runReindex re-extracts text from the stored originals and rebuilds chunks
+// for one document, one conversation or the whole DATA_DIR.
+func runReindex(args []string) error {
+	fs := flag.NewFlagSet("reindex", flag.ExitOnError)
+	conversationID := fs.String("conversation", "", "only reindex this conversation")
+	documentID := fs.String("document", "", "only reindex this document (requires -conversation)")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: airplane-chat reindex [-conversation ID [-document ID]]")
+		fmt.Fprintln(fs.Output(), "Rebuilds document chunks from the originals stored under DATA_DIR.")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *documentID != "" && *conversationID == "" {
+		fs.Usage()
+		return fmt.Errorf("-document requires -conversation")
+	}
+
+	cfg, err := config.FromEnv()
+	if err != nil {
+		return fmt.Errorf("load configuration: %w", err)
+	}
+
+	ctx, cancel := commandContext()
+	defer cancel()
+
+	indexer, closeIndexer, err := openIndexer(ctx, cfg, "airplane-chat reindex", true)
+	if err != nil {
+		return err
+	}
+	defer closeIndexer()
+
+	if *documentID != "" {
+		chunks, err := indexer.ReindexDocument(ctx, *conversationID, *documentID)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("reindexed document %s (%d chunks)\n", *documentID, chunks)
+		return nil
+	}
+
+	var report indexing.ReindexReport
+	if *conversationID != "" {
+		report, err = indexer.ReindexConversation(ctx, *conversationID)
+	} else {
+		report, err = indexer.ReindexAll(ctx)
+	}
+	for _, failure := range report.Failures {
+		fmt.Fprintf(os.Stderr, "failed %s/%s: %s\n", failure.ConversationID, failure.DocumentID, failure.Error)
+	}
+	fmt.Printf("reindexed %d documents in %d conversations (%d chunks, %d failed)\n",
+		report.Documents, report.Conversations, report.Chunks, len(report.Failures))
+	if err != nil {
+		return err
+	}
+	if len(report.Failures) > 0 {
+		return fmt.Errorf("%d documents failed", len(report.Failures))
+	}
+	return nil
+}
+
+// runFsck reports documents without chunks, documents whose files are gone and
+// chunks whose document no longer exists. With -repair it reindexes and
+// deletes to fix them.
+func runFsck(args []string) error {
+	fs := flag.NewFlagSet("fsck", flag.ExitOnError)
+	repair := fs.Bool("repair", false, "reindex unindexed documents and delete orphaned chunks")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: airplane-chat fsck [-repair]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	cfg, err := config.FromEnv()
+	if err != nil {
+		return fmt.Errorf("load configuration: %w", err)
+	}
+
+	ctx, cancel := commandContext()
+	defer cancel()
+
+	// A plain check must not change anything, so only a repair locks
+	// DATA_DIR, recovers and migrates the stores and reconciles the index
+	// with the configured model.
+	indexer, closeIndexer, err := openIndexer(ctx, cfg, "airplane-chat fsck", *repair)
+	if err != nil {
+		return err
+	}
+	defer closeIndexer()
+
+	report, err := indexer.Check(ctx)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("checked %d documents in %d conversations against model %s\n", report.Documents, report.Conversations, report.Model)
+	for _, ref := range report.Unindexed {
+		fmt.Printf("unindexed     %s/%s (%s)\n", ref.ConversationID, ref.DocumentID, ref.Name)
+	}
+	for _, ref := range report.MissingFiles {
+		fmt.Printf("missing file  %s/%s (%s)\n", ref.ConversationID, ref.DocumentID, ref.Name)
+	}
+	for _, orphan := range report.Orphans {
+		fmt.Printf("orphan        %s/%s: %d %s chunks, %s\n", orphan.ConversationID, orphan.DocumentID, orphan.Chunks, orphan.Model, orphan.Reason)
+	}
+	if report.Clean() {
+		fmt.Println("no problems found")
+		return nil
+	}
+	if !*repair {
+		return fmt.Errorf("found %d unindexed documents, %d with missing files and %d orphaned chunk sets; rerun with -repair",
+			len(report.Unindexed), len(report.MissingFiles), len(report.Orphans))
+	}
+
+	result, err := indexer.Repair(ctx, report)
+	for _, failure := range result.Failures {
+		fmt.Fprintf(os.Stderr, "failed %s/%s: %s\n", failure.ConversationID, failure.DocumentID, failure.Error)
+	}
+	for _, ref := range result.Unrepairable {
+		fmt.Fprintf(os.Stderr, "cannot reindex %s/%s (%s): its files are missing\n", ref.ConversationID, ref.DocumentID, ref.Name)
+	}
+	fmt.Printf("reindexed %d documents, deleted chunks of %d orphaned documents\n", result.Reindexed, result.Deleted)
+	if err != nil {
+		return err
+	}
+	if unrepaired := len(result.Failures) + len(result.Unrepairable); unrepaired > 0 {
+		return fmt.Errorf("%d documents could not be repaired", unrepaired)
+	}
+	return nil
+}
+
+// openIndexer opens the storage, vector store and indexer that offline
+// commands share. With start it locks DATA_DIR, recovers and migrates the
+// stores and reconciles the index with the configured model as the server
+// does. Otherwise it opens everything read-only and without the lock, so it
+// can run next to the server, and only reads the active model. The returned
+// function waits for any pending model switch and releases everything.
+func openIndexer(ctx context.Context, cfg config.Config, command string, start bool) (*indexing.Indexer, func(), error) {
+	var dirLock *storage.DataDirLock
+	openStore, openVectors := openStorageReadOnly, openVectorStoreReadOnly
+	if start {
+		var err error
+		if dirLock, err = storage.LockDataDir(cfg.DataDir, command); err != nil {
+			return nil, nil, err
+		}
+		openStore, openVectors = openStorage, openVectorStore
+	}
+
+	store, err := openStore(cfg)
+	if err != nil {
+		dirLock.Release()
+		return nil, nil, err
+	}
+
+	vectorStore, err := openVectors(ctx, cfg)
+	if err != nil {
+		store.Close()
+		dirLock.Release()
+		return nil, nil, err
+	}
+
+	newEmbedder := embedderFactory(cfg, ollamaRetryPolicy(cfg), nil)
+	indexer := indexing.New(store, vectorStore, newEmbedder, configuredModel(cfg), configuredChunking(cfg))
+	open := indexer.Open
+	if start {
+		open = indexer.Start
+	}
+	if err := open(ctx); err != nil {
+		vectorStore.Close()
+		store.Close()
+		dirLock.Release()
+		return nil, nil, err
+	}
+
+	return indexer, func() {
+		indexer.Wait()
+		vectorStore.Close()
+		store.Close()
+		dirLock.Release()
+	}, nil
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"text/tabwriter"
+
+	"github.com/fabfab/airplane-chat/internal/config"
+	"github.com/fabfab/airplane-chat/internal/embeddings"
+	"github.com/fabfab/airplane-chat/internal/eval"
+	"github.com/fabfab/airplane-chat/internal/indexing"
+	"github.com/fabfab/airplane-chat/internal/storage"
+	"github.com/fabfab/airplane-chat/internal/vectorstore"
+)
+
+// evalConversation holds the documents of a -docs evaluation.
+const evalConversation = "eval"
+
+// runEval scores retrieval against a JSONL file of questions with known
+// answers, either on the live index or on a throwaway index of a directory.
+func runEval(args []string) error {
+	fs := flag.NewFlagSet("eval", flag.ExitOnError)
+	k := fs.Int("k", 0, "number of hits to score (default RETRIEVAL_TOP_K)")
+	docs := fs.String("docs", "", "index the files in this directory into a throwaway index instead of using the live one")
+	embedder := fs.String("embedder", "ollama", "embedder for -docs: ollama (EMBEDDING_MODEL) or hash (offline, deterministic)")
+	neighbors := fs.Int("neighbors", 0, "widen hits by this many neighbouring chunks")
+	asJSON := fs.Bool("json", false, "print the report as JSON")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: airplane-chat eval [-k N] [-docs DIR [-embedder ollama|hash]] [-neighbors N] [-json] QUESTIONS.jsonl")
+		fmt.Fprintln(fs.Output(), "Reports recall@k, MRR and nDCG@k of document retrieval.")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return fmt.Errorf("expected one questions file")
+	}
+	if *embedder != "ollama" && *embedder != "hash" {
+		return fmt.Errorf("unsupported -embedder %q (expected ollama or hash)", *embedder)
+	}
+	if *embedder == "hash" && *docs == "" {
+		return fmt.Errorf("-embedder hash requires -docs; the live index was built with EMBEDDING_MODEL")
+	}
+	if *neighbors < 0 {
+		return fmt.Errorf("-neighbors must not be negative")
+	}
+
+	questions, err := eval.LoadQuestions(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	cfg, err := config.FromEnv()
+	if err != nil {
+		return fmt.Errorf("load configuration: %w", err)
+	}
+	if *k <= 0 {
+		*k = cfg.Database.SearchTopK
+	}
+
+	ctx, cancel := commandContext()
+	defer cancel()
+
+	var (
+		indexer      *indexing.Indexer
+		closeIndexer func()
+	)
+	if *docs != "" {
+		index, err := openEvalIndex(ctx, cfg, *docs, *embedder)
+		if err != nil {
+			return err
+		}
+		documents, chunks, err := index.load(ctx, evalConversation)
+		if err != nil {
+			index.close()
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "indexed %d documents (%d chunks)\n", len(documents), chunks)
+		indexer, closeIndexer = index.indexer, index.close
+	} else {
+		indexer, closeIndexer, err = openIndexer(ctx, cfg, "airplane-chat eval", true)
+		if err != nil {
+			return err
+		}
+	}
+	defer closeIndexer()
+
+	search := func(ctx context.Context, question eval.Question, k int) ([]eval.Hit, error) {
+		conversationID := question.ConversationID
+		if *docs != "" {
+			conversationID = evalConversation
+		}
+		if conversationID == "" {
+			return nil, errors.New("question has no conversation_id")
+		}
+
+		result, err := indexer.Search(ctx, conversationID, question.Question, k, nil)
+		if err != nil {
+			return nil, err
+		}
+		passages, err := indexer.Passages(ctx, conversationID, result, *neighbors)
+		if err != nil {
+			return nil, err
+		}
+
+		var hits []eval.Hit
+		if passages != nil {
+			for _, passage := range passages {
+				hits = append(hits, eval.Hit{DocumentID: passage.DocumentID, DocumentName: documentName(passage.Metadata), Content: passage.Content})
+			}
+			return hits, nil
+		}
+		for _, chunk := range result.Chunks {
+			hits = append(hits, eval.Hit{DocumentID: chunk.DocumentID, DocumentName: documentName(chunk.Metadata), Content: chunk.Content})
+		}
+		return hits, nil
+	}
+
+	report, err := eval.Run(ctx, questions, *k, search)
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(report)
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "QUESTION\tRECALL@%d\tRR\tNDCG@%d\tMISSING\n", report.K, report.K)
+	for _, result := range report.Results {
+		missing := fmt.Sprint(len(result.Missing))
+		if result.Error != "" {
+			missing = "error: " + result.Error
+		}
+		fmt.Fprintf(tw, "%s\t%.3f\t%.3f\t%.3f\t%s\n", result.ID, result.Recall, result.ReciprocalRank, result.NDCG, missing)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	fmt.Printf("\n%d questions, %d failed: recall@%d %.3f  MRR %.3f  nDCG@%d %.3f\n",
+		report.Questions, report.Failed, report.K, report.Recall, report.MRR, report.K, report.NDCG)
+	if report.Failed > 0 {
+		return fmt.Errorf("%d questions could not be searched", report.Failed)
+	}
+	return nil
+}
+
+// openEvalIndex prepares a throwaway index of dir embedded with the
+// configured model, or with the offline hash embedder when embedder is
+// "hash". Embeddings are cached, so loading the documents into further
+// conversations costs no model calls.
+func openEvalIndex(ctx context.Context, cfg config.Config, dir, embedder string) (*directoryIndex, error) {
+	newEmbedder := embedderFactory(cfg, ollamaRetryPolicy(cfg), nil)
+	model := configuredModel(cfg)
+	if embedder == "hash" {
+		newEmbedder = func(_ string, dimension int) embeddings.Embedder { return embeddings.NewHashEmbedder(dimension) }
+		model.Name = "hash"
+	}
+	cached := func(name string, dimension int) embeddings.Embedder {
+		return &cachingEmbedder{next: newEmbedder(name, dimension), cache: make(map[string][]float32)}
+	}
+	return openDirectoryIndex(ctx, cfg, dir, cached, model)
+}
+
+// directoryIndex is a throwaway data directory whose conversations are
+// loaded with the supported files of a document directory.
+type directoryIndex struct {
+	store   storage.Store
+	vectors vectorstore.VectorStore
+	indexer *indexing.Indexer
+	files   map[string][]byte
+	close   func()
+}
+
+// openDirectoryIndex reads the regular files of dir and prepares an empty
+// temporary index with the configured chunking. Close removes it.
+func openDirectoryIndex(ctx context.Context, cfg config.Config, dir string, newEmbedder indexing.EmbedderFactory, model indexing.Model) (*directoryIndex, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("read documents: %w", err)
+	}
+	files := make(map[string][]byte)
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("read %s: %w", entry.Name(), err)
+		}
+		files[entry.Name()] = data
+	}
+
+	tmp, err := os.MkdirTemp("", "airplane-chat-eval-")
+	if err != nil {
+		return nil, fmt.Errorf("create temporary index: %w", err)
+	}
+	cleanup := func() { os.RemoveAll(tmp) }
+
+	store, err := storage.NewManager(filepath.Join(tmp, "data"))
+	if err != nil {
+		cleanup()
+		return nil, err
+	}
+	vectorStore, err := vectorstore.NewFileStore(filepath.Join(tmp, "vectors"))
+	if err != nil {
+		store.Close()
+		cleanup()
+		return nil, err
+	}
+
+	indexer := indexing.New(store, vectorStore, newEmbedder, model, configuredChunking(cfg))
+	index := &directoryIndex{
+		store:   store,
+		vectors: vectorStore,
+		indexer: indexer,
+		files:   files,
+		close: func() {
+			indexer.Wait()
+			vectorStore.Close()
+			store.Close()
+			cleanup()
+		},
+	}
+	if err := indexer.Start(ctx); err != nil {
+		index.close()
+		return nil, err
+	}
+	return index, nil
+}
+
+// load uploads and indexes every supported file into conversationID and
+// returns the document names by ID. Unsupported files are skipped.
+func (d *directoryIndex) load(ctx context.Context, conversationID string) (map[string]string, int, error) {
+	names := slices.Sorted(maps.Keys(d.files))
+	documents := make(map[string]string)
+	chunks := 0
+	for _, name := range names {
+		document, err := d.store.SaveDocument(conversationID, name, d.files[name], nil)
+		if errors.Is(err, storage.ErrUnsupportedFileType) {
+			continue
+		}
+		if err != nil {
+			return nil, 0, fmt.Errorf("store %s: %w", name, err)
+		}
+		count, err := d.indexer.IndexDocument(ctx, conversationID, document)
+		if err != nil {
+			return nil, 0, fmt.Errorf("index %s: %w", name, err)
+		}
+		documents[document.ID] = name
+		chunks += count
+	}
+	if len(documents) == 0 {
+		return nil, 0, errors.New("no supported documents found")
+	}
+	return documents, chunks, nil
+}
+
+func documentName(metadata vectorstore.Metadata) string {
+	name, _ := metadata["document_name"].(string)
+	return name
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"slices"
+	"sync"
+
+	"github.com/fabfab/airplane-chat/internal/config"
+	"github.com/fabfab/airplane-chat/internal/embeddings"
+	"github.com/fabfab/airplane-chat/internal/eval"
+	"github.com/fabfab/airplane-chat/internal/llm"
+	"github.com/fabfab/airplane-chat/internal/ollama"
+	"github.com/fabfab/airplane-chat/internal/server"
+)
+
+// runEvalAnswers asks every question of a golden set through the chat
+// endpoint and has a judge model grade the answers.
+func runEvalAnswers(args []string) error {
+	fs := flag.NewFlagSet("eval-answers", flag.ExitOnError)
+	docs := fs.String("docs", "", "directory of documents every question is asked against (required)")
+	embedder := fs.String("embedder", "ollama", "embedder: ollama (EMBEDDING_MODEL) or hash (offline, deterministic)")
+	judgeModel := fs.String("judge-model", "", "model grading the answers (default the chat model)")
+	format := fs.String("format", "markdown", "report format: markdown or json")
+	out := fs.String("out", "", "write the report to this file instead of stdout")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: airplane-chat eval-answers -docs DIR [-embedder ollama|hash] [-judge-model M] [-format markdown|json] [-out FILE] GOLDEN.jsonl")
+		fmt.Fprintln(fs.Output(), "Grades answers for correctness and faithfulness to their sources.")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 || *docs == "" {
+		fs.Usage()
+		return fmt.Errorf("expected -docs and one golden set")
+	}
+	if *embedder != "ollama" && *embedder != "hash" {
+		return fmt.Errorf("unsupported -embedder %q (expected ollama or hash)", *embedder)
+	}
+	if *format != "markdown" && *format != "json" {
+		return fmt.Errorf("unsupported -format %q (expected markdown or json)", *format)
+	}
+
+	questions, err := eval.LoadGolden(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	cfg, err := config.FromEnv()
+	if err != nil {
+		return fmt.Errorf("load configuration: %w", err)
+	}
+	if *judgeModel == "" {
+		*judgeModel = cfg.ChatModel()
+	}
+
+	ctx, cancel := commandContext()
+	defer cancel()
+
+	index, err := openEvalIndex(ctx, cfg, *docs, *embedder)
+	if err != nil {
+		return err
+	}
+	defer index.close()
+
+	policy := ollamaRetryPolicy(cfg)
+	srv := server.New(cfg, index.store, chatClient(cfg, cfg.ChatModel(), policy, nil), nil, index.vectors, index.indexer)
+
+	temperature, seed := 0.0, 1
+	judge := &eval.Judge{
+		Client:  chatClient(cfg, *judgeModel, policy, nil),
+		Model:   *judgeModel,
+		Options: llm.Options{Temperature: &temperature, Seed: &seed},
+	}
+
+	asked := 0
+	ask := func(ctx context.Context, question eval.GoldenQuestion) (eval.Transcript, error) {
+		// A fresh conversation per question keeps earlier answers out of
+		// the history.
+		asked++
+		conversationID := fmt.Sprintf("answers-%d", asked)
+		documents, _, err := index.load(ctx, conversationID)
+		if err != nil {
+			return eval.Transcript{}, err
+		}
+		fmt.Fprintf(os.Stderr, "asking %s\n", question.ID)
+		return askServer(ctx, srv, conversationID, question.Question, documents)
+	}
+
+	report, err := eval.RunAnswers(ctx, questions, ask, judge)
+	if err != nil {
+		return err
+	}
+	report.ChatModel = cfg.ChatModel()
+
+	var output []byte
+	if *format == "json" {
+		if output, err = json.MarshalIndent(report, "", "  "); err != nil {
+			return err
+		}
+		output = append(output, '\n')
+	} else {
+		output = []byte(report.Markdown())
+	}
+	if *out != "" {
+		err = os.WriteFile(*out, output, 0o644)
+	} else {
+		_, err = os.Stdout.Write(output)
+	}
+	if err != nil {
+		return fmt.Errorf("write report: %w", err)
+	}
+
+	fmt.Fprintf(os.Stderr, "%d questions, %d failed: correctness %.2f  faithfulness %.2f  source recall %.2f\n",
+		report.Questions, report.Failed, report.Correctness, report.Faithfulness, report.SourceRecall)
+	if report.Failed > 0 {
+		return fmt.Errorf("%d questions could not be answered or graded", report.Failed)
+	}
+	return nil
+}
+
+// askServer posts question to the message endpoint of srv, exactly as the
+// web UI does, and returns the answer with the system prompt that carried the
+// retrieved sources. documents maps the conversation's document IDs to names.
+func askServer(ctx context.Context, srv http.Handler, conversationID, question string, documents map[string]string) (eval.Transcript, error) {
+	body, err := json.Marshal(map[string]any{"content": question, "return_prompt": true})
+	if err != nil {
+		return eval.Transcript{}, err
+	}
+	request := httptest.NewRequestWithContext(ctx, http.MethodPost, "/api/conversations/"+conversationID+"/messages", bytes.NewReader(body))
+	request.Header.Set("Content-Type", "application/json")
+	recorder := httptest.NewRecorder()
+	srv.ServeHTTP(recorder, request)
+
+	var response struct {
+		Error   string `json:"error"`
+		Message struct {
+			Content string `json:"content"`
+		} `json:"message"`
+		Prompt struct {
+			Messages  []ollama.Message `json:"messages"`
+			Documents []string         `json:"documents"`
+		} `json:"prompt"`
+	}
+	if err := json.NewDecoder(recorder.Body).Decode(&response); err != nil {
+		return eval.Transcript{}, fmt.Errorf("decode answer: %w", err)
+	}
+	if recorder.Code != http.StatusOK {
+		return eval.Transcript{}, fmt.Errorf("message endpoint answered %d: %s", recorder.Code, response.Error)
+	}
+
+	transcript := eval.Transcript{Answer: response.Message.Content}
+	if len(response.Prompt.Messages) > 0 && response.Prompt.Messages[0].Role == "system" {
+		transcript.Sources = response.Prompt.Messages[0].Content
+	}
+	for _, id := range response.Prompt.Documents {
+		if name, ok := documents[id]; ok {
+			transcript.Documents = append(transcript.Documents, name)
+		}
+	}
+	slices.Sort(transcript.Documents)
+	return transcript, nil
+}
+
+// cachingEmbedder remembers embeddings by text, so the same documents can be
+// indexed into many conversations for the price of one.
+type cachingEmbedder struct {
+	next embeddings.Embedder
+
+	mu    sync.Mutex
+	cache map[string][]float32
+}
+
+func (e *cachingEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	var missing []string
+	queued := make(map[string]bool)
+	for _, text := range texts {
+		if _, ok := e.cache[text]; !ok && !queued[text] {
+			queued[text] = true
+			missing = append(missing, text)
+		}
+	}
+	if len(missing) > 0 {
+		vectors, err := e.next.Embed(ctx, missing)
+		if err != nil {
+			return nil, err
+		}
+		if len(vectors) != len(missing) {
+			return nil, fmt.Errorf("embedder returned %d vectors for %d texts", len(vectors), len(missing))
+		}
+		for i, text := range missing {
+			e.cache[text] = vectors[i]
+		}
+	}
+
+	vectors := make([][]float32, len(texts))
+	for i, text := range texts {
+		vectors[i] = e.cache[text]
+	}
+	return vectors, nil
+}
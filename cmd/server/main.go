@@ -14,7 +14,10 @@ import (
 
 	"github.com/fabfab/airplane-chat/internal/config"
 	"github.com/fabfab/airplane-chat/internal/embeddings"
+	"github.com/fabfab/airplane-chat/internal/indexing"
 	"github.com/fabfab/airplane-chat/internal/ollama"
+	"github.com/fabfab/airplane-chat/internal/openai"
+	"github.com/fabfab/airplane-chat/internal/resilience"
 	"github.com/fabfab/airplane-chat/internal/server"
 	"github.com/fabfab/airplane-chat/internal/storage"
 	"github.com/fabfab/airplane-chat/internal/vectorstore"
@@ -23,6 +26,15 @@ import (
 func main() {
 	log.SetFlags(log.LstdFlags | log.Lshortfile)
 
+	if len(os.Args) > 1 {
+		if cmd, ok := subcommands[os.Args[1]]; ok {
+			if err := cmd(os.Args[2:]); err != nil {
+				log.Fatalf("%s: %v", os.Args[1], err)
+			}
+			return
+		}
+	}
+
 	var showVersion bool
 	flag.BoolVar(&showVersion, "version", false, "print version information and exit")
 	flag.Parse()
@@ -37,31 +49,55 @@ func main() {
 		log.Fatalf("failed to load configuration: %v", err)
 	}
 
-	store, err := storage.NewManager(cfg.DataDir)
+	dirLock, err := storage.LockDataDir(cfg.DataDir, "airplane-chat server")
+	if err != nil {
+		log.Fatalf("failed to lock data directory: %v", err)
+	}
+	defer dirLock.Release()
+
+	store, err := openStorage(cfg)
 	if err != nil {
 		log.Fatalf("failed to set up storage: %v", err)
 	}
+	defer store.Close()
 
-	embedder := embeddings.NewOllamaEmbedder(cfg.Ollama.Host, cfg.Embed.Model, cfg.Embed.Dimension, 90*time.Second)
+	// Chat and embedding calls share one breaker: both fail together when
+	// the Ollama daemon is down.
+	retryPolicy := ollamaRetryPolicy(cfg)
+	ollamaBreaker := resilience.NewBreaker(cfg.Ollama.BreakerThreshold, cfg.Ollama.BreakerCooldown)
+
+	newEmbedder := embedderFactory(cfg, retryPolicy, ollamaBreaker)
+	embedder := newEmbedder(cfg.Embed.Model, cfg.Embed.Dimension)
 
 	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
 	defer cancel()
 
-	vectorStore, err := vectorstore.NewPostgresStore(ctx, cfg.Database.URL, cfg.Database.MaxConnections, cfg.Embed.Dimension)
+	vectorStore, err := openVectorStore(ctx, cfg)
 	if err != nil {
 		log.Fatalf("failed to connect vector store: %v", err)
 	}
 	defer vectorStore.Close()
 
-	llmClient := ollama.NewClient(cfg.Ollama.Host, cfg.Ollama.Model)
-	srv := server.New(cfg, store, llmClient, embedder, vectorStore)
+	// The re-embed job outlives the startup timeout and stops on shutdown.
+	jobCtx, stopJobs := context.WithCancel(context.Background())
+	indexer := indexing.New(store, vectorStore, newEmbedder, configuredModel(cfg), configuredChunking(cfg))
+	if err := indexer.Start(jobCtx); err != nil {
+		log.Fatalf("failed to prepare embedding index: %v", err)
+	}
+	defer func() {
+		stopJobs()
+		indexer.Wait()
+	}()
+
+	llmClient := chatClient(cfg, cfg.ChatModel(), retryPolicy, ollamaBreaker)
+	srv := server.New(cfg, store, llmClient, embedder, vectorStore, indexer)
 
 	httpServer := &http.Server{
 		Addr:    cfg.Address,
 		Handler: srv,
 	}
 
-	log.Printf("starting server on %s (data dir: %s, model: %s)", cfg.Address, cfg.DataDir, cfg.Ollama.Model)
+	log.Printf("starting server on %s (data dir: %s, provider: %s, model: %s, vectors: %s)", cfg.Address, cfg.DataDir, cfg.LLM.Provider, cfg.ChatModel(), cfg.Vector.Backend)
 
 	go func() {
 		if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
@@ -72,6 +108,96 @@ func main() {
 	waitForShutdown(httpServer)
 }
 
+func openStorage(cfg config.Config) (storage.Store, error) {
+	if cfg.Storage.Backend == config.StorageBackendSQLite {
+		return storage.NewSQLiteStore(cfg.Storage.SQLitePath, cfg.DataDir)
+	}
+
+	manager, err := storage.NewManager(cfg.DataDir)
+	if err != nil {
+		return nil, err
+	}
+	actions, err := manager.Recover()
+	for _, action := range actions {
+		log.Printf("storage recovery: %s", action)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("recover data directory: %w", err)
+	}
+	return manager, nil
+}
+
+// openStorageReadOnly opens the conversation store for inspection: no
+// recovery runs and SQLite is opened read-only.
+func openStorageReadOnly(cfg config.Config) (storage.Store, error) {
+	if cfg.Storage.Backend == config.StorageBackendSQLite {
+		return storage.NewReadOnlySQLiteStore(cfg.Storage.SQLitePath, cfg.DataDir)
+	}
+	return storage.NewManager(cfg.DataDir)
+}
+
+func openVectorStore(ctx context.Context, cfg config.Config) (vectorstore.VectorStore, error) {
+	if cfg.Vector.Backend == config.VectorBackendFile {
+		return vectorstore.NewFileStore(cfg.Vector.Dir)
+	}
+	return vectorstore.NewPostgresStore(ctx, cfg.Database.URL, cfg.Database.MaxConnections, cfg.Embed.Dimension, indexOptions(cfg))
+}
+
+// openVectorStoreReadOnly opens the vector store for inspection, without
+// migrating the schema or rebuilding indexes.
+func openVectorStoreReadOnly(ctx context.Context, cfg config.Config) (vectorstore.VectorStore, error) {
+	if cfg.Vector.Backend == config.VectorBackendFile {
+		return vectorstore.NewFileStore(cfg.Vector.Dir)
+	}
+	return vectorstore.NewReadOnlyPostgresStore(ctx, cfg.Database.URL, cfg.Database.MaxConnections, cfg.Embed.Dimension, indexOptions(cfg))
+}
+
+func indexOptions(cfg config.Config) vectorstore.IndexOptions {
+	return vectorstore.IndexOptions{
+		Type:           cfg.Database.Index.Type,
+		M:              cfg.Database.Index.M,
+		EFConstruction: cfg.Database.Index.EFConstruction,
+		EFSearch:       cfg.Database.Index.EFSearch,
+		Probes:         cfg.Database.Index.Probes,
+	}
+}
+
+func ollamaRetryPolicy(cfg config.Config) resilience.Policy {
+	policy := resilience.DefaultPolicy
+	policy.MaxAttempts = cfg.Ollama.MaxRetries + 1
+	return policy
+}
+
+func embedderFactory(cfg config.Config, policy resilience.Policy, breaker *resilience.Breaker) indexing.EmbedderFactory {
+	return func(model string, dimension int) embeddings.Embedder {
+		return embeddings.NewOllamaEmbedder(embeddings.OllamaOptions{
+			Host:      cfg.Ollama.Host,
+			Model:     model,
+			Dimension: dimension,
+			Timeout:   90 * time.Second,
+			Retry:     policy,
+			Breaker:   breaker,
+			AutoPull:  cfg.Embed.AutoPull,
+		})
+	}
+}
+
+// chatClient returns a client of the configured LLM provider for model.
+func chatClient(cfg config.Config, model string, policy resilience.Policy, breaker *resilience.Breaker) ollama.Client {
+	if cfg.LLM.Provider == config.ProviderOpenAI {
+		return openai.NewClient(cfg.OpenAI.BaseURL, cfg.OpenAI.APIKey, model)
+	}
+	return ollama.NewClient(cfg.Ollama.Host, model, policy, breaker)
+}
+
+func configuredModel(cfg config.Config) indexing.Model {
+	return indexing.Model{Name: cfg.Embed.Model, Dimension: cfg.Embed.Dimension}
+}
+
+func configuredChunking(cfg config.Config) indexing.ChunkOptions {
+	return indexing.ChunkOptions{SectionSize: cfg.Chunks.SectionSize, ChildSize: cfg.Chunks.ChildSize}
+}
+
 func waitForShutdown(srv *http.Server) {
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
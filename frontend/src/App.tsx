@@ -165,6 +165,9 @@ const App: React.FC = () => {
       if (data.document) {
         setDocuments(prev => [data.document as Document, ...prev]);
       }
+      if (data.indexing?.status === 'failed') {
+        console.warn(`Document stored but not indexed (${data.indexing.code}): ${data.indexing.error}`);
+      }
     } catch (error) {
       console.error(error);
     } finally {
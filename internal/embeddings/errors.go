@@ -0,0 +1,68 @@
+package embeddings
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Sentinel errors classifying embedding failures. Use errors.Is to test for
+// them; the concrete error is usually an *APIError carrying Ollama's message.
+var (
+	ErrModelNotFound     = errors.New("embedding model not found")
+	ErrInputTooLong      = errors.New("embedding input exceeds the model context length")
+	ErrDimensionMismatch = errors.New("embedding dimension mismatch")
+	ErrEmptyEmbedding    = errors.New("embedding response was empty")
+)
+
+// APIError is returned when the embedding API answers with an error status.
+type APIError struct {
+	StatusCode int
+	Model      string
+	Message    string
+	kind       error
+}
+
+func (e *APIError) Error() string {
+	switch {
+	case errors.Is(e.kind, ErrModelNotFound):
+		return fmt.Sprintf("embedding model %q is not available in Ollama (run `ollama pull %s` or set EMBEDDING_AUTO_PULL=true): %s", e.Model, e.Model, e.Message)
+	case e.Message != "":
+		return fmt.Sprintf("ollama embeddings API error (%d): %s", e.StatusCode, e.Message)
+	default:
+		return fmt.Sprintf("ollama embeddings API returned status %d", e.StatusCode)
+	}
+}
+
+// Unwrap exposes the classification so errors.Is works with the sentinels.
+func (e *APIError) Unwrap() error { return e.kind }
+
+// Ollama reports a missing model as `model "name" not found, try pulling it
+// first` and an oversized input as "input length exceeds the context length"
+// or, from older runners, "input length exceeds maximum context length". A
+// bare 404 is not enough to blame the model: a wrong base URL answers 404 too.
+var (
+	modelNotFoundPattern = regexp.MustCompile(`model ["']?[^"'\s]*["']? not found`)
+	inputTooLongMessages = []string{
+		"input length exceeds the context length",
+		"input length exceeds maximum context length",
+		"input is too large to process",
+	}
+)
+
+func newAPIError(status int, model, message string) *APIError {
+	message = strings.TrimSpace(message)
+	lower := strings.ToLower(message)
+
+	var kind error
+	switch {
+	case modelNotFoundPattern.MatchString(lower):
+		kind = ErrModelNotFound
+	case slices.ContainsFunc(inputTooLongMessages, func(known string) bool { return strings.Contains(lower, known) }):
+		kind = ErrInputTooLong
+	}
+
+	return &APIError{StatusCode: status, Model: model, Message: message, kind: kind}
+}
@@ -0,0 +1,69 @@
+package embeddings
+
+import (
+	"context"
+	"hash/fnv"
+	"math"
+	"strings"
+	"unicode"
+)
+
+// HashEmbedder is a deterministic, offline Embedder that hashes the words of
+// a text into a fixed number of buckets. Texts sharing words end up close to
+// each other, which is enough to exercise retrieval without a model server.
+type HashEmbedder struct {
+	dimension int
+}
+
+// NewHashEmbedder returns a HashEmbedder producing vectors of dimension.
+func NewHashEmbedder(dimension int) *HashEmbedder {
+	return &HashEmbedder{dimension: dimension}
+}
+
+// Embed returns one unit-length vector per text. Texts without words map to
+// the zero vector.
+func (e *HashEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	if e.dimension <= 0 {
+		return nil, ErrDimensionMismatch
+	}
+	vectors := make([][]float32, len(texts))
+	for i, text := range texts {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		vectors[i] = e.embed(text)
+	}
+	return vectors, nil
+}
+
+func (e *HashEmbedder) embed(text string) []float32 {
+	vector := make([]float32, e.dimension)
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	for _, word := range words {
+		h := fnv.New64a()
+		h.Write([]byte(word))
+		sum := h.Sum64()
+		// The top bit picks the sign so unrelated words cancel out
+		// instead of piling up in shared buckets.
+		sign := float32(1)
+		if sum>>63 == 1 {
+			sign = -1
+		}
+		vector[sum%uint64(e.dimension)] += sign
+	}
+
+	var norm float64
+	for _, v := range vector {
+		norm += float64(v) * float64(v)
+	}
+	if norm == 0 {
+		return vector
+	}
+	scale := float32(1 / math.Sqrt(norm))
+	for i := range vector {
+		vector[i] *= scale
+	}
+	return vector
+}
@@ -4,10 +4,15 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"strings"
+	"sync"
 	"time"
+
+	"github.com/fabfab/airplane-chat/internal/resilience"
 )
 
 // Embedder generates vector representations for text.
@@ -19,7 +24,11 @@ type ollamaEmbedder struct {
 	host      string
 	model     string
 	dimension int
-	client    *http.Client
+	autoPull  bool
+	client    *resilience.Client
+
+	pullClient *http.Client
+	pullMu     sync.Mutex
 }
 
 type ollamaRequest struct {
@@ -29,59 +38,145 @@ type ollamaRequest struct {
 
 type ollamaResponse struct {
 	Embedding []float64 `json:"embedding"`
+	Error     string    `json:"error"`
+}
+
+// OllamaOptions configures NewOllamaEmbedder.
+type OllamaOptions struct {
+	Host      string
+	Model     string
+	Dimension int
+	Timeout   time.Duration
+	// Retry and Breaker control transient-failure handling; Breaker may be
+	// shared with the chat client and may be nil.
+	Retry   resilience.Policy
+	Breaker *resilience.Breaker
+	// AutoPull asks Ollama to download the model the first time it is
+	// reported missing instead of failing.
+	AutoPull bool
 }
 
 // NewOllamaEmbedder constructs an embedder backed by Ollama's embedding API.
-func NewOllamaEmbedder(host, model string, dimension int, timeout time.Duration) Embedder {
+func NewOllamaEmbedder(opts OllamaOptions) Embedder {
 	return &ollamaEmbedder{
-		host:      strings.TrimRight(host, "/"),
-		model:     model,
-		dimension: dimension,
-		client: &http.Client{
-			Timeout: timeout,
-		},
+		host:      strings.TrimRight(opts.Host, "/"),
+		model:     opts.Model,
+		dimension: opts.Dimension,
+		autoPull:  opts.AutoPull,
+		client: resilience.NewClient("ollama", &http.Client{
+			Timeout: opts.Timeout,
+		}, opts.Retry, opts.Breaker),
+		// Pulling a model can take minutes; the caller's context bounds it.
+		pullClient: &http.Client{},
 	}
 }
 
 func (e *ollamaEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
 	results := make([][]float32, 0, len(texts))
-	url := fmt.Sprintf("%s/api/embeddings", e.host)
 
 	for _, text := range texts {
-		reqBody, err := json.Marshal(ollamaRequest{Model: e.model, Prompt: text})
-		if err != nil {
-			return nil, fmt.Errorf("marshal ollama request: %w", err)
+		vec, err := e.embedOne(ctx, text)
+		if errors.Is(err, ErrModelNotFound) && e.autoPull {
+			if pullErr := e.pull(ctx); pullErr != nil {
+				return nil, fmt.Errorf("%w (auto-pull failed: %v)", err, pullErr)
+			}
+			vec, err = e.embedOne(ctx, text)
 		}
-
-		req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(reqBody))
 		if err != nil {
-			return nil, fmt.Errorf("create ollama request: %w", err)
+			return nil, err
 		}
-		req.Header.Set("Content-Type", "application/json")
+		results = append(results, vec)
+	}
 
-		resp, err := e.client.Do(req)
-		if err != nil {
-			return nil, fmt.Errorf("call ollama embeddings API: %w", err)
-		}
+	return results, nil
+}
 
-		var payload ollamaResponse
-		if err := json.NewDecoder(resp.Body).Decode(&payload); err != nil {
-			resp.Body.Close()
-			return nil, fmt.Errorf("decode ollama response: %w", err)
-		}
-		resp.Body.Close()
+func (e *ollamaEmbedder) embedOne(ctx context.Context, text string) ([]float32, error) {
+	reqBody, err := json.Marshal(ollamaRequest{Model: e.model, Prompt: text})
+	if err != nil {
+		return nil, fmt.Errorf("marshal ollama request: %w", err)
+	}
 
-		vec := make([]float32, len(payload.Embedding))
-		for i, value := range payload.Embedding {
-			vec[i] = float32(value)
-		}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.host+"/api/embeddings", bytes.NewReader(reqBody))
+	if err != nil {
+		return nil, fmt.Errorf("create ollama request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("call ollama embeddings API: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read ollama response: %w", err)
+	}
+
+	var payload ollamaResponse
+	decodeErr := json.Unmarshal(data, &payload)
 
-		if e.dimension > 0 && len(vec) != e.dimension {
-			return nil, fmt.Errorf("ollama embedding dimension mismatch: expected %d, got %d", e.dimension, len(vec))
+	if resp.StatusCode >= 400 || payload.Error != "" {
+		message := payload.Error
+		if message == "" {
+			message = string(data)
 		}
+		return nil, newAPIError(resp.StatusCode, e.model, message)
+	}
+	if decodeErr != nil {
+		return nil, fmt.Errorf("decode ollama response: %w", decodeErr)
+	}
+	if len(payload.Embedding) == 0 {
+		return nil, fmt.Errorf("%w for model %q", ErrEmptyEmbedding, e.model)
+	}
 
-		results = append(results, vec)
+	vec := make([]float32, len(payload.Embedding))
+	for i, value := range payload.Embedding {
+		vec[i] = float32(value)
 	}
 
-	return results, nil
+	if e.dimension > 0 && len(vec) != e.dimension {
+		return nil, fmt.Errorf("%w: model %q returned %d dimensions, expected %d (check EMBEDDING_DIMENSION)", ErrDimensionMismatch, e.model, len(vec), e.dimension)
+	}
+
+	return vec, nil
+}
+
+// pull asks Ollama to download the embedding model and waits for completion.
+func (e *ollamaEmbedder) pull(ctx context.Context) error {
+	e.pullMu.Lock()
+	defer e.pullMu.Unlock()
+
+	body, err := json.Marshal(map[string]any{"model": e.model, "stream": false})
+	if err != nil {
+		return fmt.Errorf("marshal pull request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.host+"/api/pull", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("create pull request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := e.pullClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("call ollama pull API: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var status struct {
+		Status string `json:"status"`
+		Error  string `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil && resp.StatusCode < 400 {
+		return fmt.Errorf("decode pull response: %w", err)
+	}
+	if status.Error != "" {
+		return errors.New(status.Error)
+	}
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("ollama pull API returned status %s", resp.Status)
+	}
+	return nil
 }
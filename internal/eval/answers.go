@@ -0,0 +1,286 @@
+package eval
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/fabfab/airplane-chat/internal/llm"
+	"github.com/fabfab/airplane-chat/internal/ollama"
+)
+
+// GoldenQuestion is one line of an answer evaluation set: a question, the
+// facts a correct answer states and the documents it should draw on.
+type GoldenQuestion struct {
+	ID        string   `json:"id"`
+	Question  string   `json:"question"`
+	Facts     []string `json:"facts"`
+	Documents []string `json:"documents,omitempty"`
+}
+
+// LoadGolden reads a JSONL file of golden questions. Blank lines are skipped
+// and questions without an ID are named after their line.
+func LoadGolden(path string) ([]GoldenQuestion, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open golden set: %w", err)
+	}
+	defer file.Close()
+
+	var questions []GoldenQuestion
+	seen := map[string]bool{}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		var question GoldenQuestion
+		if err := json.Unmarshal([]byte(text), &question); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		question.Question = strings.TrimSpace(question.Question)
+		if question.Question == "" {
+			return nil, fmt.Errorf("%s:%d: question must not be empty", path, line)
+		}
+		if len(question.Facts) == 0 {
+			return nil, fmt.Errorf("%s:%d: facts must list at least one expected fact", path, line)
+		}
+		if question.ID == "" {
+			question.ID = fmt.Sprintf("line-%d", line)
+		}
+		if seen[question.ID] {
+			return nil, fmt.Errorf("%s:%d: duplicate id %q", path, line, question.ID)
+		}
+		seen[question.ID] = true
+		questions = append(questions, question)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read golden set: %w", err)
+	}
+	if len(questions) == 0 {
+		return nil, errors.New("no questions found")
+	}
+	return questions, nil
+}
+
+// Transcript is what the chat pipeline produced for a question: the answer,
+// the source text the model was given and the names of the documents that
+// text came from.
+type Transcript struct {
+	Answer    string
+	Sources   string
+	Documents []string
+}
+
+// AskFunc runs a question through the chat pipeline.
+type AskFunc func(ctx context.Context, question GoldenQuestion) (Transcript, error)
+
+// AnswerResult holds the grade of one answer. Correctness is the share of
+// expected facts the answer states, Faithfulness the judge's 1-5 rating of how
+// well the answer sticks to its sources scaled to 0-1, and SourceRecall the
+// share of expected documents that reached the prompt.
+type AnswerResult struct {
+	ID                string   `json:"id"`
+	Question          string   `json:"question"`
+	Answer            string   `json:"answer,omitempty"`
+	Correctness       float64  `json:"correctness"`
+	Faithfulness      float64  `json:"faithfulness"`
+	SourceRecall      float64  `json:"source_recall"`
+	MissingFacts      []string `json:"missing_facts,omitempty"`
+	MissingDocuments  []string `json:"missing_documents,omitempty"`
+	UnsupportedClaims []string `json:"unsupported_claims,omitempty"`
+	Explanation       string   `json:"explanation,omitempty"`
+	Error             string   `json:"error,omitempty"`
+}
+
+// AnswerReport averages the grades over the questions that were answered and
+// judged. It carries no timestamps so reports of two runs diff cleanly.
+type AnswerReport struct {
+	ChatModel    string         `json:"chat_model"`
+	JudgeModel   string         `json:"judge_model"`
+	Questions    int            `json:"questions"`
+	Failed       int            `json:"failed"`
+	Correctness  float64        `json:"correctness"`
+	Faithfulness float64        `json:"faithfulness"`
+	SourceRecall float64        `json:"source_recall"`
+	Results      []AnswerResult `json:"results"`
+}
+
+// RunAnswers asks every question and has judge grade the answer. Failures
+// are recorded in the question's result; only cancellation of ctx stops the
+// run early.
+func RunAnswers(ctx context.Context, questions []GoldenQuestion, ask AskFunc, judge *Judge) (AnswerReport, error) {
+	report := AnswerReport{JudgeModel: judge.Model, Questions: len(questions)}
+	for _, question := range questions {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+		result := AnswerResult{ID: question.ID, Question: question.Question}
+
+		transcript, err := ask(ctx, question)
+		if err == nil {
+			result.Answer = transcript.Answer
+			result.SourceRecall, result.MissingDocuments = sourceRecall(question.Documents, transcript.Documents)
+			var grade Grade
+			if grade, err = judge.Grade(ctx, question, transcript); err == nil {
+				result.Correctness = grade.correctness()
+				result.Faithfulness = float64(grade.Faithfulness-1) / 4
+				result.MissingFacts = grade.missingFacts()
+				result.UnsupportedClaims = grade.UnsupportedClaims
+				result.Explanation = grade.Explanation
+			}
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return report, ctx.Err()
+			}
+			result.Error = err.Error()
+			report.Failed++
+			report.Results = append(report.Results, result)
+			continue
+		}
+
+		report.Results = append(report.Results, result)
+		report.Correctness += result.Correctness
+		report.Faithfulness += result.Faithfulness
+		report.SourceRecall += result.SourceRecall
+	}
+
+	if graded := report.Questions - report.Failed; graded > 0 {
+		report.Correctness /= float64(graded)
+		report.Faithfulness /= float64(graded)
+		report.SourceRecall /= float64(graded)
+	}
+	return report, nil
+}
+
+// sourceRecall returns the share of expected documents among used, and the
+// ones that are missing. No expectation counts as full recall.
+func sourceRecall(expected, used []string) (float64, []string) {
+	if len(expected) == 0 {
+		return 1, nil
+	}
+	var missing []string
+	for _, name := range expected {
+		found := false
+		for _, candidate := range used {
+			if strings.EqualFold(name, candidate) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			missing = append(missing, name)
+		}
+	}
+	return float64(len(expected)-len(missing)) / float64(len(expected)), missing
+}
+
+// Judge grades answers with a chat model.
+type Judge struct {
+	Client  ollama.Client
+	Model   string
+	Options llm.Options
+}
+
+// Grade is the judge's verdict on one answer.
+type Grade struct {
+	Facts []struct {
+		Fact   string `json:"fact"`
+		Stated bool   `json:"stated"`
+	} `json:"facts"`
+	Faithfulness      int      `json:"faithfulness"`
+	UnsupportedClaims []string `json:"unsupported_claims"`
+	Explanation       string   `json:"explanation"`
+}
+
+func (g Grade) correctness() float64 {
+	if len(g.Facts) == 0 {
+		return 0
+	}
+	stated := 0
+	for _, fact := range g.Facts {
+		if fact.Stated {
+			stated++
+		}
+	}
+	return float64(stated) / float64(len(g.Facts))
+}
+
+func (g Grade) missingFacts() []string {
+	var missing []string
+	for _, fact := range g.Facts {
+		if !fact.Stated {
+			missing = append(missing, fact.Fact)
+		}
+	}
+	return missing
+}
+
+const judgeInstructions = `You grade answers of a retrieval-augmented assistant. You receive the question, the expected facts, the sources the assistant was given and its answer.
+
+For every expected fact decide whether the answer states it; paraphrases count, contradictions do not.
+Rate faithfulness from 1 to 5: 5 when every claim of the answer is backed by the sources, 1 when the answer is mostly unsupported or contradicts them. Saying the sources do not contain the answer is faithful.
+List claims of the answer that the sources do not back.
+
+Reply with JSON only, in this shape:
+{"facts": [{"fact": "<expected fact>", "stated": true}], "faithfulness": 5, "unsupported_claims": [], "explanation": "<one or two sentences>"}`
+
+// Grade asks the judge model to grade transcript against question.
+func (j *Judge) Grade(ctx context.Context, question GoldenQuestion, transcript Transcript) (Grade, error) {
+	var prompt strings.Builder
+	fmt.Fprintf(&prompt, "Question:\n%s\n\nExpected facts:\n", question.Question)
+	for _, fact := range question.Facts {
+		fmt.Fprintf(&prompt, "- %s\n", fact)
+	}
+	sources := strings.TrimSpace(transcript.Sources)
+	if sources == "" {
+		sources = "(none)"
+	}
+	fmt.Fprintf(&prompt, "\nSources:\n%s\n\nAnswer:\n%s", sources, transcript.Answer)
+
+	reply, err := j.Client.Generate(ctx, []ollama.Message{
+		{Role: "system", Content: judgeInstructions},
+		{Role: "user", Content: prompt.String()},
+	}, j.Options)
+	if err != nil {
+		return Grade{}, fmt.Errorf("judge: %w", err)
+	}
+
+	grade, err := parseGrade(reply)
+	if err != nil {
+		return Grade{}, err
+	}
+	if len(grade.Facts) != len(question.Facts) {
+		return Grade{}, fmt.Errorf("judge graded %d facts, expected %d", len(grade.Facts), len(question.Facts))
+	}
+	// Report the facts as written in the golden set, not as echoed back.
+	for i := range grade.Facts {
+		grade.Facts[i].Fact = question.Facts[i]
+	}
+	return grade, nil
+}
+
+// parseGrade extracts the JSON object of a judge reply, tolerating prose or
+// code fences around it.
+func parseGrade(reply string) (Grade, error) {
+	start := strings.Index(reply, "{")
+	end := strings.LastIndex(reply, "}")
+	if start < 0 || end < start {
+		return Grade{}, fmt.Errorf("judge reply has no JSON object: %q", reply)
+	}
+	var grade Grade
+	if err := json.Unmarshal([]byte(reply[start:end+1]), &grade); err != nil {
+		return Grade{}, fmt.Errorf("decode judge reply: %w", err)
+	}
+	if grade.Faithfulness < 1 || grade.Faithfulness > 5 {
+		return Grade{}, fmt.Errorf("judge rated faithfulness %d, expected 1-5", grade.Faithfulness)
+	}
+	return grade, nil
+}
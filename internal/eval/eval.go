@@ -0,0 +1,153 @@
+// Package eval measures retrieval quality against a set of questions whose
+// answers are known to live in particular documents or passages, and answer
+// quality with a judge model, so chunker, retrieval and prompt changes can be
+// compared by numbers instead of impressions.
+package eval
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Reference names a place where the answer to a question can be found: a
+// document, by ID or file name, and optionally a passage of it that a
+// retrieved hit must contain.
+type Reference struct {
+	Document string `json:"document"`
+	Passage  string `json:"passage,omitempty"`
+}
+
+// Question is one line of an evaluation set. ConversationID is only needed
+// when evaluating against the live index.
+type Question struct {
+	ID             string      `json:"id"`
+	ConversationID string      `json:"conversation_id,omitempty"`
+	Question       string      `json:"question"`
+	Expected       []Reference `json:"expected"`
+}
+
+// LoadQuestions reads a JSONL file of questions. Blank lines are skipped and
+// questions without an ID are named after their line.
+func LoadQuestions(path string) ([]Question, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open questions: %w", err)
+	}
+	defer file.Close()
+
+	var questions []Question
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		var question Question
+		if err := json.Unmarshal([]byte(text), &question); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		question.Question = strings.TrimSpace(question.Question)
+		if question.Question == "" {
+			return nil, fmt.Errorf("%s:%d: question must not be empty", path, line)
+		}
+		if len(question.Expected) == 0 {
+			return nil, fmt.Errorf("%s:%d: expected must list at least one reference", path, line)
+		}
+		for _, ref := range question.Expected {
+			if strings.TrimSpace(ref.Document) == "" && strings.TrimSpace(ref.Passage) == "" {
+				return nil, fmt.Errorf("%s:%d: a reference needs a document or a passage", path, line)
+			}
+		}
+		if question.ID == "" {
+			question.ID = fmt.Sprintf("line-%d", line)
+		}
+		questions = append(questions, question)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read questions: %w", err)
+	}
+	if len(questions) == 0 {
+		return nil, errors.New("no questions found")
+	}
+	return questions, nil
+}
+
+// Hit is one retrieved chunk or passage, in rank order.
+type Hit struct {
+	DocumentID   string `json:"document_id"`
+	DocumentName string `json:"document_name,omitempty"`
+	Content      string `json:"-"`
+}
+
+// SearchFunc retrieves the top k hits for a question.
+type SearchFunc func(ctx context.Context, question Question, k int) ([]Hit, error)
+
+// Result holds the scores of one question. Ranks lists the 1-based ranks of
+// the hits that matched a reference.
+type Result struct {
+	ID             string      `json:"id"`
+	Question       string      `json:"question"`
+	Recall         float64     `json:"recall"`
+	ReciprocalRank float64     `json:"reciprocal_rank"`
+	NDCG           float64     `json:"ndcg"`
+	Ranks          []int       `json:"ranks,omitempty"`
+	Missing        []Reference `json:"missing,omitempty"`
+	Error          string      `json:"error,omitempty"`
+}
+
+// Report averages the scores over the questions that could be searched.
+type Report struct {
+	K         int      `json:"k"`
+	Questions int      `json:"questions"`
+	Failed    int      `json:"failed"`
+	Recall    float64  `json:"recall"`
+	MRR       float64  `json:"mrr"`
+	NDCG      float64  `json:"ndcg"`
+	Results   []Result `json:"results"`
+}
+
+// Run searches every question and scores the hits against its references.
+// A failed search is recorded in its result; only cancellation of ctx stops
+// the run early.
+func Run(ctx context.Context, questions []Question, k int, search SearchFunc) (Report, error) {
+	if k <= 0 {
+		return Report{}, errors.New("k must be positive")
+	}
+
+	report := Report{K: k, Questions: len(questions)}
+	for _, question := range questions {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+		hits, err := search(ctx, question, k)
+		if err != nil {
+			if ctx.Err() != nil {
+				return report, ctx.Err()
+			}
+			report.Failed++
+			report.Results = append(report.Results, Result{ID: question.ID, Question: question.Question, Missing: question.Expected, Error: err.Error()})
+			continue
+		}
+		result := Score(hits, question.Expected, k)
+		result.ID = question.ID
+		result.Question = question.Question
+		report.Results = append(report.Results, result)
+
+		report.Recall += result.Recall
+		report.MRR += result.ReciprocalRank
+		report.NDCG += result.NDCG
+	}
+
+	if scored := report.Questions - report.Failed; scored > 0 {
+		report.Recall /= float64(scored)
+		report.MRR /= float64(scored)
+		report.NDCG /= float64(scored)
+	}
+	return report, nil
+}
@@ -0,0 +1,101 @@
+package eval
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/fabfab/airplane-chat/internal/embeddings"
+	"github.com/fabfab/airplane-chat/internal/vectorstore"
+)
+
+// TestRunOverFileStore indexes a few documents with the offline hash embedder
+// and checks that Run finds each answer where the questions expect it.
+func TestRunOverFileStore(t *testing.T) {
+	const (
+		model        = "hash"
+		dimension    = 256
+		conversation = "eval"
+	)
+	ctx := context.Background()
+
+	store, err := vectorstore.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	defer store.Close()
+	if err := store.RegisterModel(ctx, model, dimension, vectorstore.ModelActive); err != nil {
+		t.Fatalf("register model: %v", err)
+	}
+
+	embedder := embeddings.NewHashEmbedder(dimension)
+	documents := map[string][]string{
+		"runbook.md": {
+			"To roll back a deployment, redeploy the previous release tag.",
+			"Page the on-call engineer when the error rate stays above five percent.",
+		},
+		"recipes.md": {
+			"Knead the dough for ten minutes and let it rise overnight.",
+			"Bake the bread at two hundred degrees until the crust is golden.",
+		},
+	}
+	for name, contents := range documents {
+		vectors, err := embedder.Embed(ctx, contents)
+		if err != nil {
+			t.Fatalf("embed %s: %v", name, err)
+		}
+		chunking := vectorstore.Chunking{Contents: contents, Metadata: make([]vectorstore.Metadata, len(contents))}
+		for i := range contents {
+			chunking.Metadata[i] = vectorstore.Metadata{"document_name": name}
+		}
+		if err := store.UpsertDocumentChunks(ctx, model, conversation, "id-"+name, chunking, vectors); err != nil {
+			t.Fatalf("index %s: %v", name, err)
+		}
+	}
+
+	search := func(ctx context.Context, question Question, k int) ([]Hit, error) {
+		if question.ID == "broken" {
+			return nil, errors.New("search failed")
+		}
+		vectors, err := embedder.Embed(ctx, []string{question.Question})
+		if err != nil {
+			return nil, err
+		}
+		chunks, err := store.QuerySimilar(ctx, model, conversation, vectors[0], k, nil)
+		if err != nil {
+			return nil, err
+		}
+		hits := make([]Hit, len(chunks))
+		for i, chunk := range chunks {
+			name, _ := chunk.Metadata["document_name"].(string)
+			hits[i] = Hit{DocumentID: chunk.DocumentID, DocumentName: name, Content: chunk.Content}
+		}
+		return hits, nil
+	}
+
+	questions := []Question{
+		{ID: "rollback", Question: "How do I roll back a deployment?", Expected: []Reference{{Document: "runbook.md", Passage: "redeploy the previous release tag"}}},
+		{ID: "bread", Question: "How long should the dough rise?", Expected: []Reference{{Document: "id-recipes.md"}}},
+		{ID: "broken", Question: "Anything", Expected: []Reference{{Document: "runbook.md"}}},
+	}
+
+	report, err := Run(ctx, questions, 2, search)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if report.Questions != 3 || report.Failed != 1 {
+		t.Errorf("questions %d, failed %d; want 3 and 1", report.Questions, report.Failed)
+	}
+	if report.Recall != 1 || report.MRR != 1 || report.NDCG != 1 {
+		t.Errorf("recall %.3f, MRR %.3f, nDCG %.3f; want 1 each", report.Recall, report.MRR, report.NDCG)
+	}
+	if failed := report.Results[2]; failed.Error == "" || len(failed.Missing) != 1 {
+		t.Errorf("failed result = %+v, want its error and missing reference", failed)
+	}
+}
+
+func TestRunRejectsNonPositiveK(t *testing.T) {
+	if _, err := Run(context.Background(), nil, 0, nil); err == nil {
+		t.Error("Run with k 0 succeeded")
+	}
+}
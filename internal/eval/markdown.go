@@ -0,0 +1,60 @@
+package eval
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Markdown renders the report as a Markdown document with one section per
+// question in golden-set order, so two runs can be compared with diff.
+func (r AnswerReport) Markdown() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Answer evaluation\n\n")
+	fmt.Fprintf(&b, "- Chat model: `%s`\n- Judge model: `%s`\n- Questions: %d (%d failed)\n\n", r.ChatModel, r.JudgeModel, r.Questions, r.Failed)
+
+	fmt.Fprintf(&b, "| Metric | Score |\n|---|---|\n")
+	fmt.Fprintf(&b, "| Correctness | %.2f |\n| Faithfulness | %.2f |\n| Source recall | %.2f |\n\n", r.Correctness, r.Faithfulness, r.SourceRecall)
+
+	fmt.Fprintf(&b, "| Question | Correctness | Faithfulness | Source recall |\n|---|---|---|---|\n")
+	for _, result := range r.Results {
+		if result.Error != "" {
+			fmt.Fprintf(&b, "| %s | error | error | error |\n", result.ID)
+			continue
+		}
+		fmt.Fprintf(&b, "| %s | %.2f | %.2f | %.2f |\n", result.ID, result.Correctness, result.Faithfulness, result.SourceRecall)
+	}
+
+	for _, result := range r.Results {
+		fmt.Fprintf(&b, "\n## %s\n\n%s\n", result.ID, result.Question)
+		if result.Error != "" {
+			fmt.Fprintf(&b, "\n**Error:** %s\n", result.Error)
+			continue
+		}
+		fmt.Fprintf(&b, "\n%s\n", quote(result.Answer))
+		writeList(&b, "Missing facts", result.MissingFacts)
+		writeList(&b, "Missing documents", result.MissingDocuments)
+		writeList(&b, "Unsupported claims", result.UnsupportedClaims)
+		if result.Explanation != "" {
+			fmt.Fprintf(&b, "\n*Judge:* %s\n", strings.TrimSpace(result.Explanation))
+		}
+	}
+	return b.String()
+}
+
+func quote(text string) string {
+	lines := strings.Split(strings.TrimSpace(text), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight("> "+line, " ")
+	}
+	return strings.Join(lines, "\n")
+}
+
+func writeList(b *strings.Builder, title string, items []string) {
+	if len(items) == 0 {
+		return
+	}
+	fmt.Fprintf(b, "\n%s:\n\n", title)
+	for _, item := range items {
+		fmt.Fprintf(b, "- %s\n", item)
+	}
+}
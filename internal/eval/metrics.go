@@ -0,0 +1,74 @@
+package eval
+
+import (
+	"math"
+	"strings"
+)
+
+// Score rates the first k hits against the expected references. Each
+// reference counts once, credited to the first hit that matches it, so
+// retrieving the same passage twice earns nothing extra:
+//
+//   - recall@k is the share of references matched;
+//   - the reciprocal rank is 1/rank of the first matching hit;
+//   - nDCG@k discounts every matching hit by log2(rank+1) and divides by the
+//     score of a ranking that puts all references first.
+func Score(hits []Hit, expected []Reference, k int) Result {
+	if len(hits) > k {
+		hits = hits[:k]
+	}
+
+	var result Result
+	matched := make([]bool, len(expected))
+	dcg := 0.0
+	for i, hit := range hits {
+		rank := i + 1
+		for j, ref := range expected {
+			if matched[j] || !ref.matches(hit) {
+				continue
+			}
+			matched[j] = true
+			result.Ranks = append(result.Ranks, rank)
+			dcg += 1 / math.Log2(float64(rank)+1)
+			if result.ReciprocalRank == 0 {
+				result.ReciprocalRank = 1 / float64(rank)
+			}
+			break
+		}
+	}
+
+	ideal := 0.0
+	for rank := 1; rank <= min(k, len(expected)); rank++ {
+		ideal += 1 / math.Log2(float64(rank)+1)
+	}
+	if ideal > 0 {
+		result.NDCG = dcg / ideal
+	}
+
+	for j, ref := range expected {
+		if !matched[j] {
+			result.Missing = append(result.Missing, ref)
+		}
+	}
+	if len(expected) > 0 {
+		result.Recall = float64(len(result.Ranks)) / float64(len(expected))
+	}
+	return result
+}
+
+// matches reports whether hit comes from the referenced document and, when a
+// passage is given, contains it up to case and whitespace.
+func (r Reference) matches(hit Hit) bool {
+	if document := strings.TrimSpace(r.Document); document != "" &&
+		document != hit.DocumentID && !strings.EqualFold(document, hit.DocumentName) {
+		return false
+	}
+	if passage := normalizeText(r.Passage); passage != "" {
+		return strings.Contains(normalizeText(hit.Content), passage)
+	}
+	return true
+}
+
+func normalizeText(text string) string {
+	return strings.Join(strings.Fields(strings.ToLower(text)), " ")
+}
@@ -0,0 +1,119 @@
+package eval
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestScore(t *testing.T) {
+	// Discounts of ranks 1-3 for nDCG.
+	d1, d2, d3 := 1.0, 1/math.Log2(3), 0.5
+
+	tests := []struct {
+		name     string
+		hits     []Hit
+		expected []Reference
+		k        int
+		want     Result
+	}{
+		{
+			name:     "first hit matches",
+			hits:     []Hit{{DocumentID: "a"}, {DocumentID: "b"}},
+			expected: []Reference{{Document: "a"}},
+			k:        5,
+			want:     Result{Recall: 1, ReciprocalRank: 1, NDCG: 1, Ranks: []int{1}},
+		},
+		{
+			name:     "late hit",
+			hits:     []Hit{{DocumentID: "x"}, {DocumentID: "y"}, {DocumentID: "a"}},
+			expected: []Reference{{Document: "a"}},
+			k:        5,
+			want:     Result{Recall: 1, ReciprocalRank: 1.0 / 3, NDCG: d3 / d1, Ranks: []int{3}},
+		},
+		{
+			name:     "partial recall",
+			hits:     []Hit{{DocumentID: "x"}, {DocumentID: "b"}},
+			expected: []Reference{{Document: "a"}, {Document: "b"}},
+			k:        5,
+			want: Result{Recall: 0.5, ReciprocalRank: 0.5, NDCG: d2 / (d1 + d2), Ranks: []int{2},
+				Missing: []Reference{{Document: "a"}}},
+		},
+		{
+			name:     "duplicate hits earn nothing extra",
+			hits:     []Hit{{DocumentID: "a"}, {DocumentID: "a"}, {DocumentID: "b"}},
+			expected: []Reference{{Document: "a"}, {Document: "b"}},
+			k:        5,
+			want:     Result{Recall: 1, ReciprocalRank: 1, NDCG: (d1 + d3) / (d1 + d2), Ranks: []int{1, 3}},
+		},
+		{
+			name:     "k truncates hits",
+			hits:     []Hit{{DocumentID: "x"}, {DocumentID: "y"}, {DocumentID: "a"}},
+			expected: []Reference{{Document: "a"}},
+			k:        2,
+			want:     Result{Missing: []Reference{{Document: "a"}}},
+		},
+		{
+			name:     "k caps the ideal ranking",
+			hits:     []Hit{{DocumentID: "a"}, {DocumentID: "b"}},
+			expected: []Reference{{Document: "a"}, {Document: "b"}, {Document: "c"}},
+			k:        2,
+			want:     Result{Recall: 2.0 / 3, ReciprocalRank: 1, NDCG: 1, Ranks: []int{1, 2}, Missing: []Reference{{Document: "c"}}},
+		},
+		{
+			name: "passage must be contained",
+			hits: []Hit{
+				{DocumentID: "a", Content: "Restart the service."},
+				{DocumentID: "a", Content: "To roll back,\n  REDEPLOY the previous tag."},
+			},
+			expected: []Reference{{Document: "a", Passage: "redeploy the   previous tag"}},
+			k:        5,
+			want:     Result{Recall: 1, ReciprocalRank: 0.5, NDCG: d2, Ranks: []int{2}},
+		},
+		{
+			name:     "document matches by name",
+			hits:     []Hit{{DocumentID: "1234", DocumentName: "Runbook.md"}},
+			expected: []Reference{{Document: "runbook.md"}},
+			k:        5,
+			want:     Result{Recall: 1, ReciprocalRank: 1, NDCG: 1, Ranks: []int{1}},
+		},
+		{
+			name:     "passage in any document",
+			hits:     []Hit{{DocumentID: "a", Content: "unrelated"}, {DocumentID: "b", Content: "the rollback steps"}},
+			expected: []Reference{{Passage: "rollback steps"}},
+			k:        5,
+			want:     Result{Recall: 1, ReciprocalRank: 0.5, NDCG: d2, Ranks: []int{2}},
+		},
+		{
+			name: "no expected references",
+			hits: []Hit{{DocumentID: "a"}},
+			k:    5,
+			want: Result{},
+		},
+		{
+			name:     "no hits",
+			expected: []Reference{{Document: "a"}},
+			k:        5,
+			want:     Result{Missing: []Reference{{Document: "a"}}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Score(tt.hits, tt.expected, tt.k)
+			if !approxEqual(got.Recall, tt.want.Recall) || !approxEqual(got.ReciprocalRank, tt.want.ReciprocalRank) || !approxEqual(got.NDCG, tt.want.NDCG) {
+				t.Errorf("recall %.4f, RR %.4f, nDCG %.4f; want %.4f, %.4f, %.4f",
+					got.Recall, got.ReciprocalRank, got.NDCG, tt.want.Recall, tt.want.ReciprocalRank, tt.want.NDCG)
+			}
+			if !reflect.DeepEqual(got.Ranks, tt.want.Ranks) {
+				t.Errorf("ranks = %v, want %v", got.Ranks, tt.want.Ranks)
+			}
+			if !reflect.DeepEqual(got.Missing, tt.want.Missing) {
+				t.Errorf("missing = %v, want %v", got.Missing, tt.want.Missing)
+			}
+		})
+	}
+}
+
+func approxEqual(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
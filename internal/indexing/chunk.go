@@ -0,0 +1,215 @@
+package indexing
+
+import (
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/fabfab/airplane-chat/internal/storage"
+	"github.com/fabfab/airplane-chat/internal/vectorstore"
+)
+
+// span is a chunk and the rune offset at which its window starts.
+type span struct {
+	start int
+	text  string
+}
+
+// chunkSpans splits runes into overlapping windows of chunkSize runes.
+func chunkSpans(runes []rune, chunkSize int, overlap int) []span {
+	if chunkSize <= 0 {
+		return []span{}
+	}
+	if len(runes) <= chunkSize {
+		return []span{{start: 0, text: strings.TrimSpace(string(runes))}}
+	}
+
+	if overlap >= chunkSize {
+		overlap = chunkSize / 4
+	}
+	if overlap < 0 {
+		overlap = 0
+	}
+
+	var spans []span
+	total := len(runes)
+
+	step := chunkSize - overlap
+	if step <= 0 {
+		step = chunkSize
+	}
+
+	for start := 0; start < total; start += step {
+		end := start + chunkSize
+		if end > total {
+			end = total
+		}
+		chunk := strings.TrimSpace(string(runes[start:end]))
+		if chunk != "" {
+			spans = append(spans, span{start: start, text: chunk})
+		}
+		if end == total {
+			break
+		}
+	}
+
+	return spans
+}
+
+// ChunkOptions selects how documents are split. With SectionSize zero a
+// document is cut into overlapping chunks of chunkSize runes. Otherwise it is
+// cut into sections of at most SectionSize runes, ending at paragraph breaks
+// where possible, and every section into overlapping chunks of ChildSize runes
+// that are embedded on its behalf: searches match the small chunks and can
+// hand the model their sections.
+type ChunkOptions struct {
+	SectionSize int
+	ChildSize   int
+}
+
+// chunkDocument splits a document's text into chunks and describes each with
+// the metadata searches can filter on: document_name, file_type, uploaded_at,
+// tags, plus heading for Markdown and page when the text has form feeds.
+func chunkDocument(document storage.Document, text string, options ChunkOptions) vectorstore.Chunking {
+	runes := []rune(text)
+	describe := describer(document, runes)
+
+	var chunking vectorstore.Chunking
+	if options.SectionSize <= 0 {
+		for _, span := range chunkSpans(runes, chunkSize, chunkOverlap) {
+			chunking.Contents = append(chunking.Contents, span.text)
+			chunking.Metadata = append(chunking.Metadata, describe(span.start, span.start+len([]rune(span.text))))
+		}
+		return chunking
+	}
+
+	for _, window := range sectionWindows(runes, options.SectionSize) {
+		section := strings.TrimSpace(string(runes[window[0]:window[1]]))
+		if section == "" {
+			continue
+		}
+		parent := len(chunking.Sections)
+		chunking.Sections = append(chunking.Sections, vectorstore.Section{
+			Content:  section,
+			Metadata: describe(window[0], window[1]),
+		})
+		for _, span := range chunkSpans(runes[window[0]:window[1]], options.ChildSize, options.ChildSize/6) {
+			start := window[0] + span.start
+			chunking.Contents = append(chunking.Contents, span.text)
+			chunking.Metadata = append(chunking.Metadata, describe(start, start+len([]rune(span.text))))
+			chunking.Parents = append(chunking.Parents, parent)
+		}
+	}
+	return chunking
+}
+
+// describer returns a function building the metadata of the text between two
+// rune offsets of a document.
+func describer(document storage.Document, runes []rune) func(start, end int) vectorstore.Metadata {
+	fileType := strings.TrimPrefix(strings.ToLower(filepath.Ext(document.Name)), ".")
+	if fileType == "" {
+		fileType = "txt"
+	}
+	markdown := fileType == "md" || fileType == "markdown"
+	paged := slices.Contains(runes, '\f')
+
+	var headings []heading
+	if markdown {
+		headings = markdownHeadings(runes)
+	}
+
+	return func(start, end int) vectorstore.Metadata {
+		meta := vectorstore.Metadata{
+			"document_name": document.Name,
+			"file_type":     fileType,
+			"uploaded_at":   document.UploadedAt.UTC().Format(time.RFC3339),
+		}
+		if len(document.Tags) > 0 {
+			meta["tags"] = document.Tags
+		}
+		if title := headingAt(headings, start, end); title != "" {
+			meta["heading"] = title
+		}
+		if paged {
+			meta["page"] = 1 + countRune(runes[:start], '\f')
+		}
+		return meta
+	}
+}
+
+// sectionWindows cuts runes into consecutive [start, end) windows of at most
+// size runes. A window ends after the last blank line in its second half when
+// there is one, so sections rarely split a paragraph.
+func sectionWindows(runes []rune, size int) [][2]int {
+	var windows [][2]int
+	for start := 0; start < len(runes); {
+		end := min(start+size, len(runes))
+		if end < len(runes) {
+			for i := end - 1; i > start+size/2; i-- {
+				if runes[i] == '\n' && runes[i-1] == '\n' {
+					end = i + 1
+					break
+				}
+			}
+		}
+		windows = append(windows, [2]int{start, end})
+		start = end
+	}
+	return windows
+}
+
+type heading struct {
+	offset int
+	title  string
+}
+
+// markdownHeadings returns the ATX headings of a Markdown text with the rune
+// offsets of their lines.
+func markdownHeadings(runes []rune) []heading {
+	var headings []heading
+	offset := 0
+	inFence := false
+	for _, line := range strings.SplitAfter(string(runes), "\n") {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(trimmed, "```"):
+			inFence = !inFence
+		case !inFence:
+			rest := strings.TrimLeft(trimmed, "#")
+			if rest != trimmed && strings.HasPrefix(rest, " ") {
+				if title := strings.TrimSpace(rest); title != "" {
+					headings = append(headings, heading{offset: offset, title: title})
+				}
+			}
+		}
+		offset += len([]rune(line))
+	}
+	return headings
+}
+
+// headingAt returns the heading in effect where a chunk starts, or the first
+// heading inside it when the chunk starts before any.
+func headingAt(headings []heading, start, end int) string {
+	title := ""
+	for _, h := range headings {
+		if h.offset > start {
+			if title == "" && h.offset < end {
+				return h.title
+			}
+			break
+		}
+		title = h.title
+	}
+	return title
+}
+
+func countRune(runes []rune, r rune) int {
+	count := 0
+	for _, c := range runes {
+		if c == r {
+			count++
+		}
+	}
+	return count
+}
@@ -0,0 +1,187 @@
+package indexing
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"github.com/fabfab/airplane-chat/internal/vectorstore"
+)
+
+// Passage is a run of consecutive chunks of one document around one or more
+// search hits, with the overlap between neighbouring chunks removed, or the
+// section enclosing the hits. For sections FirstChunk and LastChunk bound the
+// hits.
+type Passage struct {
+	DocumentID string               `json:"document_id"`
+	Section    *int                 `json:"section,omitempty"`
+	FirstChunk int                  `json:"first_chunk"`
+	LastChunk  int                  `json:"last_chunk"`
+	Hits       []int                `json:"hits"`
+	Score      float32              `json:"score"`
+	Content    string               `json:"content"`
+	Metadata   vectorstore.Metadata `json:"metadata,omitempty"`
+}
+
+type window struct {
+	documentID  string
+	first, last int
+	hits        []int
+	score       float32
+	rank        int
+	metadata    vectorstore.Metadata
+}
+
+// Expand widens every hit of result by neighbors chunks on each side and
+// merges hits of the same document whose windows touch, so the model sees
+// coherent passages instead of fragments cut mid-paragraph. Passages keep the
+// order of their best hit.
+func (ix *Indexer) Expand(ctx context.Context, conversationID string, result SearchResult, neighbors int) ([]Passage, error) {
+	if neighbors < 0 {
+		neighbors = 0
+	}
+
+	byDocument := map[string][]window{}
+	for rank, chunk := range result.Chunks {
+		byDocument[chunk.DocumentID] = append(byDocument[chunk.DocumentID], window{
+			documentID: chunk.DocumentID,
+			first:      max(0, chunk.ChunkIndex-neighbors),
+			last:       chunk.ChunkIndex + neighbors,
+			hits:       []int{chunk.ChunkIndex},
+			score:      chunk.Score,
+			rank:       rank,
+			metadata:   chunk.Metadata,
+		})
+	}
+
+	var windows []window
+	for _, docWindows := range byDocument {
+		sort.Slice(docWindows, func(i, j int) bool { return docWindows[i].first < docWindows[j].first })
+		merged := docWindows[:1]
+		for _, w := range docWindows[1:] {
+			last := &merged[len(merged)-1]
+			if w.first > last.last+1 {
+				merged = append(merged, w)
+				continue
+			}
+			last.last = max(last.last, w.last)
+			last.hits = append(last.hits, w.hits...)
+			if w.rank < last.rank {
+				last.rank, last.score, last.metadata = w.rank, w.score, w.metadata
+			}
+		}
+		windows = append(windows, merged...)
+	}
+	sort.Slice(windows, func(i, j int) bool { return windows[i].rank < windows[j].rank })
+
+	passages := make([]Passage, 0, len(windows))
+	for _, w := range windows {
+		chunks, err := ix.vectors.ChunkRange(ctx, result.Model.Key, conversationID, w.documentID, w.first, w.last)
+		if err != nil {
+			return nil, err
+		}
+		sort.Ints(w.hits)
+		passage := Passage{
+			DocumentID: w.documentID,
+			FirstChunk: w.first,
+			LastChunk:  w.last,
+			Hits:       w.hits,
+			Score:      w.score,
+			Metadata:   w.metadata,
+		}
+		if len(chunks) > 0 {
+			passage.FirstChunk = chunks[0].ChunkIndex
+			passage.LastChunk = chunks[len(chunks)-1].ChunkIndex
+		}
+		for i, chunk := range chunks {
+			if i > 0 && chunk.ChunkIndex != chunks[i-1].ChunkIndex+1 {
+				passage.Content += "\n…\n" + chunk.Content
+				continue
+			}
+			passage.Content = mergeOverlap(passage.Content, chunk.Content)
+		}
+		passages = append(passages, passage)
+	}
+	return passages, nil
+}
+
+// Passages returns what a search hands the model in place of its hits: the
+// sections enclosing them when the documents were indexed in two levels,
+// otherwise the hits widened by neighbors chunks. It returns nil when the hits
+// should be used as they are.
+func (ix *Indexer) Passages(ctx context.Context, conversationID string, result SearchResult, neighbors int) ([]Passage, error) {
+	switch {
+	case result.HasSections():
+		return ix.Parents(ctx, conversationID, result)
+	case neighbors > 0:
+		return ix.Expand(ctx, conversationID, result, neighbors)
+	}
+	return nil, nil
+}
+
+// Parents replaces the hits of result with the sections that enclose them,
+// keeping each section once at the rank of its best hit. Hits without a
+// section are returned on their own.
+func (ix *Indexer) Parents(ctx context.Context, conversationID string, result SearchResult) ([]Passage, error) {
+	var ids []uuid.UUID
+	seen := map[uuid.UUID]int{}
+	passages := make([]Passage, 0, len(result.Chunks))
+	for _, chunk := range result.Chunks {
+		if i, ok := seen[chunk.ParentID]; ok && chunk.ParentID != uuid.Nil {
+			passage := &passages[i]
+			passage.Hits = append(passage.Hits, chunk.ChunkIndex)
+			passage.FirstChunk = min(passage.FirstChunk, chunk.ChunkIndex)
+			passage.LastChunk = max(passage.LastChunk, chunk.ChunkIndex)
+			continue
+		}
+		if chunk.ParentID != uuid.Nil {
+			seen[chunk.ParentID] = len(passages)
+			ids = append(ids, chunk.ParentID)
+		}
+		passages = append(passages, Passage{
+			DocumentID: chunk.DocumentID,
+			FirstChunk: chunk.ChunkIndex,
+			LastChunk:  chunk.ChunkIndex,
+			Hits:       []int{chunk.ChunkIndex},
+			Score:      chunk.Score,
+			Content:    chunk.Content,
+			Metadata:   chunk.Metadata,
+		})
+	}
+
+	sections, err := ix.vectors.Sections(ctx, result.Model.Key, conversationID, ids)
+	if err != nil {
+		return nil, err
+	}
+	for _, section := range sections {
+		passage := &passages[seen[section.ID]]
+		index := section.ChunkIndex
+		passage.Section = &index
+		passage.Content = section.Content
+		passage.Metadata = section.Metadata
+	}
+	for i := range passages {
+		sort.Ints(passages[i].Hits)
+	}
+	return passages, nil
+}
+
+// mergeOverlap appends next to text, dropping the longest prefix of next that
+// text already ends with. Chunks overlap by chunkOverlap runes, less any
+// whitespace trimmed at their edges; very short matches are treated as
+// coincidence.
+func mergeOverlap(text, next string) string {
+	const minOverlap = 8
+	if text == "" {
+		return next
+	}
+	limit := min(len(text), len(next), 4*chunkOverlap)
+	for k := limit; k >= minOverlap; k-- {
+		if strings.HasSuffix(text, next[:k]) {
+			return text + next[k:]
+		}
+	}
+	return text + "\n" + next
+}
@@ -0,0 +1,185 @@
+package indexing
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/fabfab/airplane-chat/internal/vectorstore"
+)
+
+var testModel = Model{Name: "embed", Dimension: 2, Key: "embed"}
+
+// storedIndex returns an Indexer over a store holding each chunking as a
+// document of conversation "c", named by its key.
+func storedIndex(t *testing.T, documents map[string]vectorstore.Chunking) *Indexer {
+	t.Helper()
+	ctx := context.Background()
+	ti := newTestIndex(t)
+	if err := ti.vectors.RegisterModel(ctx, testModel.Key, testModel.Dimension, vectorstore.ModelActive); err != nil {
+		t.Fatalf("RegisterModel: %v", err)
+	}
+	for documentID, chunking := range documents {
+		vectors := make([][]float32, len(chunking.Contents))
+		for i := range vectors {
+			vectors[i] = []float32{1, 0}
+		}
+		if err := ti.vectors.UpsertDocumentChunks(ctx, testModel.Key, "c", documentID, chunking, vectors); err != nil {
+			t.Fatalf("UpsertDocumentChunks: %v", err)
+		}
+	}
+	return New(ti.store, ti.vectors, keywordEmbedders, testModel, ChunkOptions{})
+}
+
+// hit is a search hit on chunk index of document.
+type hit struct {
+	document string
+	index    int
+}
+
+// searchResult returns the stored chunks named by hits, in that order, as a
+// search would.
+func searchResult(t *testing.T, ix *Indexer, hits ...hit) SearchResult {
+	t.Helper()
+	result := SearchResult{Model: testModel}
+	for rank, h := range hits {
+		chunks, err := ix.vectors.ChunkRange(context.Background(), testModel.Key, "c", h.document, h.index, h.index)
+		if err != nil || len(chunks) != 1 {
+			t.Fatalf("chunk %s/%d: %v, %v", h.document, h.index, chunks, err)
+		}
+		chunk := chunks[0]
+		chunk.Score = 1 - float32(rank)/10
+		result.Chunks = append(result.Chunks, chunk)
+	}
+	return result
+}
+
+func TestParents(t *testing.T) {
+	ix := storedIndex(t, map[string]vectorstore.Chunking{
+		"sectioned": {
+			Contents: []string{"a0", "a1", "a2", "b0", "b1"},
+			Sections: []vectorstore.Section{{Content: "section A"}, {Content: "section B"}},
+			Parents:  []int{0, 0, 0, 1, 1},
+		},
+		"flat": {Contents: []string{"f0", "f1"}},
+	})
+
+	result := searchResult(t, ix, hit{"sectioned", 2}, hit{"flat", 1}, hit{"sectioned", 4}, hit{"sectioned", 0})
+	if !result.HasSections() {
+		t.Fatal("HasSections = false for hits inside sections")
+	}
+	passages, err := ix.Parents(context.Background(), "c", result)
+	if err != nil {
+		t.Fatalf("Parents: %v", err)
+	}
+
+	var got []string
+	for _, p := range passages {
+		section := "-"
+		if p.Section != nil {
+			section = fmt.Sprint(*p.Section)
+		}
+		got = append(got, fmt.Sprintf("%s section %s chunks %d-%d hits %v %q score %.1f",
+			p.DocumentID, section, p.FirstChunk, p.LastChunk, p.Hits, p.Content, p.Score))
+	}
+	want := []string{
+		`sectioned section 0 chunks 0-2 hits [0 2] "section A" score 1.0`,
+		`flat section - chunks 1-1 hits [1] "f1" score 0.9`,
+		`sectioned section 1 chunks 4-4 hits [4] "section B" score 0.8`,
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("passages =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestPassagesChoosesExpansion(t *testing.T) {
+	ix := storedIndex(t, map[string]vectorstore.Chunking{
+		"flat": {Contents: []string{"f0", "f1", "f2"}},
+	})
+	result := searchResult(t, ix, hit{"flat", 1})
+
+	passages, err := ix.Passages(context.Background(), "c", result, 0)
+	if err != nil || passages != nil {
+		t.Errorf("Passages without neighbours = %+v, %v; want the hits as they are", passages, err)
+	}
+	passages, err = ix.Passages(context.Background(), "c", result, 1)
+	if err != nil || len(passages) != 1 || passages[0].FirstChunk != 0 || passages[0].LastChunk != 2 {
+		t.Errorf("Passages with a neighbour = %+v, %v; want chunks 0 to 2", passages, err)
+	}
+}
+
+func TestMergeOverlap(t *testing.T) {
+	tests := []struct {
+		text, next, want string
+	}{
+		{"", "first chunk", "first chunk"},
+		{"the quick brown fox jumps", "brown fox jumps over the dog", "the quick brown fox jumps over the dog"},
+		{"ends with fox", "fox starts here", "ends with fox\nfox starts here"},
+		{"no shared text", "at all here", "no shared text\nat all here"},
+	}
+	for _, tt := range tests {
+		if got := mergeOverlap(tt.text, tt.next); got != tt.want {
+			t.Errorf("mergeOverlap(%q, %q) = %q, want %q", tt.text, tt.next, got, tt.want)
+		}
+	}
+}
+
+func TestExpandRestoresText(t *testing.T) {
+	text := numberedText(1000, -1)
+	var chunking vectorstore.Chunking
+	for _, span := range chunkSpans([]rune(text), chunkSize, chunkOverlap) {
+		chunking.Contents = append(chunking.Contents, span.text)
+	}
+	ix := storedIndex(t, map[string]vectorstore.Chunking{"d": chunking})
+
+	passages, err := ix.Expand(context.Background(), "c", searchResult(t, ix, hit{"d", 2}), 10)
+	if err != nil {
+		t.Fatalf("Expand: %v", err)
+	}
+	if len(passages) != 1 || passages[0].Content != strings.TrimSpace(text) {
+		t.Errorf("passages = %+v, want the whole document once", passages)
+	}
+}
+
+func TestExpandMergesWindows(t *testing.T) {
+	ix := storedIndex(t, map[string]vectorstore.Chunking{
+		"a": {Contents: []string{"a0", "a1", "a2", "a3", "a4", "a5", "a6", "a7", "a8"}},
+		"b": {Contents: []string{"b0", "b1"}},
+	})
+
+	// a3 and a1 touch once widened; a8 is too far away; b0 ranks between.
+	result := searchResult(t, ix, hit{"a", 8}, hit{"a", 3}, hit{"b", 0}, hit{"a", 1})
+	passages, err := ix.Expand(context.Background(), "c", result, 1)
+	if err != nil {
+		t.Fatalf("Expand: %v", err)
+	}
+
+	var got []string
+	for _, p := range passages {
+		got = append(got, fmt.Sprintf("%s %d-%d hits %v score %.1f %q", p.DocumentID, p.FirstChunk, p.LastChunk, p.Hits, p.Score, p.Content))
+	}
+	want := []string{
+		`a 7-8 hits [8] score 1.0 "a7\na8"`,
+		`a 0-4 hits [1 3] score 0.9 "a0\na1\na2\na3\na4"`,
+		`b 0-1 hits [0] score 0.8 "b0\nb1"`,
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("passages =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestExpandClampsToStoredChunks(t *testing.T) {
+	ix := storedIndex(t, map[string]vectorstore.Chunking{
+		"a": {Contents: []string{"a0", "a1", "a2"}},
+	})
+	result := searchResult(t, ix, hit{"a", 1})
+
+	passages, err := ix.Expand(context.Background(), "c", result, 5)
+	if err != nil {
+		t.Fatalf("Expand: %v", err)
+	}
+	if len(passages) != 1 || passages[0].FirstChunk != 0 || passages[0].LastChunk != 2 {
+		t.Errorf("passages = %+v, want the window clamped to stored chunks 0 to 2", passages)
+	}
+}
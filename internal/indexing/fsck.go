@@ -0,0 +1,170 @@
+package indexing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/fabfab/airplane-chat/internal/vectorstore"
+)
+
+// Reasons an orphaned set of chunks no longer matches a stored document.
+const (
+	OrphanConversationMissing = "conversation_missing"
+	OrphanDocumentMissing     = "document_missing"
+)
+
+// CheckReport lists drift between the documents stored under DATA_DIR and the
+// chunks in the vector store.
+type CheckReport struct {
+	Model         string        `json:"model"`
+	Conversations int           `json:"conversations"`
+	Documents     int           `json:"documents"`
+	Unindexed     []DocumentRef `json:"unindexed"`
+	MissingFiles  []DocumentRef `json:"missing_files"`
+	Orphans       []Orphan      `json:"orphans"`
+	Repair        *RepairReport `json:"repair,omitempty"`
+}
+
+// DocumentRef identifies a stored document.
+type DocumentRef struct {
+	ConversationID string `json:"conversation_id"`
+	DocumentID     string `json:"document_id"`
+	Name           string `json:"name"`
+}
+
+// Orphan describes chunks whose document is no longer stored.
+type Orphan struct {
+	vectorstore.DocumentChunks
+	Reason string `json:"reason"`
+}
+
+// RepairReport summarises the fixes applied by Repair. Unrepairable lists
+// unindexed documents that were left alone because their files are gone.
+type RepairReport struct {
+	Reindexed    int              `json:"reindexed"`
+	Deleted      int              `json:"deleted"`
+	Failures     []ReindexFailure `json:"failures,omitempty"`
+	Unrepairable []DocumentRef    `json:"unrepairable,omitempty"`
+}
+
+// Clean reports whether the check found nothing to fix.
+func (r CheckReport) Clean() bool {
+	return len(r.Unindexed) == 0 && len(r.MissingFiles) == 0 && len(r.Orphans) == 0
+}
+
+// Check compares stored documents with the chunks of the active model:
+// documents without chunks, documents whose files are gone, and chunks whose
+// conversation or document no longer exists.
+func (ix *Indexer) Check(ctx context.Context) (CheckReport, error) {
+	model := ix.ActiveModel()
+	report := CheckReport{
+		Model:        model.Key,
+		Unindexed:    []DocumentRef{},
+		MissingFiles: []DocumentRef{},
+		Orphans:      []Orphan{},
+	}
+
+	chunked, err := ix.vectors.ListDocumentChunks(ctx)
+	if err != nil {
+		return report, err
+	}
+	indexed := make(map[[2]string]bool)
+	for _, doc := range chunked {
+		if doc.Model == model.Key {
+			indexed[[2]string{doc.ConversationID, doc.DocumentID}] = true
+		}
+	}
+
+	conversations, err := ix.storage.ListConversations()
+	if err != nil {
+		return report, fmt.Errorf("list conversations: %w", err)
+	}
+	report.Conversations = len(conversations)
+
+	stored := make(map[string]map[string]bool, len(conversations))
+	for _, conversationID := range conversations {
+		documents, err := ix.storage.ListDocuments(conversationID)
+		if err != nil {
+			return report, fmt.Errorf("list documents of %s: %w", conversationID, err)
+		}
+		report.Documents += len(documents)
+
+		ids := make(map[string]bool, len(documents))
+		for _, document := range documents {
+			ids[document.ID] = true
+			ref := DocumentRef{ConversationID: conversationID, DocumentID: document.ID, Name: document.Name}
+			if !fileExists(document.StoredPath) || !fileExists(document.TextPath) {
+				report.MissingFiles = append(report.MissingFiles, ref)
+			}
+			if !indexed[[2]string{conversationID, document.ID}] {
+				report.Unindexed = append(report.Unindexed, ref)
+			}
+		}
+		stored[conversationID] = ids
+	}
+
+	for _, doc := range chunked {
+		documents, ok := stored[doc.ConversationID]
+		switch {
+		case !ok:
+			report.Orphans = append(report.Orphans, Orphan{DocumentChunks: doc, Reason: OrphanConversationMissing})
+		case !documents[doc.DocumentID]:
+			report.Orphans = append(report.Orphans, Orphan{DocumentChunks: doc, Reason: OrphanDocumentMissing})
+		}
+	}
+
+	return report, nil
+}
+
+// Repair reindexes the unindexed documents of report and deletes its orphaned
+// chunks. Unindexed documents whose files are gone cannot be reindexed and are
+// reported as unrepairable instead.
+func (ix *Indexer) Repair(ctx context.Context, report CheckReport) (RepairReport, error) {
+	var repair RepairReport
+
+	missing := make(map[DocumentRef]bool, len(report.MissingFiles))
+	for _, ref := range report.MissingFiles {
+		missing[ref] = true
+	}
+
+	for _, ref := range report.Unindexed {
+		if missing[ref] {
+			repair.Unrepairable = append(repair.Unrepairable, ref)
+			continue
+		}
+		if _, err := ix.ReindexDocument(ctx, ref.ConversationID, ref.DocumentID); err != nil {
+			if ctx.Err() != nil {
+				return repair, ctx.Err()
+			}
+			repair.Failures = append(repair.Failures, ReindexFailure{
+				ConversationID: ref.ConversationID,
+				DocumentID:     ref.DocumentID,
+				Error:          err.Error(),
+			})
+			continue
+		}
+		repair.Reindexed++
+	}
+
+	deleted := make(map[[2]string]bool)
+	for _, orphan := range report.Orphans {
+		key := [2]string{orphan.ConversationID, orphan.DocumentID}
+		if deleted[key] {
+			continue
+		}
+		if err := ix.vectors.DeleteDocumentChunks(ctx, orphan.ConversationID, orphan.DocumentID); err != nil {
+			return repair, fmt.Errorf("delete chunks of %s/%s: %w", orphan.ConversationID, orphan.DocumentID, err)
+		}
+		deleted[key] = true
+		repair.Deleted++
+	}
+
+	return repair, nil
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return !errors.Is(err, os.ErrNotExist)
+}
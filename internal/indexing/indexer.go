@@ -0,0 +1,299 @@
+// Package indexing turns stored documents into vector store chunks and keeps
+// them in step with the configured embedding model. When the model changes it
+// re-embeds every document in the background while the previous model keeps
+// answering queries, then switches over in one step.
+package indexing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/fabfab/airplane-chat/internal/embeddings"
+	"github.com/fabfab/airplane-chat/internal/storage"
+	"github.com/fabfab/airplane-chat/internal/vectorstore"
+)
+
+const (
+	chunkSize    = 1500
+	chunkOverlap = 250
+)
+
+// EmbedderFactory builds an embedder for a model of the given dimension.
+type EmbedderFactory func(model string, dimension int) embeddings.Embedder
+
+// Model names an embedding model and the dimension of its vectors. Key is
+// the name the vector store registers its chunks under: the model name, or
+// name@dimension when the model was re-embedded at a new dimension, so the
+// old and new vectors can coexist until the switch.
+type Model struct {
+	Name      string `json:"name"`
+	Dimension int    `json:"dimension"`
+	Key       string `json:"key"`
+}
+
+// registered returns the Model a registry entry stands for.
+func registered(entry vectorstore.EmbeddingModel) Model {
+	name := entry.Name
+	if at := strings.LastIndex(name, "@"); at > 0 && name[at+1:] == strconv.Itoa(entry.Dimension) {
+		name = name[:at]
+	}
+	return Model{Name: name, Dimension: entry.Dimension, Key: entry.Name}
+}
+
+// Job states reported by Status.
+const (
+	JobIdle      = "idle"
+	JobRunning   = "running"
+	JobCompleted = "completed"
+	JobFailed    = "failed"
+)
+
+// JobStatus describes the progress of the background re-embed job.
+type JobStatus struct {
+	State      string    `json:"state"`
+	Target     string    `json:"target,omitempty"`
+	Documents  int       `json:"documents"`
+	Embedded   int       `json:"embedded"`
+	Skipped    int       `json:"skipped"`
+	Failed     int       `json:"failed"`
+	StartedAt  time.Time `json:"started_at,omitzero"`
+	FinishedAt time.Time `json:"finished_at,omitzero"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// Status reports which models serve and receive embeddings.
+type Status struct {
+	Active   *Model    `json:"active"`
+	Building *Model    `json:"building,omitempty"`
+	Job      JobStatus `json:"job"`
+}
+
+type handle struct {
+	model    Model
+	embedder embeddings.Embedder
+}
+
+// Indexer embeds documents into a VectorStore and serves similarity searches.
+type Indexer struct {
+	storage     storage.Store
+	vectors     vectorstore.VectorStore
+	newEmbedder EmbedderFactory
+	target      Model
+	chunking    ChunkOptions
+
+	mu       sync.RWMutex
+	active   *handle
+	building *handle
+	job      JobStatus
+
+	wg sync.WaitGroup
+}
+
+// New returns an Indexer that converges the vector store on target and splits
+// documents according to chunking. Call Start before use.
+func New(store storage.Store, vectors vectorstore.VectorStore, newEmbedder EmbedderFactory, target Model, chunking ChunkOptions) *Indexer {
+	return &Indexer{
+		storage:     store,
+		vectors:     vectors,
+		newEmbedder: newEmbedder,
+		target:      target,
+		chunking:    chunking,
+		job:         JobStatus{State: JobIdle},
+	}
+}
+
+// Start reconciles the configured model with the one the store serves and,
+// when they differ, launches the re-embed job. The job runs until it finishes
+// or ctx is cancelled; Wait blocks until it has stopped.
+func (ix *Indexer) Start(ctx context.Context) error {
+	models, err := ix.vectors.Models(ctx)
+	if err != nil {
+		return fmt.Errorf("list embedding models: %w", err)
+	}
+
+	target := ix.target
+	target.Key = target.Name
+	entry, ok := vectorstore.ActiveModel(models)
+	current := registered(entry)
+
+	switch {
+	case !ok:
+		// First start, or chunks written before models were tracked.
+		if err := ix.vectors.RegisterModel(ctx, target.Key, target.Dimension, vectorstore.ModelActive); err != nil {
+			return fmt.Errorf("register embedding model: %w", err)
+		}
+		adopted, dropped, err := ix.vectors.AdoptUntaggedChunks(ctx, target.Key, target.Dimension)
+		if err != nil {
+			return err
+		}
+		if adopted > 0 || dropped > 0 {
+			log.Printf("embedding model %s: adopted %d existing chunks, dropped %d of another dimension", target.Name, adopted, dropped)
+		}
+		ix.active = ix.handle(target)
+		if dropped > 0 {
+			ix.launch(ctx, ix.active, false)
+		}
+
+	case current.Name == target.Name && current.Dimension == target.Dimension:
+		ix.active = ix.handle(current)
+
+	default:
+		if current.Name == target.Name {
+			// The same model at a new dimension is registered under a
+			// versioned key so its chunks do not replace the serving ones.
+			target.Key = fmt.Sprintf("%s@%d", target.Name, target.Dimension)
+			log.Printf("embedding model %s changed dimension %d -> %d; re-embedding documents while the old vectors keep serving", target.Name, current.Dimension, target.Dimension)
+		} else {
+			log.Printf("embedding model changed %s -> %s; re-embedding documents while %s keeps serving", current.Name, target.Name, current.Name)
+		}
+		if err := ix.vectors.RegisterModel(ctx, target.Key, target.Dimension, vectorstore.ModelBuilding); err != nil {
+			return fmt.Errorf("register embedding model: %w", err)
+		}
+		ix.active = ix.handle(current)
+		ix.building = ix.handle(target)
+		ix.launch(ctx, ix.building, true)
+	}
+
+	return nil
+}
+
+// Open serves the model the store already has active, without reconciling it
+// with the configured model, so read-only commands leave the index as it is.
+func (ix *Indexer) Open(ctx context.Context) error {
+	models, err := ix.vectors.Models(ctx)
+	if err != nil {
+		return fmt.Errorf("list embedding models: %w", err)
+	}
+	entry, ok := vectorstore.ActiveModel(models)
+	if !ok {
+		return errors.New("the vector store has no active embedding model; start the server once to set it up")
+	}
+	ix.active = ix.handle(registered(entry))
+	return nil
+}
+
+func (ix *Indexer) handle(model Model) *handle {
+	return &handle{model: model, embedder: ix.newEmbedder(model.Name, model.Dimension)}
+}
+
+// Wait blocks until the background job, if any, has stopped.
+func (ix *Indexer) Wait() {
+	ix.wg.Wait()
+}
+
+// Status returns a snapshot of the models and job progress.
+func (ix *Indexer) Status() Status {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+
+	status := Status{Job: ix.job}
+	if ix.active != nil {
+		model := ix.active.model
+		status.Active = &model
+	}
+	if ix.building != nil {
+		model := ix.building.model
+		status.Building = &model
+	}
+	return status
+}
+
+// ActiveModel returns the model that serves searches.
+func (ix *Indexer) ActiveModel() Model {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	if ix.active == nil {
+		return Model{}
+	}
+	return ix.active.model
+}
+
+// IndexDocument chunks and embeds document for the active model and, during a
+// re-embed, for the model being built. It returns the number of chunks.
+func (ix *Indexer) IndexDocument(ctx context.Context, conversationID string, document storage.Document) (int, error) {
+	text, err := ix.storage.DocumentText(document)
+	if err != nil {
+		return 0, err
+	}
+	return ix.index(ctx, conversationID, document, text)
+}
+
+func (ix *Indexer) index(ctx context.Context, conversationID string, document storage.Document, text string) (int, error) {
+	ix.mu.RLock()
+	handles := []*handle{ix.active, ix.building}
+	ix.mu.RUnlock()
+
+	chunking := chunkDocument(document, text, ix.chunking)
+
+	for _, h := range handles {
+		if h == nil {
+			continue
+		}
+		if err := ix.embedChunks(ctx, h, conversationID, document.ID, chunking); err != nil {
+			return 0, err
+		}
+	}
+	return len(chunking.Contents), nil
+}
+
+// SearchResult holds the chunks a search returned and where its time went.
+// Model is the model that served it; follow-up lookups of the chunks use its
+// Key.
+type SearchResult struct {
+	Model     Model
+	Chunks    []vectorstore.Chunk
+	EmbedTime time.Duration
+	QueryTime time.Duration
+}
+
+// HasSections reports whether any returned chunk belongs to a section.
+func (r SearchResult) HasSections() bool {
+	for _, chunk := range r.Chunks {
+		if chunk.ParentID != uuid.Nil {
+			return true
+		}
+	}
+	return false
+}
+
+// Search embeds query with the active model and returns the closest chunks
+// whose metadata matches filter.
+func (ix *Indexer) Search(ctx context.Context, conversationID, query string, limit int, filter vectorstore.Filter) (SearchResult, error) {
+	ix.mu.RLock()
+	active := ix.active
+	ix.mu.RUnlock()
+	if active == nil {
+		return SearchResult{}, errors.New("indexer not started")
+	}
+	result := SearchResult{Model: active.model}
+
+	started := time.Now()
+	queries, err := active.embedder.Embed(ctx, []string{query})
+	result.EmbedTime = time.Since(started)
+	if err != nil {
+		return result, fmt.Errorf("embed query: %w", err)
+	}
+	if len(queries) == 0 {
+		return result, nil
+	}
+
+	started = time.Now()
+	result.Chunks, err = ix.vectors.QuerySimilar(ctx, active.model.Key, conversationID, queries[0], limit, filter)
+	result.QueryTime = time.Since(started)
+	return result, err
+}
+
+func (ix *Indexer) embedChunks(ctx context.Context, h *handle, conversationID, documentID string, chunking vectorstore.Chunking) error {
+	return vectorstore.RefreshDocument(ctx, ix.vectors, h.model.Key, conversationID, documentID,
+		func() (vectorstore.Chunking, error) { return chunking, nil },
+		h.embedder.Embed,
+	)
+}
@@ -0,0 +1,154 @@
+package indexing
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/fabfab/airplane-chat/internal/embeddings"
+	"github.com/fabfab/airplane-chat/internal/storage"
+	"github.com/fabfab/airplane-chat/internal/vectorstore"
+)
+
+// keywordEmbedder points texts that mention keyword away from all others, so
+// a search for keyword ranks the chunks holding it first.
+type keywordEmbedder struct {
+	keyword   string
+	dimension int
+}
+
+func (e keywordEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	vectors := make([][]float32, len(texts))
+	for i, text := range texts {
+		vector := make([]float32, e.dimension)
+		vector[1] = 1
+		if strings.Contains(text, e.keyword) {
+			vector[0] = 1
+		}
+		vectors[i] = vector
+	}
+	return vectors, nil
+}
+
+func keywordEmbedders(model string, dimension int) embeddings.Embedder {
+	return keywordEmbedder{keyword: "needle", dimension: dimension}
+}
+
+// numberedText returns count distinct six-rune words, with the word at
+// needle replaced by "needle".
+func numberedText(count, needle int) string {
+	var b strings.Builder
+	for i := 0; i < count; i++ {
+		if i == needle {
+			b.WriteString("needle ")
+			continue
+		}
+		fmt.Fprintf(&b, "w%04d ", i)
+	}
+	return b.String()
+}
+
+type testIndex struct {
+	store   *storage.Manager
+	vectors *vectorstore.FileStore
+}
+
+func newTestIndex(t *testing.T) testIndex {
+	t.Helper()
+	store, err := storage.NewManager(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewManager: %v", err)
+	}
+	vectors, err := vectorstore.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileStore: %v", err)
+	}
+	return testIndex{store: store, vectors: vectors}
+}
+
+// start returns a started Indexer for model and waits for its re-embed job.
+func (ti testIndex) start(t *testing.T, model Model, chunking ChunkOptions) *Indexer {
+	t.Helper()
+	ix := New(ti.store, ti.vectors, keywordEmbedders, model, chunking)
+	if err := ix.Start(context.Background()); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	ix.Wait()
+	if job := ix.Status().Job; job.State == JobFailed {
+		t.Fatalf("re-embed job failed: %s", job.Error)
+	}
+	return ix
+}
+
+func (ti testIndex) upload(t *testing.T, ix *Indexer, conversationID, text string) storage.Document {
+	t.Helper()
+	document, err := ti.store.SaveDocument(conversationID, "notes.txt", []byte(text), nil)
+	if err != nil {
+		t.Fatalf("SaveDocument: %v", err)
+	}
+	if _, err := ix.IndexDocument(context.Background(), conversationID, document); err != nil {
+		t.Fatalf("IndexDocument: %v", err)
+	}
+	return document
+}
+
+func TestSearchAfterDimensionChange(t *testing.T) {
+	ti := newTestIndex(t)
+	chunking := ChunkOptions{}
+	text := numberedText(1000, 533)
+
+	before := ti.start(t, Model{Name: "embed", Dimension: 4}, chunking)
+	ti.upload(t, before, "c", text)
+
+	ix := ti.start(t, Model{Name: "embed", Dimension: 8}, chunking)
+	if key := ix.ActiveModel().Key; key != "embed@8" {
+		t.Fatalf("active key = %q, want embed@8", key)
+	}
+
+	result, err := ix.Search(context.Background(), "c", "needle", 1, nil)
+	if err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+	if result.Model.Name != "embed" || result.Model.Key != "embed@8" {
+		t.Errorf("result model = %+v, want embed under embed@8", result.Model)
+	}
+	if len(result.Chunks) != 1 || result.Chunks[0].ChunkIndex != 2 {
+		t.Fatalf("chunks = %+v, want chunk 2", result.Chunks)
+	}
+
+	passages, err := ix.Expand(context.Background(), "c", result, 1)
+	if err != nil {
+		t.Fatalf("Expand: %v", err)
+	}
+	if len(passages) != 1 || passages[0].FirstChunk != 1 || passages[0].LastChunk != 3 {
+		t.Fatalf("passages = %+v, want chunks 1 to 3", passages)
+	}
+	if content := passages[0].Content; !strings.Contains(content, "w0300") || !strings.Contains(content, "w0700") {
+		t.Errorf("passage content = %q, want the neighbouring chunks", content)
+	}
+}
+
+func TestParentsAfterDimensionChange(t *testing.T) {
+	ti := newTestIndex(t)
+	chunking := ChunkOptions{SectionSize: 1200, ChildSize: 300}
+
+	before := ti.start(t, Model{Name: "embed", Dimension: 4}, chunking)
+	ti.upload(t, before, "c", numberedText(1000, 533))
+	ix := ti.start(t, Model{Name: "embed", Dimension: 8}, chunking)
+
+	result, err := ix.Search(context.Background(), "c", "needle", 1, nil)
+	if err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+	passages, err := ix.Parents(context.Background(), "c", result)
+	if err != nil {
+		t.Fatalf("Parents: %v", err)
+	}
+	if len(passages) != 1 || passages[0].Section == nil {
+		t.Fatalf("passages = %+v, want the enclosing section", passages)
+	}
+	if content := passages[0].Content; !strings.Contains(content, "needle") || len(content) <= 300 {
+		t.Errorf("section content = %q, want a section around the hit", content)
+	}
+}
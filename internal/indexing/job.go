@@ -0,0 +1,115 @@
+package indexing
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+)
+
+// launch starts the re-embed job for target. When activate is set, target
+// replaces the active model once every document has been embedded.
+func (ix *Indexer) launch(ctx context.Context, target *handle, activate bool) {
+	ix.mu.Lock()
+	ix.job = JobStatus{State: JobRunning, Target: target.model.Key, StartedAt: time.Now().UTC()}
+	ix.mu.Unlock()
+
+	ix.wg.Add(1)
+	go func() {
+		defer ix.wg.Done()
+		err := ix.backfill(ctx, target)
+		if err == nil && activate {
+			err = ix.activate(ctx, target)
+		}
+		ix.finish(err)
+	}()
+}
+
+// backfill embeds every document that has no chunks for target yet, so an
+// interrupted job resumes where it stopped on the next start.
+func (ix *Indexer) backfill(ctx context.Context, target *handle) error {
+	conversations, err := ix.storage.ListConversations()
+	if err != nil {
+		return fmt.Errorf("list conversations: %w", err)
+	}
+
+	var failed int
+	for _, conversationID := range conversations {
+		documents, err := ix.storage.ListDocuments(conversationID)
+		if err != nil {
+			return fmt.Errorf("list documents of %s: %w", conversationID, err)
+		}
+		ix.update(func(job *JobStatus) { job.Documents += len(documents) })
+
+		for _, document := range documents {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			count, err := ix.vectors.CountDocumentChunks(ctx, target.model.Key, conversationID, document.ID)
+			if err != nil {
+				return err
+			}
+			if count > 0 {
+				ix.update(func(job *JobStatus) { job.Skipped++ })
+				continue
+			}
+
+			text, err := ix.storage.DocumentText(document)
+			if err == nil {
+				err = ix.embedChunks(ctx, target, conversationID, document.ID, chunkDocument(document, text, ix.chunking))
+			}
+			if err != nil {
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+				log.Printf("re-embed document %s with %s failed: %v", document.ID, target.model.Key, err)
+				failed++
+				ix.update(func(job *JobStatus) { job.Failed++ })
+				continue
+			}
+			ix.update(func(job *JobStatus) { job.Embedded++ })
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d documents could not be embedded; restart to retry", failed)
+	}
+	return nil
+}
+
+func (ix *Indexer) activate(ctx context.Context, target *handle) error {
+	if err := ix.vectors.ActivateModel(ctx, target.model.Key); err != nil {
+		return fmt.Errorf("activate %s: %w", target.model.Key, err)
+	}
+
+	ix.mu.Lock()
+	previous := ix.active
+	ix.active = target
+	ix.building = nil
+	ix.mu.Unlock()
+
+	log.Printf("embedding model %s is now active (replaced %s)", target.model.Key, previous.model.Key)
+	return nil
+}
+
+func (ix *Indexer) finish(err error) {
+	ix.update(func(job *JobStatus) {
+		job.FinishedAt = time.Now().UTC()
+		if err != nil {
+			job.State = JobFailed
+			job.Error = err.Error()
+			return
+		}
+		job.State = JobCompleted
+	})
+	if err != nil {
+		log.Printf("re-embed job stopped: %v", err)
+	}
+}
+
+func (ix *Indexer) update(fn func(*JobStatus)) {
+	ix.mu.Lock()
+	fn(&ix.job)
+	ix.mu.Unlock()
+}
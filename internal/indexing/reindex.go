@@ -0,0 +1,93 @@
+package indexing
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/fabfab/airplane-chat/internal/storage"
+)
+
+// ReindexReport summarises a reindex run.
+type ReindexReport struct {
+	Conversations int              `json:"conversations"`
+	Documents     int              `json:"documents"`
+	Chunks        int              `json:"chunks"`
+	Failures      []ReindexFailure `json:"failures,omitempty"`
+}
+
+// ReindexFailure records a document that could not be reindexed.
+type ReindexFailure struct {
+	ConversationID string `json:"conversation_id"`
+	DocumentID     string `json:"document_id"`
+	Error          string `json:"error"`
+}
+
+// ReindexDocument re-extracts the text of a stored document from its original
+// upload and rebuilds its chunks. It returns the number of chunks written.
+func (ix *Indexer) ReindexDocument(ctx context.Context, conversationID, documentID string) (int, error) {
+	document, err := storage.FindDocument(ix.storage, conversationID, documentID)
+	if err != nil {
+		return 0, err
+	}
+	return ix.reindex(ctx, conversationID, document)
+}
+
+// ReindexConversation rebuilds the chunks of every document in a
+// conversation. Failing documents are reported and do not stop the run.
+func (ix *Indexer) ReindexConversation(ctx context.Context, conversationID string) (ReindexReport, error) {
+	var report ReindexReport
+	err := ix.reindexConversation(ctx, conversationID, &report)
+	return report, err
+}
+
+// ReindexAll rebuilds the chunks of every document in every conversation.
+func (ix *Indexer) ReindexAll(ctx context.Context) (ReindexReport, error) {
+	var report ReindexReport
+	conversations, err := ix.storage.ListConversations()
+	if err != nil {
+		return report, fmt.Errorf("list conversations: %w", err)
+	}
+	for _, conversationID := range conversations {
+		if err := ix.reindexConversation(ctx, conversationID, &report); err != nil {
+			return report, err
+		}
+	}
+	return report, nil
+}
+
+func (ix *Indexer) reindexConversation(ctx context.Context, conversationID string, report *ReindexReport) error {
+	documents, err := ix.storage.ListDocuments(conversationID)
+	if err != nil {
+		return fmt.Errorf("list documents of %s: %w", conversationID, err)
+	}
+	report.Conversations++
+
+	for _, document := range documents {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		chunks, err := ix.reindex(ctx, conversationID, document)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			report.Failures = append(report.Failures, ReindexFailure{
+				ConversationID: conversationID,
+				DocumentID:     document.ID,
+				Error:          err.Error(),
+			})
+			continue
+		}
+		report.Documents++
+		report.Chunks += chunks
+	}
+	return nil
+}
+
+func (ix *Indexer) reindex(ctx context.Context, conversationID string, document storage.Document) (int, error) {
+	text, err := storage.ReextractText(document)
+	if err != nil {
+		return 0, err
+	}
+	return ix.index(ctx, conversationID, document, text)
+}
@@ -0,0 +1,96 @@
+// Package llm holds what the chat providers have in common, so storage and
+// configuration do not depend on any one provider's client.
+package llm
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+const (
+	maxNumCtx        = 1 << 20
+	maxSeed          = math.MaxUint32
+	maxStopSequences = 8
+)
+
+// Options are the generation options we expose, named as in Ollama's API and
+// mapped by each provider's client. Nil fields are omitted from the request so
+// the model's defaults apply. A
+// non-nil empty Stop is set: it clears the stop sequences of the layers below.
+type Options struct {
+	Temperature *float64 `json:"temperature,omitempty"`
+	TopP        *float64 `json:"top_p,omitempty"`
+	NumCtx      *int     `json:"num_ctx,omitempty"`
+	Seed        *int     `json:"seed,omitempty"`
+	Stop        []string `json:"stop,omitempty"`
+}
+
+// IsZero reports whether no option has been set.
+func (o Options) IsZero() bool {
+	return o.Temperature == nil && o.TopP == nil && o.NumCtx == nil && o.Seed == nil && o.Stop == nil
+}
+
+// MarshalJSON omits an unset Stop but keeps an empty one, so a stored
+// override that clears the stop sequences survives a round trip.
+func (o Options) MarshalJSON() ([]byte, error) {
+	type plain Options
+	var stop *[]string
+	if o.Stop != nil {
+		stop = &o.Stop
+	}
+	return json.Marshal(struct {
+		plain
+		Stop *[]string `json:"stop,omitempty"`
+	}{plain(o), stop})
+}
+
+// Merge returns a copy of o with every field set in override taking precedence.
+func (o Options) Merge(override Options) Options {
+	merged := o
+	if override.Temperature != nil {
+		merged.Temperature = override.Temperature
+	}
+	if override.TopP != nil {
+		merged.TopP = override.TopP
+	}
+	if override.NumCtx != nil {
+		merged.NumCtx = override.NumCtx
+	}
+	if override.Seed != nil {
+		merged.Seed = override.Seed
+	}
+	if override.Stop != nil {
+		merged.Stop = append([]string{}, override.Stop...)
+	}
+	return merged
+}
+
+// Validate checks the options fall within the ranges the providers accept.
+func (o Options) Validate() error {
+	var errs []error
+	if o.Temperature != nil && (*o.Temperature < 0 || *o.Temperature > 2) {
+		errs = append(errs, fmt.Errorf("temperature must be between 0 and 2, got %g", *o.Temperature))
+	}
+	if o.TopP != nil && (*o.TopP <= 0 || *o.TopP > 1) {
+		errs = append(errs, fmt.Errorf("top_p must be in (0, 1], got %g", *o.TopP))
+	}
+	if o.NumCtx != nil && (*o.NumCtx <= 0 || *o.NumCtx > maxNumCtx) {
+		errs = append(errs, fmt.Errorf("num_ctx must be between 1 and %d, got %d", maxNumCtx, *o.NumCtx))
+	}
+	if o.Seed != nil && (*o.Seed < 0 || int64(*o.Seed) > maxSeed) {
+		errs = append(errs, fmt.Errorf("seed must be between 0 and %d, got %d", maxSeed, *o.Seed))
+	}
+	if len(o.Stop) > maxStopSequences {
+		errs = append(errs, fmt.Errorf("at most %d stop sequences are allowed, got %d", maxStopSequences, len(o.Stop)))
+	}
+	for _, stop := range o.Stop {
+		if strings.TrimSpace(stop) == "" {
+			errs = append(errs, errors.New("stop sequences must not be empty"))
+			break
+		}
+	}
+	return errors.Join(errs...)
+}
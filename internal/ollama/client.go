@@ -1,6 +1,7 @@
 package ollama
 
 import (
+	"bufio"
 	"bytes"
 	"context"
 	"encoding/json"
@@ -9,6 +10,9 @@ import (
 	"net/http"
 	"strings"
 	"time"
+
+	"github.com/fabfab/airplane-chat/internal/llm"
+	"github.com/fabfab/airplane-chat/internal/resilience"
 )
 
 // Message represents a single turn in a chat conversation.
@@ -19,30 +23,41 @@ type Message struct {
 
 // Client provides a minimal chat interface compatible with Ollama's REST API.
 type Client interface {
-	Generate(ctx context.Context, messages []Message) (string, error)
+	Generate(ctx context.Context, messages []Message, opts llm.Options) (string, error)
+}
+
+// StreamingClient is implemented by clients that can deliver the answer
+// incrementally. onDelta is called for every content fragment and the full
+// answer is returned once the stream completes.
+type StreamingClient interface {
+	Client
+	GenerateStream(ctx context.Context, messages []Message, opts llm.Options, onDelta func(string) error) (string, error)
 }
 
 type client struct {
 	host   string
 	model  string
-	client *http.Client
+	client *resilience.Client
 }
 
 // NewClient constructs a Client backed by Ollama's /api/chat endpoint.
-func NewClient(host, model string) Client {
+// Transient failures are retried according to policy; breaker may be shared
+// with other clients of the same Ollama host and may be nil.
+func NewClient(host, model string, policy resilience.Policy, breaker *resilience.Breaker) Client {
 	return &client{
 		host:  strings.TrimRight(host, "/"),
 		model: model,
-		client: &http.Client{
+		client: resilience.NewClient("ollama", &http.Client{
 			Timeout: 180 * time.Second,
-		},
+		}, policy, breaker),
 	}
 }
 
 type chatRequest struct {
-	Model    string    `json:"model"`
-	Messages []Message `json:"messages"`
-	Stream   bool      `json:"stream"`
+	Model    string       `json:"model"`
+	Messages []Message    `json:"messages"`
+	Stream   bool         `json:"stream"`
+	Options  *llm.Options `json:"options,omitempty"`
 }
 
 type chatResponse struct {
@@ -51,53 +66,114 @@ type chatResponse struct {
 	Done    bool    `json:"done"`
 }
 
-func (c *client) Generate(ctx context.Context, messages []Message) (string, error) {
+func (c *client) Generate(ctx context.Context, messages []Message, opts llm.Options) (string, error) {
+	resp, err := c.do(ctx, messages, opts, false)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var parsed chatResponse
+	if err := json.NewDecoder(resp.Body).Decode(&parsed); err != nil {
+		return "", fmt.Errorf("decode response: %w", err)
+	}
+
+	if parsed.Error != "" {
+		return "", fmt.Errorf("ollama error: %s", parsed.Error)
+	}
+
+	return parsed.Message.Content, nil
+}
+
+func (c *client) GenerateStream(ctx context.Context, messages []Message, opts llm.Options, onDelta func(string) error) (string, error) {
+	resp, err := c.do(ctx, messages, opts, true)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	// Ollama streams newline-delimited JSON objects, one per fragment.
+	var answer strings.Builder
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1<<20)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		var event chatResponse
+		if err := json.Unmarshal(line, &event); err != nil {
+			return answer.String(), fmt.Errorf("decode stream event: %w", err)
+		}
+		if event.Error != "" {
+			return answer.String(), fmt.Errorf("ollama error: %s", event.Error)
+		}
+		if event.Message.Content != "" {
+			answer.WriteString(event.Message.Content)
+			if onDelta != nil {
+				if err := onDelta(event.Message.Content); err != nil {
+					return answer.String(), err
+				}
+			}
+		}
+		if event.Done {
+			break
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return answer.String(), fmt.Errorf("read stream: %w", err)
+	}
+
+	return answer.String(), nil
+}
+
+func (c *client) do(ctx context.Context, messages []Message, opts llm.Options, stream bool) (*http.Response, error) {
 	if c.host == "" {
-		return "", fmt.Errorf("ollama host must be configured")
+		return nil, fmt.Errorf("ollama host must be configured")
 	}
 	if c.model == "" {
-		return "", fmt.Errorf("ollama model must be configured")
+		return nil, fmt.Errorf("ollama model must be configured")
 	}
 
 	payload := chatRequest{
 		Model:    c.model,
 		Messages: messages,
-		Stream:   false,
+		Stream:   stream,
+	}
+	// An empty stop list only clears inherited stop sequences; the model's
+	// own still apply.
+	if len(opts.Stop) == 0 {
+		opts.Stop = nil
+	}
+	if !opts.IsZero() {
+		payload.Options = &opts
 	}
 
 	body, err := json.Marshal(payload)
 	if err != nil {
-		return "", fmt.Errorf("marshal request: %w", err)
+		return nil, fmt.Errorf("marshal request: %w", err)
 	}
 
 	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.host+"/api/chat", bytes.NewReader(body))
 	if err != nil {
-		return "", fmt.Errorf("create request: %w", err)
+		return nil, fmt.Errorf("create request: %w", err)
 	}
 	req.Header.Set("Content-Type", "application/json")
 
 	resp, err := c.client.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("execute request: %w", err)
+		return nil, fmt.Errorf("execute request: %w", err)
 	}
-	defer resp.Body.Close()
 
 	if resp.StatusCode >= 400 {
+		defer resp.Body.Close()
 		data, _ := io.ReadAll(resp.Body)
 		if len(data) > 0 {
-			return "", fmt.Errorf("ollama chat API error: %s", string(data))
+			return nil, fmt.Errorf("ollama chat API error: %s", string(data))
 		}
-		return "", fmt.Errorf("ollama chat API returned status %s", resp.Status)
-	}
-
-	var parsed chatResponse
-	if err := json.NewDecoder(resp.Body).Decode(&parsed); err != nil {
-		return "", fmt.Errorf("decode response: %w", err)
+		return nil, fmt.Errorf("ollama chat API returned status %s", resp.Status)
 	}
 
-	if parsed.Error != "" {
-		return "", fmt.Errorf("ollama error: %s", parsed.Error)
-	}
-
-	return parsed.Message.Content, nil
+	return resp, nil
 }
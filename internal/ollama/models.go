@@ -0,0 +1,61 @@
+package ollama
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// ListModels returns the names of the models installed on the Ollama server
+// using /api/tags. It performs a single request with no retries so it is
+// suitable for health checks.
+func ListModels(ctx context.Context, host string) ([]string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimRight(host, "/")+"/api/tags", nil)
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("execute request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		return nil, fmt.Errorf("ollama tags API returned status %s", resp.Status)
+	}
+
+	var payload struct {
+		Models []struct {
+			Name string `json:"name"`
+		} `json:"models"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&payload); err != nil {
+		return nil, fmt.Errorf("decode response: %w", err)
+	}
+
+	names := make([]string, 0, len(payload.Models))
+	for _, model := range payload.Models {
+		names = append(names, model.Name)
+	}
+	return names, nil
+}
+
+// HasModel reports whether model is among installed, treating an untagged
+// name as ":latest" the way Ollama does.
+func HasModel(installed []string, model string) bool {
+	if !strings.Contains(model, ":") {
+		model += ":latest"
+	}
+	for _, name := range installed {
+		if !strings.Contains(name, ":") {
+			name += ":latest"
+		}
+		if name == model {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,196 @@
+package openai
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/fabfab/airplane-chat/internal/llm"
+	"github.com/fabfab/airplane-chat/internal/ollama"
+)
+
+type client struct {
+	baseURL string
+	apiKey  string
+	model   string
+	client  *http.Client
+}
+
+// responseHeaderTimeout bounds how long the server may take to start
+// answering. It does not cover the body, so a long stream is not cut off;
+// callers bound the whole request with its context.
+const responseHeaderTimeout = 180 * time.Second
+
+// NewClient constructs an ollama.Client backed by an OpenAI-compatible
+// /v1/chat/completions endpoint such as llama.cpp server, vLLM or LM Studio.
+// baseURL should include the API prefix, e.g. http://localhost:8000/v1.
+func NewClient(baseURL, apiKey, model string) ollama.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.ResponseHeaderTimeout = responseHeaderTimeout
+	return &client{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		apiKey:  apiKey,
+		model:   model,
+		client:  &http.Client{Transport: transport},
+	}
+}
+
+type chatRequest struct {
+	Model       string           `json:"model"`
+	Messages    []ollama.Message `json:"messages"`
+	Stream      bool             `json:"stream"`
+	Temperature *float64         `json:"temperature,omitempty"`
+	TopP        *float64         `json:"top_p,omitempty"`
+	Seed        *int             `json:"seed,omitempty"`
+	Stop        []string         `json:"stop,omitempty"`
+}
+
+type chatResponse struct {
+	Choices []struct {
+		Message ollama.Message `json:"message"`
+		Delta   struct {
+			Content string `json:"content"`
+		} `json:"delta"`
+		FinishReason *string `json:"finish_reason"`
+	} `json:"choices"`
+	Error *apiError `json:"error"`
+}
+
+type apiError struct {
+	Message string `json:"message"`
+	Type    string `json:"type"`
+}
+
+func (c *client) Generate(ctx context.Context, messages []ollama.Message, opts llm.Options) (string, error) {
+	resp, err := c.do(ctx, messages, opts, false)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var parsed chatResponse
+	if err := json.NewDecoder(resp.Body).Decode(&parsed); err != nil {
+		return "", fmt.Errorf("decode response: %w", err)
+	}
+	if parsed.Error != nil {
+		return "", fmt.Errorf("openai error: %s", parsed.Error.Message)
+	}
+	if len(parsed.Choices) == 0 {
+		return "", errors.New("openai response contained no choices")
+	}
+
+	return parsed.Choices[0].Message.Content, nil
+}
+
+// GenerateStream consumes the server-sent event stream, invoking onDelta for
+// every content fragment, and returns the full concatenated answer.
+func (c *client) GenerateStream(ctx context.Context, messages []ollama.Message, opts llm.Options, onDelta func(string) error) (string, error) {
+	resp, err := c.do(ctx, messages, opts, true)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var answer strings.Builder
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1<<20)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		data, ok := strings.CutPrefix(line, "data:")
+		if !ok {
+			continue
+		}
+		data = strings.TrimSpace(data)
+		if data == "[DONE]" {
+			break
+		}
+
+		var event chatResponse
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			return answer.String(), fmt.Errorf("decode stream event: %w", err)
+		}
+		if event.Error != nil {
+			return answer.String(), fmt.Errorf("openai error: %s", event.Error.Message)
+		}
+		for _, choice := range event.Choices {
+			if choice.Delta.Content == "" {
+				continue
+			}
+			answer.WriteString(choice.Delta.Content)
+			if onDelta != nil {
+				if err := onDelta(choice.Delta.Content); err != nil {
+					return answer.String(), err
+				}
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return answer.String(), fmt.Errorf("read stream: %w", err)
+	}
+
+	return answer.String(), nil
+}
+
+func (c *client) do(ctx context.Context, messages []ollama.Message, opts llm.Options, stream bool) (*http.Response, error) {
+	if c.baseURL == "" {
+		return nil, fmt.Errorf("openai base URL must be configured")
+	}
+	if c.model == "" {
+		return nil, fmt.Errorf("openai model must be configured")
+	}
+
+	// num_ctx has no OpenAI equivalent; context size is fixed by the server.
+	payload := chatRequest{
+		Model:       c.model,
+		Messages:    messages,
+		Stream:      stream,
+		Temperature: opts.Temperature,
+		TopP:        opts.TopP,
+		Seed:        opts.Seed,
+		Stop:        opts.Stop,
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/chat/completions", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if stream {
+		req.Header.Set("Accept", "text/event-stream")
+	}
+	if c.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("execute request: %w", err)
+	}
+
+	if resp.StatusCode >= 400 {
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(resp.Body)
+		var parsed chatResponse
+		if json.Unmarshal(data, &parsed) == nil && parsed.Error != nil {
+			return nil, fmt.Errorf("openai chat API error: %s", parsed.Error.Message)
+		}
+		if len(data) > 0 {
+			return nil, fmt.Errorf("openai chat API error: %s", string(data))
+		}
+		return nil, fmt.Errorf("openai chat API returned status %s", resp.Status)
+	}
+
+	return resp, nil
+}
@@ -0,0 +1,205 @@
+package openai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/fabfab/airplane-chat/internal/llm"
+	"github.com/fabfab/airplane-chat/internal/ollama"
+)
+
+// fakeServer records the last chat request and answers with respond.
+func fakeServer(t *testing.T, respond func(w http.ResponseWriter, r *http.Request)) (*httptest.Server, *map[string]any) {
+	t.Helper()
+	var last map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chat/completions" {
+			t.Errorf("path = %q, want /v1/chat/completions", r.URL.Path)
+		}
+		if got := r.Header.Get("Authorization"); got != "Bearer secret" {
+			t.Errorf("Authorization = %q, want Bearer secret", got)
+		}
+		last = nil
+		if err := json.NewDecoder(r.Body).Decode(&last); err != nil {
+			t.Errorf("decode request: %v", err)
+		}
+		respond(w, r)
+	}))
+	t.Cleanup(server.Close)
+	return server, &last
+}
+
+func TestGenerateMapsRequest(t *testing.T) {
+	server, last := fakeServer(t, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"choices": [{"message": {"role": "assistant", "content": "hello"}, "finish_reason": "stop"}]}`)
+	})
+
+	temperature, topP, numCtx, seed := 0.2, 0.9, 4096, 7
+	opts := llm.Options{Temperature: &temperature, TopP: &topP, NumCtx: &numCtx, Seed: &seed, Stop: []string{"</s>", "###"}}
+	messages := []ollama.Message{{Role: "system", Content: "be brief"}, {Role: "user", Content: "hi"}}
+
+	answer, err := NewClient(server.URL+"/v1/", "secret", "qwen").Generate(context.Background(), messages, opts)
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	if answer != "hello" {
+		t.Errorf("answer = %q, want hello", answer)
+	}
+
+	want := map[string]any{
+		"model":       "qwen",
+		"stream":      false,
+		"temperature": 0.2,
+		"top_p":       0.9,
+		"seed":        float64(7),
+		"stop":        []any{"</s>", "###"},
+		"messages": []any{
+			map[string]any{"role": "system", "content": "be brief"},
+			map[string]any{"role": "user", "content": "hi"},
+		},
+	}
+	if !reflect.DeepEqual(*last, want) {
+		t.Errorf("request = %v\nwant %v", *last, want)
+	}
+}
+
+func TestGenerateOmitsUnsetOptions(t *testing.T) {
+	server, last := fakeServer(t, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"choices": [{"message": {"content": "ok"}}]}`)
+	})
+
+	if _, err := NewClient(server.URL+"/v1", "secret", "qwen").Generate(context.Background(), nil, llm.Options{Stop: []string{}}); err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	for _, key := range []string{"temperature", "top_p", "seed", "stop", "num_ctx"} {
+		if _, ok := (*last)[key]; ok {
+			t.Errorf("request has %q, want it omitted", key)
+		}
+	}
+}
+
+func TestGenerateErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		want   string
+	}{
+		{"error payload", http.StatusBadRequest, `{"error": {"message": "model not loaded", "type": "invalid_request_error"}}`, "model not loaded"},
+		{"plain error body", http.StatusInternalServerError, `upstream crashed`, "upstream crashed"},
+		{"empty error body", http.StatusServiceUnavailable, ``, "503"},
+		{"error with status 200", http.StatusOK, `{"error": {"message": "context overflow"}}`, "context overflow"},
+		{"no choices", http.StatusOK, `{"choices": []}`, "no choices"},
+		{"malformed", http.StatusOK, `{"choices": [`, "decode response"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, _ := fakeServer(t, func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				fmt.Fprint(w, tt.body)
+			})
+			_, err := NewClient(server.URL+"/v1", "secret", "qwen").Generate(context.Background(), nil, llm.Options{})
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error = %v, want it to mention %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestGenerateStream(t *testing.T) {
+	tests := []struct {
+		name    string
+		events  string
+		answer  string
+		deltas  []string
+		wantErr string
+	}{
+		{
+			name: "stops at DONE",
+			events: "data: {\"choices\": [{\"delta\": {\"role\": \"assistant\"}}]}\n\n" +
+				"data: {\"choices\": [{\"delta\": {\"content\": \"Hel\"}}]}\n\n" +
+				": keep-alive comment\n\n" +
+				"data:{\"choices\": [{\"delta\": {\"content\": \"lo\"}, \"finish_reason\": \"stop\"}]}\n\n" +
+				"data: [DONE]\n\n" +
+				"data: {\"choices\": [{\"delta\": {\"content\": \" ignored\"}}]}\n\n",
+			answer: "Hello",
+			deltas: []string{"Hel", "lo"},
+		},
+		{
+			name:   "ends without DONE",
+			events: "data: {\"choices\": [{\"delta\": {\"content\": \"partial\"}}]}\n\n",
+			answer: "partial",
+			deltas: []string{"partial"},
+		},
+		{
+			name: "error event",
+			events: "data: {\"choices\": [{\"delta\": {\"content\": \"Hel\"}}]}\n\n" +
+				"data: {\"error\": {\"message\": \"generation aborted\"}}\n\n",
+			answer:  "Hel",
+			deltas:  []string{"Hel"},
+			wantErr: "generation aborted",
+		},
+		{
+			name:    "malformed event",
+			events:  "data: {not json}\n\n",
+			wantErr: "decode stream event",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, last := fakeServer(t, func(w http.ResponseWriter, r *http.Request) {
+				if got := r.Header.Get("Accept"); got != "text/event-stream" {
+					t.Errorf("Accept = %q, want text/event-stream", got)
+				}
+				w.Header().Set("Content-Type", "text/event-stream")
+				fmt.Fprint(w, tt.events)
+			})
+
+			var deltas []string
+			answer, err := NewClient(server.URL+"/v1", "secret", "qwen").(ollama.StreamingClient).GenerateStream(
+				context.Background(), []ollama.Message{{Role: "user", Content: "hi"}}, llm.Options{},
+				func(delta string) error {
+					deltas = append(deltas, delta)
+					return nil
+				})
+
+			if (*last)["stream"] != true {
+				t.Errorf("stream = %v, want true", (*last)["stream"])
+			}
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("GenerateStream: %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("error = %v, want it to mention %q", err, tt.wantErr)
+			}
+			if answer != tt.answer {
+				t.Errorf("answer = %q, want %q", answer, tt.answer)
+			}
+			if !reflect.DeepEqual(deltas, tt.deltas) {
+				t.Errorf("deltas = %q, want %q", deltas, tt.deltas)
+			}
+		})
+	}
+}
+
+func TestGenerateStreamStopsOnCallbackError(t *testing.T) {
+	server, _ := fakeServer(t, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "data: {\"choices\": [{\"delta\": {\"content\": \"a\"}}]}\n\ndata: {\"choices\": [{\"delta\": {\"content\": \"b\"}}]}\n\n")
+	})
+
+	stop := fmt.Errorf("client went away")
+	answer, err := NewClient(server.URL+"/v1", "secret", "qwen").(ollama.StreamingClient).GenerateStream(
+		context.Background(), nil, llm.Options{}, func(string) error { return stop })
+	if err != stop {
+		t.Errorf("error = %v, want the callback's", err)
+	}
+	if answer != "a" {
+		t.Errorf("answer = %q, want a", answer)
+	}
+}
@@ -0,0 +1,113 @@
+package resilience
+
+import (
+	"sync"
+	"time"
+)
+
+type breakerState int
+
+const (
+	stateClosed breakerState = iota
+	stateOpen
+	stateHalfOpen
+)
+
+// Breaker is a consecutive-failure circuit breaker. After Threshold failures
+// in a row it rejects calls for Cooldown, then lets a single probe through;
+// the probe's outcome closes or re-opens the circuit. A nil *Breaker allows
+// every call.
+type Breaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	mu       sync.Mutex
+	state    breakerState
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+// NewBreaker returns a Breaker, or nil when threshold is not positive.
+func NewBreaker(threshold int, cooldown time.Duration) *Breaker {
+	if threshold <= 0 {
+		return nil
+	}
+	return &Breaker{threshold: threshold, cooldown: cooldown}
+}
+
+// Allow reports whether a call may proceed and, if not, how long until the
+// breaker will admit a probe.
+func (b *Breaker) Allow() (time.Duration, bool) {
+	if b == nil {
+		return 0, true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case stateOpen:
+		remaining := b.cooldown - time.Since(b.openedAt)
+		if remaining > 0 {
+			return remaining, false
+		}
+		b.state = stateHalfOpen
+		b.probing = true
+		return 0, true
+	case stateHalfOpen:
+		if b.probing {
+			return b.cooldown, false
+		}
+		b.probing = true
+		return 0, true
+	default:
+		return 0, true
+	}
+}
+
+// Success records a healthy response and closes the circuit.
+func (b *Breaker) Success() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.state = stateClosed
+	b.failures = 0
+	b.probing = false
+}
+
+// Failure records an upstream failure, opening the circuit once the threshold
+// is reached or immediately if a half-open probe failed.
+func (b *Breaker) Failure() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	b.probing = false
+	if b.state == stateHalfOpen || b.failures >= b.threshold {
+		b.state = stateOpen
+		b.openedAt = time.Now()
+	}
+}
+
+// Release gives back a probe slot without recording an outcome, e.g. when
+// the caller cancelled the request.
+func (b *Breaker) Release() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+}
+
+// Cooldown returns the configured open duration.
+func (b *Breaker) Cooldown() time.Duration {
+	if b == nil {
+		return 0
+	}
+	return b.cooldown
+}
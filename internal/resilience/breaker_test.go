@@ -0,0 +1,81 @@
+package resilience
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBreakerTransitions(t *testing.T) {
+	const cooldown = 30 * time.Millisecond
+	b := NewBreaker(2, cooldown)
+
+	// Closed: failures below the threshold keep admitting calls.
+	b.Failure()
+	if _, ok := b.Allow(); !ok {
+		t.Fatal("closed breaker rejected a call after one failure")
+	}
+
+	// The threshold opens it.
+	b.Failure()
+	wait, ok := b.Allow()
+	if ok {
+		t.Fatal("open breaker admitted a call")
+	}
+	if wait <= 0 || wait > cooldown {
+		t.Errorf("wait = %v, want within (0, %v]", wait, cooldown)
+	}
+
+	// After the cooldown a single probe is admitted.
+	time.Sleep(cooldown)
+	if _, ok := b.Allow(); !ok {
+		t.Fatal("breaker rejected the probe after the cooldown")
+	}
+	if _, ok := b.Allow(); ok {
+		t.Fatal("half-open breaker admitted a second call while probing")
+	}
+
+	// A failed probe re-opens it at once.
+	b.Failure()
+	if _, ok := b.Allow(); ok {
+		t.Fatal("breaker admitted a call after the probe failed")
+	}
+
+	// A successful probe closes it and resets the failure count.
+	time.Sleep(cooldown)
+	if _, ok := b.Allow(); !ok {
+		t.Fatal("breaker rejected the second probe")
+	}
+	b.Success()
+	b.Failure()
+	if _, ok := b.Allow(); !ok {
+		t.Fatal("breaker opened on the first failure after closing")
+	}
+}
+
+func TestBreakerReleaseFreesProbe(t *testing.T) {
+	b := NewBreaker(1, 10*time.Millisecond)
+	b.Failure()
+	time.Sleep(10 * time.Millisecond)
+
+	if _, ok := b.Allow(); !ok {
+		t.Fatal("breaker rejected the probe")
+	}
+	b.Release()
+	if _, ok := b.Allow(); !ok {
+		t.Fatal("released probe slot was not available again")
+	}
+}
+
+func TestNilBreakerAllowsEverything(t *testing.T) {
+	b := NewBreaker(0, time.Minute)
+	if b != nil {
+		t.Fatal("NewBreaker with threshold 0 should return nil")
+	}
+	b.Failure()
+	if _, ok := b.Allow(); !ok {
+		t.Fatal("nil breaker rejected a call")
+	}
+	if b.Cooldown() != 0 {
+		t.Errorf("nil breaker cooldown = %v, want 0", b.Cooldown())
+	}
+}
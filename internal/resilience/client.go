@@ -0,0 +1,193 @@
+// Package resilience wraps outbound HTTP calls with retries, exponential
+// backoff and a circuit breaker so transient upstream failures (a model still
+// loading, a daemon restarting) do not surface as hard errors.
+package resilience
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Policy controls how many times and how quickly a request is retried.
+type Policy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+}
+
+// DefaultPolicy retries three times with delays of roughly 0.5s, 1s and 2s.
+var DefaultPolicy = Policy{
+	MaxAttempts: 4,
+	BaseDelay:   500 * time.Millisecond,
+	MaxDelay:    10 * time.Second,
+}
+
+// ErrCircuitOpen is wrapped by UnavailableError when the breaker rejects a
+// request without contacting the upstream service.
+var ErrCircuitOpen = errors.New("circuit breaker open")
+
+// UnavailableError reports that the upstream service could not be reached or
+// kept answering with retryable statuses. RetryAfter is a hint for clients.
+type UnavailableError struct {
+	Service    string
+	RetryAfter time.Duration
+	Err        error
+}
+
+func (e *UnavailableError) Error() string {
+	return fmt.Sprintf("%s unavailable: %v", e.Service, e.Err)
+}
+
+func (e *UnavailableError) Unwrap() error { return e.Err }
+
+// Client performs HTTP requests with retries and an optional shared breaker.
+type Client struct {
+	service string
+	http    *http.Client
+	policy  Policy
+	breaker *Breaker
+}
+
+// NewClient wraps httpClient. service names the upstream in error messages and
+// breaker may be shared between clients talking to the same host, or nil.
+func NewClient(service string, httpClient *http.Client, policy Policy, breaker *Breaker) *Client {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	if policy.MaxAttempts <= 0 {
+		policy.MaxAttempts = 1
+	}
+	return &Client{
+		service: service,
+		http:    httpClient,
+		policy:  policy,
+		breaker: breaker,
+	}
+}
+
+// Do sends req, retrying transport errors and retryable statuses. Only
+// requests whose body can be replayed are retried (http.NewRequest sets
+// GetBody for in-memory readers); for others the first failure is returned as
+// is, without counting against the breaker. Non-retryable responses,
+// including 4xx, are returned untouched.
+func (c *Client) Do(req *http.Request) (*http.Response, error) {
+	// The breaker counts whole calls, not attempts, so a model that takes a
+	// few retries to load does not trip it on its own.
+	if wait, ok := c.breaker.Allow(); !ok {
+		return nil, &UnavailableError{Service: c.service, RetryAfter: wait, Err: ErrCircuitOpen}
+	}
+
+	var lastErr error
+	var retryAfter time.Duration
+
+	replayable := req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+	for attempt := 0; attempt < c.policy.MaxAttempts; attempt++ {
+		if attempt > 0 {
+			if !replayable {
+				// A single failure of a request that cannot be retried
+				// says little about upstream health.
+				c.breaker.Release()
+				return nil, fmt.Errorf("%s: %w", c.service, lastErr)
+			}
+			if err := sleep(req.Context(), c.backoff(attempt, retryAfter)); err != nil {
+				c.breaker.Release()
+				return nil, err
+			}
+			if req.GetBody != nil {
+				body, err := req.GetBody()
+				if err != nil {
+					c.breaker.Release()
+					return nil, fmt.Errorf("rewind request body: %w", err)
+				}
+				req.Body = body
+			}
+		}
+
+		resp, err := c.http.Do(req)
+		if err != nil {
+			if ctxErr := req.Context().Err(); ctxErr != nil {
+				// The caller gave up; that says nothing about upstream health.
+				c.breaker.Release()
+				return nil, err
+			}
+			lastErr = err
+			retryAfter = 0
+			continue
+		}
+
+		if !retryableStatus(resp.StatusCode) {
+			c.breaker.Success()
+			return resp, nil
+		}
+
+		retryAfter = parseRetryAfter(resp.Header.Get("Retry-After"))
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 4<<10))
+		resp.Body.Close()
+		if msg := strings.TrimSpace(string(data)); msg != "" {
+			lastErr = fmt.Errorf("status %s: %s", resp.Status, msg)
+		} else {
+			lastErr = fmt.Errorf("status %s", resp.Status)
+		}
+	}
+
+	c.breaker.Failure()
+	if retryAfter <= 0 {
+		retryAfter = c.breaker.Cooldown()
+	}
+	return nil, &UnavailableError{Service: c.service, RetryAfter: retryAfter, Err: lastErr}
+}
+
+func (c *Client) backoff(attempt int, retryAfter time.Duration) time.Duration {
+	if retryAfter > 0 {
+		return min(retryAfter, c.policy.MaxDelay)
+	}
+	delay := c.policy.BaseDelay << (attempt - 1)
+	if delay <= 0 || delay > c.policy.MaxDelay {
+		delay = c.policy.MaxDelay
+	}
+	// Full jitter keeps several waiting callers from retrying in lockstep.
+	return delay/2 + rand.N(delay/2+1)
+}
+
+func retryableStatus(code int) bool {
+	switch code {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	default:
+		return false
+	}
+}
+
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return time.Until(at)
+	}
+	return 0
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,190 @@
+package resilience
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var fastPolicy = Policy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: 5 * time.Millisecond}
+
+// statusServer answers with the given statuses in turn, repeating the last.
+func statusServer(t *testing.T, statuses ...int) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(calls.Add(1))
+		status := statuses[min(n, len(statuses))-1]
+		if status == http.StatusServiceUnavailable {
+			w.Header().Set("Retry-After", "7")
+		}
+		w.WriteHeader(status)
+		io.WriteString(w, "loading model")
+	}))
+	t.Cleanup(server.Close)
+	return server, &calls
+}
+
+func TestDoRetriesRetryableStatuses(t *testing.T) {
+	server, calls := statusServer(t, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusOK)
+	breaker := NewBreaker(1, time.Minute)
+	client := NewClient("test", nil, fastPolicy, breaker)
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("Do: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || calls.Load() != 3 {
+		t.Errorf("status %d after %d calls, want 200 after 3", resp.StatusCode, calls.Load())
+	}
+	if _, ok := breaker.Allow(); !ok {
+		t.Error("a call that eventually succeeded tripped the breaker")
+	}
+}
+
+func TestDoReturnsNonRetryableStatuses(t *testing.T) {
+	server, calls := statusServer(t, http.StatusNotFound)
+	req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+	resp, err := NewClient("test", nil, fastPolicy, nil).Do(req)
+	if err != nil {
+		t.Fatalf("Do: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound || calls.Load() != 1 {
+		t.Errorf("status %d after %d calls, want 404 after 1", resp.StatusCode, calls.Load())
+	}
+}
+
+func TestDoGivesUpWithRetryAfter(t *testing.T) {
+	server, calls := statusServer(t, http.StatusServiceUnavailable)
+	breaker := NewBreaker(1, time.Minute)
+	client := NewClient("test", nil, fastPolicy, breaker)
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+	_, err := client.Do(req)
+	var unavailable *UnavailableError
+	if !errors.As(err, &unavailable) {
+		t.Fatalf("error = %v, want UnavailableError", err)
+	}
+	if unavailable.RetryAfter != 7*time.Second {
+		t.Errorf("RetryAfter = %v, want the server's 7s", unavailable.RetryAfter)
+	}
+	if !strings.Contains(err.Error(), "loading model") {
+		t.Errorf("error = %v, want the response body in it", err)
+	}
+	if calls.Load() != int32(fastPolicy.MaxAttempts) {
+		t.Errorf("%d calls, want %d", calls.Load(), fastPolicy.MaxAttempts)
+	}
+
+	// The breaker is now open and rejects without contacting the server.
+	_, err = client.Do(req)
+	if !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("error = %v, want ErrCircuitOpen", err)
+	}
+	if calls.Load() != int32(fastPolicy.MaxAttempts) {
+		t.Error("open breaker let a request through")
+	}
+}
+
+func TestDoReplaysBody(t *testing.T) {
+	var bodies []string
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(data))
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusTooManyRequests)
+		}
+	}))
+	defer server.Close()
+
+	req, _ := http.NewRequest(http.MethodPost, server.URL, strings.NewReader("payload"))
+	resp, err := NewClient("test", nil, fastPolicy, nil).Do(req)
+	if err != nil {
+		t.Fatalf("Do: %v", err)
+	}
+	resp.Body.Close()
+	if len(bodies) != 2 || bodies[0] != "payload" || bodies[1] != "payload" {
+		t.Errorf("bodies = %q, want the payload twice", bodies)
+	}
+}
+
+func TestDoDoesNotRetryUnreplayableBody(t *testing.T) {
+	server, calls := statusServer(t, http.StatusServiceUnavailable)
+	breaker := NewBreaker(1, time.Minute)
+
+	req, _ := http.NewRequest(http.MethodPost, server.URL, io.NopCloser(strings.NewReader("payload")))
+	req.GetBody = nil
+	_, err := NewClient("test", nil, fastPolicy, breaker).Do(req)
+	if err == nil {
+		t.Fatal("Do succeeded, want the upstream error")
+	}
+	var unavailable *UnavailableError
+	if errors.As(err, &unavailable) {
+		t.Errorf("error = %v, want a plain error rather than UnavailableError", err)
+	}
+	if calls.Load() != 1 {
+		t.Errorf("%d calls, want 1", calls.Load())
+	}
+	if _, ok := breaker.Allow(); !ok {
+		t.Error("an unretryable request tripped the breaker")
+	}
+}
+
+func TestDoCancelledDoesNotTripBreaker(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+	breaker := NewBreaker(1, time.Minute)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	if _, err := NewClient("test", nil, fastPolicy, breaker).Do(req); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("error = %v, want the context's", err)
+	}
+	if _, ok := breaker.Allow(); !ok {
+		t.Error("a cancelled request tripped the breaker")
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	client := NewClient("test", nil, Policy{MaxAttempts: 5, BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}, nil)
+
+	if got := client.backoff(1, 3*time.Second); got != time.Second {
+		t.Errorf("backoff with Retry-After 3s = %v, want it capped at MaxDelay 1s", got)
+	}
+	if got := client.backoff(1, 200*time.Millisecond); got != 200*time.Millisecond {
+		t.Errorf("backoff with Retry-After 200ms = %v, want 200ms", got)
+	}
+	for attempt, ceiling := range map[int]time.Duration{1: 100 * time.Millisecond, 2: 200 * time.Millisecond, 3: 400 * time.Millisecond, 10: time.Second} {
+		got := client.backoff(attempt, 0)
+		if got < ceiling/2 || got > ceiling {
+			t.Errorf("backoff(%d) = %v, want within [%v, %v]", attempt, got, ceiling/2, ceiling)
+		}
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	if got := parseRetryAfter("5"); got != 5*time.Second {
+		t.Errorf("seconds: got %v, want 5s", got)
+	}
+	for _, value := range []string{"", "0", "-3", "soon"} {
+		if got := parseRetryAfter(value); got != 0 {
+			t.Errorf("%q: got %v, want 0", value, got)
+		}
+	}
+	at := time.Now().Add(time.Minute).UTC().Format(http.TimeFormat)
+	if got := parseRetryAfter(at); got <= 50*time.Second || got > time.Minute {
+		t.Errorf("HTTP date: got %v, want about a minute", got)
+	}
+}
@@ -0,0 +1,87 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// errGenerating rejects a message while the conversation is still answering
+// the previous one.
+var errGenerating = errors.New("an answer is already being generated in this conversation")
+
+// errNotGenerating answers a cancel when the conversation has nothing to
+// cancel.
+var errNotGenerating = errors.New("no answer is being generated in this conversation")
+
+// generations tracks the answer being generated in each conversation, so a
+// conversation answers one message at a time and its history never
+// interleaves two turns, and so the active answer can be cancelled. Deletes
+// and updates hold the conversation too, so an answer is never stored below
+// a message removed while it was generated.
+type generations struct {
+	mu     sync.Mutex
+	active map[string]context.CancelFunc
+}
+
+// start registers a generation in conversationID and returns its context,
+// which is cancelled with parent or by cancel, and the function that ends
+// it. It fails with errGenerating while another generation or a hold is
+// active.
+func (g *generations) start(parent context.Context, conversationID string) (context.Context, func(), error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if _, ok := g.active[conversationID]; ok {
+		return nil, nil, errGenerating
+	}
+	if g.active == nil {
+		g.active = make(map[string]context.CancelFunc)
+	}
+	ctx, cancel := context.WithCancel(parent)
+	g.active[conversationID] = cancel
+
+	done := func() {
+		g.mu.Lock()
+		delete(g.active, conversationID)
+		g.mu.Unlock()
+		cancel()
+	}
+	return ctx, done, nil
+}
+
+// hold reserves conversationID for a change that must not overlap a
+// generation and returns the function that releases it. It fails with
+// errGenerating while a generation is active. A hold cannot be cancelled.
+func (g *generations) hold(conversationID string) (func(), error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if _, ok := g.active[conversationID]; ok {
+		return nil, errGenerating
+	}
+	if g.active == nil {
+		g.active = make(map[string]context.CancelFunc)
+	}
+	g.active[conversationID] = nil
+
+	return func() {
+		g.mu.Lock()
+		delete(g.active, conversationID)
+		g.mu.Unlock()
+	}, nil
+}
+
+// cancel aborts the active generation of conversationID and reports whether
+// there was one.
+func (g *generations) cancel(conversationID string) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	cancel := g.active[conversationID]
+	if cancel == nil {
+		return false
+	}
+	cancel()
+	return true
+}
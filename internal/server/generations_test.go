@@ -0,0 +1,143 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/fabfab/airplane-chat/internal/config"
+	"github.com/fabfab/airplane-chat/internal/llm"
+	"github.com/fabfab/airplane-chat/internal/ollama"
+	"github.com/fabfab/airplane-chat/internal/storage"
+)
+
+// blockingClient answers only once its context is cancelled, and signals on
+// started when a generation begins.
+type blockingClient struct {
+	started chan struct{}
+}
+
+func (c blockingClient) Generate(ctx context.Context, messages []ollama.Message, opts llm.Options) (string, error) {
+	c.started <- struct{}{}
+	<-ctx.Done()
+	return "", ctx.Err()
+}
+
+func newTestServer(t *testing.T, client ollama.Client) *Server {
+	t.Helper()
+	store, err := storage.NewManager(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewManager: %v", err)
+	}
+	return New(config.Config{}, store, client, nil, nil, nil)
+}
+
+func serve(s *Server, method, path, body string) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	s.ServeHTTP(recorder, httptest.NewRequest(method, path, strings.NewReader(body)))
+	return recorder
+}
+
+func createConversation(t *testing.T, s *Server) string {
+	t.Helper()
+	recorder := serve(s, http.MethodPost, "/api/conversations", "")
+	var created struct {
+		ID string `json:"id"`
+	}
+	if err := json.NewDecoder(recorder.Body).Decode(&created); err != nil {
+		t.Fatalf("decode conversation: %v", err)
+	}
+	return created.ID
+}
+
+func TestCancelGeneration(t *testing.T) {
+	client := blockingClient{started: make(chan struct{}, 1)}
+	s := newTestServer(t, client)
+	id := createConversation(t, s)
+	base := "/api/conversations/" + id
+
+	if got := serve(s, http.MethodPost, base+"/cancel", "").Code; got != http.StatusConflict {
+		t.Errorf("cancel with nothing running = %d, want 409", got)
+	}
+
+	posted := make(chan *httptest.ResponseRecorder, 1)
+	go func() {
+		posted <- serve(s, http.MethodPost, base+"/messages", `{"content": "question"}`)
+	}()
+	<-client.started
+
+	if got := serve(s, http.MethodPost, base+"/messages", `{"content": "again"}`).Code; got != http.StatusConflict {
+		t.Errorf("second message while generating = %d, want 409", got)
+	}
+	history, _ := s.storage.LoadHistory(id)
+	if len(history) != 1 {
+		t.Fatalf("history while generating = %+v, want the question", history)
+	}
+	question := base + "/messages/" + history[0].ID
+	if got := serve(s, http.MethodDelete, question, "").Code; got != http.StatusConflict {
+		t.Errorf("delete while generating = %d, want 409", got)
+	}
+	if got := serve(s, http.MethodPut, question+"/pin", "").Code; got != http.StatusConflict {
+		t.Errorf("pin while generating = %d, want 409", got)
+	}
+
+	if got := serve(s, http.MethodPost, base+"/cancel", "").Code; got != http.StatusOK {
+		t.Errorf("cancel = %d, want 200", got)
+	}
+	recorder := <-posted
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("cancelled message = %d: %s", recorder.Code, recorder.Body)
+	}
+	var answer struct {
+		Message storage.Message `json:"message"`
+	}
+	json.NewDecoder(recorder.Body).Decode(&answer)
+	if !answer.Message.Cancelled || answer.Message.ParentID != history[0].ID {
+		t.Errorf("answer = %+v, want a cancelled reply to the question", answer.Message)
+	}
+
+	if got := serve(s, http.MethodDelete, question, "").Code; got != http.StatusOK {
+		t.Errorf("delete after generating = %d, want 200", got)
+	}
+	if history, _ := s.storage.LoadHistory(id); len(history) != 0 {
+		t.Errorf("history after delete = %+v, want empty", history)
+	}
+}
+
+func TestCancelUnknownConversation(t *testing.T) {
+	s := newTestServer(t, blockingClient{})
+
+	if got := serve(s, http.MethodPost, "/api/conversations/missing/cancel", "").Code; got != http.StatusNotFound {
+		t.Errorf("cancel = %d, want 404", got)
+	}
+	if got := serve(s, http.MethodDelete, "/api/conversations/missing/messages/m", "").Code; got != http.StatusNotFound {
+		t.Errorf("delete = %d, want 404", got)
+	}
+	if got := serve(s, http.MethodPut, "/api/conversations/missing/messages/m/pin", "").Code; got != http.StatusNotFound {
+		t.Errorf("pin = %d, want 404", got)
+	}
+}
+
+func TestHoldBlocksGeneration(t *testing.T) {
+	var g generations
+	release, err := g.hold("c")
+	if err != nil {
+		t.Fatalf("hold: %v", err)
+	}
+	if _, _, err := g.start(context.Background(), "c"); err != errGenerating {
+		t.Errorf("start while held: %v, want errGenerating", err)
+	}
+	if g.cancel("c") {
+		t.Error("cancel reported a hold as a generation")
+	}
+	release()
+
+	_, done, err := g.start(context.Background(), "c")
+	if err != nil {
+		t.Fatalf("start after release: %v", err)
+	}
+	done()
+}
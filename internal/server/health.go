@@ -0,0 +1,129 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/fabfab/airplane-chat/internal/config"
+	"github.com/fabfab/airplane-chat/internal/ollama"
+	"github.com/fabfab/airplane-chat/internal/openai"
+)
+
+const readinessTimeout = 3 * time.Second
+
+// componentStatus is the outcome of a single readiness check.
+type componentStatus struct {
+	Status    string  `json:"status"`
+	LatencyMS float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+type readinessCheck struct {
+	name string
+	run  func(ctx context.Context) error
+}
+
+// handleReady checks every dependency concurrently and answers 503 if any of
+// them failed. /api/health stays a cheap liveness probe.
+func (s *Server) handleReady(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+	defer cancel()
+
+	checks := s.readinessChecks(ctx)
+
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		results = make(map[string]componentStatus, len(checks))
+	)
+	for _, check := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			start := time.Now()
+			err := check.run(ctx)
+			result := componentStatus{
+				Status:    "ok",
+				LatencyMS: float64(time.Since(start).Microseconds()) / 1000,
+			}
+			if err != nil {
+				result.Status = "fail"
+				result.Error = err.Error()
+			}
+			mu.Lock()
+			results[check.name] = result
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	status, code := "ready", http.StatusOK
+	for _, result := range results {
+		if result.Status != "ok" {
+			status, code = "not_ready", http.StatusServiceUnavailable
+			break
+		}
+	}
+
+	writeJSON(w, code, map[string]any{
+		"status":     status,
+		"components": results,
+	})
+}
+
+func (s *Server) readinessChecks(ctx context.Context) []readinessCheck {
+	// The model list is fetched once and shared by the model presence checks.
+	installed := sync.OnceValues(func() ([]string, error) {
+		return ollama.ListModels(ctx, s.cfg.Ollama.Host)
+	})
+	requireModel := func(model string) func(context.Context) error {
+		return func(context.Context) error {
+			names, err := installed()
+			if err != nil {
+				return fmt.Errorf("list ollama models: %w", err)
+			}
+			if !ollama.HasModel(names, model) {
+				return fmt.Errorf("model %q is not installed (run `ollama pull %s`)", model, model)
+			}
+			return nil
+		}
+	}
+
+	checks := []readinessCheck{
+		{name: "data_dir", run: func(context.Context) error { return s.storage.CheckWritable() }},
+		{name: "vector_store", run: func(ctx context.Context) error {
+			if s.vectorStore == nil {
+				return errors.New("vector store not configured")
+			}
+			return s.vectorStore.Ping(ctx)
+		}},
+		{name: "ollama", run: func(context.Context) error {
+			_, err := installed()
+			return err
+		}},
+		{name: "embedding_model", run: requireModel(s.cfg.Embed.Model)},
+	}
+
+	if s.cfg.LLM.Provider == config.ProviderOpenAI {
+		checks = append(checks, readinessCheck{name: "chat_model", run: func(ctx context.Context) error {
+			ids, err := openai.ListModels(ctx, s.cfg.OpenAI.BaseURL, s.cfg.OpenAI.APIKey)
+			if err != nil {
+				return fmt.Errorf("list openai models: %w", err)
+			}
+			for _, id := range ids {
+				if id == s.cfg.OpenAI.Model {
+					return nil
+				}
+			}
+			return fmt.Errorf("model %q is not served by %s", s.cfg.OpenAI.Model, s.cfg.OpenAI.BaseURL)
+		}})
+	} else {
+		checks = append(checks, readinessCheck{name: "chat_model", run: requireModel(s.cfg.Ollama.Model)})
+	}
+
+	return checks
+}
@@ -0,0 +1,171 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/fabfab/airplane-chat/internal/storage"
+)
+
+// errNotAnswer rejects ratings of messages other than answers.
+var errNotAnswer = errors.New("only assistant messages can be rated")
+
+// branchMessage is a message together with the alternative versions at its
+// position, itself included, in the order they were created.
+type branchMessage struct {
+	storage.Message
+	Siblings     int      `json:"siblings"`
+	SiblingIndex int      `json:"sibling_index"`
+	SiblingIDs   []string `json:"sibling_ids"`
+}
+
+func describeMessage(tree *storage.Tree, message storage.Message) branchMessage {
+	siblings := tree.Siblings(message.ID)
+	return branchMessage{
+		Message:      message,
+		Siblings:     len(siblings),
+		SiblingIndex: slices.Index(siblings, message.ID),
+		SiblingIDs:   siblings,
+	}
+}
+
+func (s *Server) handleGetMessage(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	messageID := chi.URLParam(r, "msgId")
+
+	history, err := s.storage.LoadHistory(id)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("load history: %w", err))
+		return
+	}
+	tree := storage.NewTree(history)
+	message, ok := tree.Message(messageID)
+	if !ok {
+		writeError(w, http.StatusNotFound, storage.ErrMessageNotFound)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{"message": describeMessage(tree, message)})
+}
+
+// handleDeleteMessage removes a message and every message below it, such as
+// the answers to a deleted question.
+func (s *Server) handleDeleteMessage(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	messageID := chi.URLParam(r, "msgId")
+
+	release, err := s.generations.hold(id)
+	if err != nil {
+		writeError(w, http.StatusConflict, err)
+		return
+	}
+	defer release()
+
+	removed, err := s.storage.DeleteMessage(id, messageID)
+	if err != nil {
+		if errors.Is(err, storage.ErrMessageNotFound) || errors.Is(err, storage.ErrConversationNotFound) {
+			writeError(w, http.StatusNotFound, err)
+			return
+		}
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("delete message: %w", err))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{"deleted": removed})
+}
+
+func (s *Server) handlePinMessage(w http.ResponseWriter, r *http.Request) {
+	pinned := r.Method != http.MethodDelete
+	s.updateMessage(w, r, func(message *storage.Message) error {
+		message.Pinned = pinned
+		return nil
+	})
+}
+
+// handleRateMessage records a thumbs up or down on an answer, replacing an
+// earlier rating.
+func (s *Server) handleRateMessage(w http.ResponseWriter, r *http.Request) {
+	var rating storage.Rating
+	if err := json.NewDecoder(r.Body).Decode(&rating); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("decode request: %w", err))
+		return
+	}
+	if err := rating.Validate(); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	rating.Comment = strings.TrimSpace(rating.Comment)
+	rating.RatedAt = time.Now().UTC()
+
+	s.updateMessage(w, r, func(message *storage.Message) error {
+		if message.Role != "assistant" {
+			return errNotAnswer
+		}
+		message.Rating = &rating
+		return nil
+	})
+}
+
+func (s *Server) handleDeleteRating(w http.ResponseWriter, r *http.Request) {
+	s.updateMessage(w, r, func(message *storage.Message) error {
+		message.Rating = nil
+		return nil
+	})
+}
+
+// updateMessage applies update to the message named in the URL and responds
+// with the result.
+func (s *Server) updateMessage(w http.ResponseWriter, r *http.Request, update func(*storage.Message) error) {
+	id := chi.URLParam(r, "id")
+	messageID := chi.URLParam(r, "msgId")
+
+	release, err := s.generations.hold(id)
+	if err != nil {
+		writeError(w, http.StatusConflict, err)
+		return
+	}
+	defer release()
+
+	message, err := s.storage.UpdateMessage(id, messageID, update)
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrMessageNotFound), errors.Is(err, storage.ErrConversationNotFound):
+			writeError(w, http.StatusNotFound, err)
+		case errors.Is(err, errNotAnswer):
+			writeError(w, http.StatusBadRequest, err)
+		default:
+			writeError(w, http.StatusInternalServerError, fmt.Errorf("update message: %w", err))
+		}
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{"message": message})
+}
+
+// handleExportRatings streams every rated answer with its question as JSON
+// Lines, oldest rating first, ready to be turned into an evaluation set.
+func (s *Server) handleExportRatings(w http.ResponseWriter, r *http.Request) {
+	ratings, err := storage.Ratings(s.storage)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("collect ratings: %w", err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Content-Disposition", `attachment; filename="ratings.jsonl"`)
+	encoder := json.NewEncoder(w)
+	for _, rating := range ratings {
+		if err := encoder.Encode(rating); err != nil {
+			log.Printf("write ratings failed: %v", err)
+			return
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/fabfab/airplane-chat/internal/llm"
+	"github.com/fabfab/airplane-chat/internal/ollama"
+)
+
+// echoClient answers with the last message it was sent.
+type echoClient struct{}
+
+func (echoClient) Generate(ctx context.Context, messages []ollama.Message, opts llm.Options) (string, error) {
+	return "re: " + messages[len(messages)-1].Content, nil
+}
+
+// branch returns the messages GET lists for path, and a summary with one
+// "role content index/siblings" entry per message.
+func branch(t *testing.T, s *Server, path string) ([]branchMessage, string) {
+	t.Helper()
+	recorder := serve(s, http.MethodGet, path, "")
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("GET %s = %d: %s", path, recorder.Code, recorder.Body)
+	}
+	var listed struct {
+		Messages []branchMessage `json:"messages"`
+	}
+	if err := json.NewDecoder(recorder.Body).Decode(&listed); err != nil {
+		t.Fatalf("decode messages: %v", err)
+	}
+	var lines []string
+	for _, m := range listed.Messages {
+		lines = append(lines, fmt.Sprintf("%s %q %d/%d", m.Role, m.Content, m.SiblingIndex+1, m.Siblings))
+	}
+	return listed.Messages, strings.Join(lines, "; ")
+}
+
+func TestRegenerateAndEditBranch(t *testing.T) {
+	s := newTestServer(t, echoClient{})
+	id := createConversation(t, s)
+	base := "/api/conversations/" + id
+
+	for _, content := range []string{"first", "second"} {
+		if recorder := serve(s, http.MethodPost, base+"/messages", `{"content": "`+content+`"}`); recorder.Code != http.StatusOK {
+			t.Fatalf("post %s = %d: %s", content, recorder.Code, recorder.Body)
+		}
+	}
+	messages, _ := branch(t, s, base+"/messages")
+	if len(messages) != 4 {
+		t.Fatalf("history = %+v, want two turns", messages)
+	}
+	firstQuestion, secondAnswer := messages[0], messages[3]
+
+	if recorder := serve(s, http.MethodPost, base+"/messages/"+secondAnswer.ID+"/regenerate", ""); recorder.Code != http.StatusOK {
+		t.Fatalf("regenerate = %d: %s", recorder.Code, recorder.Body)
+	}
+	_, got := branch(t, s, base+"/messages")
+	want := `user "first" 1/1; assistant "re: first" 1/1; user "second" 1/1; assistant "re: second" 2/2`
+	if got != want {
+		t.Errorf("after regenerate:\n%s\nwant\n%s", got, want)
+	}
+
+	if recorder := serve(s, http.MethodPut, base+"/messages/"+firstQuestion.ID, `{"content": "edited"}`); recorder.Code != http.StatusOK {
+		t.Fatalf("edit = %d: %s", recorder.Code, recorder.Body)
+	}
+	_, got = branch(t, s, base+"/messages")
+	if want := `user "edited" 2/2; assistant "re: edited" 1/1`; got != want {
+		t.Errorf("after edit:\n%s\nwant\n%s", got, want)
+	}
+
+	// The original branch is kept and reachable through the first question,
+	// ending at the answer used last.
+	_, got = branch(t, s, base+"/messages?message="+firstQuestion.ID)
+	if want := `user "first" 1/2; assistant "re: first" 1/1; user "second" 1/1; assistant "re: second" 2/2`; got != want {
+		t.Errorf("original branch:\n%s\nwant\n%s", got, want)
+	}
+	_, got = branch(t, s, base+"/messages?message="+secondAnswer.ID)
+	if want := `user "first" 1/2; assistant "re: first" 1/1; user "second" 1/1; assistant "re: second" 1/2`; got != want {
+		t.Errorf("branch through the regenerated answer:\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestRegenerateAndEditErrors(t *testing.T) {
+	s := newTestServer(t, echoClient{})
+	id := createConversation(t, s)
+	base := "/api/conversations/" + id
+	serve(s, http.MethodPost, base+"/messages", `{"content": "question"}`)
+	messages, _ := branch(t, s, base+"/messages")
+	answer := messages[1]
+
+	tests := []struct {
+		method, path, body string
+		want               int
+	}{
+		{http.MethodPost, base + "/messages/missing/regenerate", "", http.StatusNotFound},
+		{http.MethodPut, base + "/messages/missing", `{"content": "x"}`, http.StatusNotFound},
+		{http.MethodPut, base + "/messages/" + answer.ID, `{"content": "x"}`, http.StatusBadRequest},
+		{http.MethodPut, base + "/messages/" + messages[0].ID, `{"content": " "}`, http.StatusBadRequest},
+		{http.MethodGet, base + "/messages?message=missing", "", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		if got := serve(s, tt.method, tt.path, tt.body).Code; got != tt.want {
+			t.Errorf("%s %s = %d, want %d", tt.method, tt.path, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,343 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/fabfab/airplane-chat/internal/llm"
+	"github.com/fabfab/airplane-chat/internal/ollama"
+)
+
+// conversationHeader selects the conversation whose documents are used for
+// retrieval on the OpenAI-compatible endpoints. Alternatively the model name
+// may carry the conversation as a suffix, e.g. "llama3.1:8b@<conversation-id>".
+const (
+	conversationHeader = "X-Conversation-ID"
+	modelSuffixSep     = "@"
+)
+
+type openAIChatRequest struct {
+	Model       string           `json:"model"`
+	Messages    []ollama.Message `json:"messages"`
+	Stream      bool             `json:"stream"`
+	Temperature *float64         `json:"temperature"`
+	TopP        *float64         `json:"top_p"`
+	Seed        *int             `json:"seed"`
+	Stop        stopSequences    `json:"stop"`
+}
+
+// stopSequences accepts OpenAI's "stop" field as either a string or an array.
+type stopSequences []string
+
+func (s *stopSequences) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		if single != "" {
+			*s = []string{single}
+		}
+		return nil
+	}
+	var many []string
+	if err := json.Unmarshal(data, &many); err != nil {
+		return fmt.Errorf("stop must be a string or an array of strings")
+	}
+	*s = many
+	return nil
+}
+
+type openAIChoice struct {
+	Index        int             `json:"index"`
+	Message      *ollama.Message `json:"message,omitempty"`
+	Delta        *openAIDelta    `json:"delta,omitempty"`
+	FinishReason *string         `json:"finish_reason"`
+}
+
+type openAIDelta struct {
+	Role    string `json:"role,omitempty"`
+	Content string `json:"content,omitempty"`
+}
+
+type openAIChatResponse struct {
+	ID      string         `json:"id"`
+	Object  string         `json:"object"`
+	Created int64          `json:"created"`
+	Model   string         `json:"model"`
+	Choices []openAIChoice `json:"choices"`
+}
+
+type openAIEmbeddingRequest struct {
+	Model string          `json:"model"`
+	Input json.RawMessage `json:"input"`
+}
+
+type openAIEmbedding struct {
+	Object    string    `json:"object"`
+	Index     int       `json:"index"`
+	Embedding []float32 `json:"embedding"`
+}
+
+func (s *Server) handleOpenAIModels(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"object": "list",
+		"data": []map[string]any{
+			{"id": s.cfg.ChatModel(), "object": "model", "owned_by": "airplane-chat"},
+			{"id": s.cfg.Embed.Model, "object": "model", "owned_by": "airplane-chat"},
+		},
+	})
+}
+
+func (s *Server) handleOpenAIChatCompletions(w http.ResponseWriter, r *http.Request) {
+	var payload openAIChatRequest
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		writeOpenAIError(w, http.StatusBadRequest, fmt.Errorf("decode request: %w", err))
+		return
+	}
+	if len(payload.Messages) == 0 {
+		writeOpenAIError(w, http.StatusBadRequest, errors.New("messages must not be empty"))
+		return
+	}
+
+	model, conversationID := splitModelConversation(payload.Model)
+	if header := strings.TrimSpace(r.Header.Get(conversationHeader)); header != "" {
+		conversationID = header
+	}
+	if model == "" {
+		model = s.cfg.ChatModel()
+	}
+	if conversationID != "" {
+		if status, err := s.checkConversation(conversationID); err != nil {
+			writeOpenAIError(w, status, err)
+			return
+		}
+	}
+
+	options := s.cfg.Ollama.Options.Merge(llm.Options{
+		Temperature: payload.Temperature,
+		TopP:        payload.TopP,
+		Seed:        payload.Seed,
+		Stop:        payload.Stop,
+	})
+	if err := options.Validate(); err != nil {
+		writeOpenAIError(w, http.StatusBadRequest, fmt.Errorf("invalid options: %w", err))
+		return
+	}
+
+	messages := payload.Messages
+	if conversationID != "" {
+		if query := lastUserMessage(messages); query != "" {
+			snippets, _ := s.retrieveSnippets(r.Context(), conversationID, query, nil, s.cfg.Database.SearchNeighbors)
+			messages = withSnippets(messages, snippets)
+		}
+	}
+
+	id := "chatcmpl-" + uuid.NewString()
+	created := time.Now().Unix()
+	stop := "stop"
+
+	if payload.Stream {
+		s.streamOpenAIChat(w, r, messages, options, openAIChatResponse{
+			ID:      id,
+			Object:  "chat.completion.chunk",
+			Created: created,
+			Model:   model,
+		})
+		return
+	}
+
+	answer, err := s.llm.Generate(r.Context(), messages, options)
+	if err != nil {
+		writeOpenAIError(w, upstreamStatus(w, err), fmt.Errorf("generate response: %w", err))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, openAIChatResponse{
+		ID:      id,
+		Object:  "chat.completion",
+		Created: created,
+		Model:   model,
+		Choices: []openAIChoice{{
+			Message:      &ollama.Message{Role: "assistant", Content: answer},
+			FinishReason: &stop,
+		}},
+	})
+}
+
+func (s *Server) streamOpenAIChat(w http.ResponseWriter, r *http.Request, messages []ollama.Message, options llm.Options, envelope openAIChatResponse) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeOpenAIError(w, http.StatusInternalServerError, errors.New("streaming unsupported by response writer"))
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	send := func(choice openAIChoice) error {
+		envelope.Choices = []openAIChoice{choice}
+		data, err := json.Marshal(envelope)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "data: %s\n\n", data); err != nil {
+			return err
+		}
+		flusher.Flush()
+		return nil
+	}
+
+	role := "assistant"
+	onDelta := func(delta string) error {
+		// Like OpenAI, announce the role only on the first fragment.
+		err := send(openAIChoice{Delta: &openAIDelta{Role: role, Content: delta}})
+		role = ""
+		return err
+	}
+
+	var err error
+	if streamer, ok := s.llm.(ollama.StreamingClient); ok {
+		_, err = streamer.GenerateStream(r.Context(), messages, options, onDelta)
+	} else {
+		var answer string
+		if answer, err = s.llm.Generate(r.Context(), messages, options); err == nil {
+			err = onDelta(answer)
+		}
+	}
+	if err != nil {
+		// Headers are already sent, so report the failure in-band.
+		log.Printf("openai stream failed: %v", err)
+		data, _ := json.Marshal(map[string]any{"error": map[string]string{"message": err.Error(), "type": "server_error"}})
+		fmt.Fprintf(w, "data: %s\n\n", data)
+		flusher.Flush()
+		return
+	}
+
+	stop := "stop"
+	if err := send(openAIChoice{Delta: &openAIDelta{}, FinishReason: &stop}); err != nil {
+		log.Printf("openai stream failed: %v", err)
+		return
+	}
+	fmt.Fprint(w, "data: [DONE]\n\n")
+	flusher.Flush()
+}
+
+func (s *Server) handleOpenAIEmbeddings(w http.ResponseWriter, r *http.Request) {
+	if s.embedder == nil {
+		writeOpenAIError(w, http.StatusServiceUnavailable, errors.New("embeddings are not configured"))
+		return
+	}
+
+	var payload openAIEmbeddingRequest
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		writeOpenAIError(w, http.StatusBadRequest, fmt.Errorf("decode request: %w", err))
+		return
+	}
+
+	var inputs []string
+	var single string
+	if err := json.Unmarshal(payload.Input, &single); err == nil {
+		inputs = []string{single}
+	} else if err := json.Unmarshal(payload.Input, &inputs); err != nil {
+		writeOpenAIError(w, http.StatusBadRequest, errors.New("input must be a string or an array of strings"))
+		return
+	}
+	if len(inputs) == 0 {
+		writeOpenAIError(w, http.StatusBadRequest, errors.New("input must not be empty"))
+		return
+	}
+
+	vectors, err := s.embedder.Embed(r.Context(), inputs)
+	if err != nil {
+		writeOpenAIError(w, upstreamStatus(w, err), fmt.Errorf("embed input: %w", err))
+		return
+	}
+
+	data := make([]openAIEmbedding, len(vectors))
+	for i, vec := range vectors {
+		data[i] = openAIEmbedding{Object: "embedding", Index: i, Embedding: vec}
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"object": "list",
+		"model":  s.cfg.Embed.Model,
+		"data":   data,
+	})
+}
+
+// checkConversation verifies that a conversation ID taken from a header or a
+// model suffix is well formed and names an existing conversation, since it
+// ends up in file paths of the vector store. It returns the status to answer
+// with otherwise.
+func (s *Server) checkConversation(id string) (int, error) {
+	if strings.ContainsAny(id, `/\`) || strings.Contains(id, "..") {
+		return http.StatusBadRequest, fmt.Errorf("invalid conversation id %q", id)
+	}
+	ids, err := s.storage.ListConversations()
+	if err != nil {
+		return http.StatusInternalServerError, fmt.Errorf("list conversations: %w", err)
+	}
+	if !slices.Contains(ids, id) {
+		return http.StatusNotFound, fmt.Errorf("conversation %q not found", id)
+	}
+	return http.StatusOK, nil
+}
+
+// splitModelConversation separates an optional "@<conversation-id>" suffix
+// from the requested model name.
+func splitModelConversation(model string) (string, string) {
+	idx := strings.LastIndex(model, modelSuffixSep)
+	if idx < 0 {
+		return model, ""
+	}
+	return model[:idx], model[idx+len(modelSuffixSep):]
+}
+
+func lastUserMessage(messages []ollama.Message) string {
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role == "user" {
+			return strings.TrimSpace(messages[i].Content)
+		}
+	}
+	return ""
+}
+
+// withSnippets injects retrieved snippets into the caller's system prompt, or
+// prepends one if the request has none.
+func withSnippets(messages []ollama.Message, snippets []string) []ollama.Message {
+	if len(snippets) == 0 {
+		return messages
+	}
+
+	augmented := append([]ollama.Message(nil), messages...)
+	if augmented[0].Role == "system" {
+		augmented[0].Content += "\n\n" + strings.TrimSpace(snippetInstructions(snippets))
+		return augmented
+	}
+
+	return append([]ollama.Message{{
+		Role:    "system",
+		Content: "You are a helpful assistant." + snippetInstructions(snippets),
+	}}, augmented...)
+}
+
+func writeOpenAIError(w http.ResponseWriter, status int, err error) {
+	kind := "invalid_request_error"
+	if status >= 500 {
+		kind = "server_error"
+	}
+	writeJSON(w, status, map[string]any{
+		"error": map[string]string{
+			"message": err.Error(),
+			"type":    kind,
+		},
+	})
+}
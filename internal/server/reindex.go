@@ -0,0 +1,120 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/fabfab/airplane-chat/internal/storage"
+	"github.com/fabfab/airplane-chat/internal/vectorstore"
+)
+
+// handleReindexDocument re-extracts a document's text from the stored original
+// and rebuilds its chunks, picking up chunker and extractor changes.
+func (s *Server) handleReindexDocument(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	docID := chi.URLParam(r, "docId")
+	if id == "" || docID == "" {
+		writeError(w, http.StatusBadRequest, errors.New("missing conversation or document id"))
+		return
+	}
+	if s.indexer == nil {
+		writeError(w, http.StatusServiceUnavailable, errors.New("indexing disabled"))
+		return
+	}
+
+	chunks, err := s.indexer.ReindexDocument(r.Context(), id, docID)
+	if err != nil {
+		if errors.Is(err, storage.ErrDocumentNotFound) {
+			writeError(w, http.StatusNotFound, err)
+			return
+		}
+		result := indexingFailure(err)
+		status := http.StatusInternalServerError
+		if result.Code != "error" {
+			status = upstreamStatus(w, err)
+		}
+		writeJSON(w, status, result)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, indexingResult{Status: "indexed", Chunks: chunks})
+}
+
+func (s *Server) handleReindexConversation(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		writeError(w, http.StatusBadRequest, errors.New("missing conversation id"))
+		return
+	}
+	if s.indexer == nil {
+		writeError(w, http.StatusServiceUnavailable, errors.New("indexing disabled"))
+		return
+	}
+
+	report, err := s.indexer.ReindexConversation(r.Context(), id)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("reindex conversation: %w", err))
+		return
+	}
+	writeJSON(w, http.StatusOK, report)
+}
+
+func (s *Server) handleReindexAll(w http.ResponseWriter, r *http.Request) {
+	if s.indexer == nil {
+		writeError(w, http.StatusServiceUnavailable, errors.New("indexing disabled"))
+		return
+	}
+
+	report, err := s.indexer.ReindexAll(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("reindex: %w", err))
+		return
+	}
+	writeJSON(w, http.StatusOK, report)
+}
+
+// handleFsck reports drift between stored documents and the vector store.
+// POST repairs it by reindexing unindexed documents and deleting orphans.
+func (s *Server) handleFsck(w http.ResponseWriter, r *http.Request) {
+	if s.indexer == nil {
+		writeError(w, http.StatusServiceUnavailable, errors.New("indexing disabled"))
+		return
+	}
+
+	report, err := s.indexer.Check(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("check index: %w", err))
+		return
+	}
+
+	if r.Method == http.MethodPost {
+		repair, err := s.indexer.Repair(r.Context(), report)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, fmt.Errorf("repair index: %w", err))
+			return
+		}
+		report.Repair = &repair
+	}
+
+	writeJSON(w, http.StatusOK, report)
+}
+
+// handleRebuildIndex rebuilds the active model's vector index, which keeps
+// IVF centroids representative after bulk loads.
+func (s *Server) handleRebuildIndex(w http.ResponseWriter, r *http.Request) {
+	rebuilder, ok := s.vectorStore.(vectorstore.IndexRebuilder)
+	if !ok || s.indexer == nil {
+		writeError(w, http.StatusNotImplemented, errors.New("vector backend has no index to rebuild"))
+		return
+	}
+
+	info, err := rebuilder.RebuildIndex(r.Context(), s.indexer.ActiveModel().Key)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("rebuild index: %w", err))
+		return
+	}
+	writeJSON(w, http.StatusOK, info)
+}
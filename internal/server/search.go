@@ -0,0 +1,134 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/fabfab/airplane-chat/internal/vectorstore"
+)
+
+type searchHit struct {
+	Rank         int                  `json:"rank"`
+	Score        float32              `json:"score"`
+	ChunkID      string               `json:"chunk_id"`
+	DocumentID   string               `json:"document_id"`
+	DocumentName string               `json:"document_name"`
+	ChunkIndex   int                  `json:"chunk_index"`
+	Content      string               `json:"content"`
+	Metadata     vectorstore.Metadata `json:"metadata,omitempty"`
+}
+
+type searchTimings struct {
+	EmbedMS float64 `json:"embed_ms"`
+	QueryMS float64 `json:"query_ms"`
+	TotalMS float64 `json:"total_ms"`
+}
+
+// handleSearch runs the retrieval step of a chat turn on its own and returns
+// the ranked chunks, so bad answers can be traced to bad retrieval.
+func (s *Server) handleSearch(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		writeError(w, http.StatusBadRequest, errors.New("missing conversation id"))
+		return
+	}
+	if s.indexer == nil {
+		writeError(w, http.StatusServiceUnavailable, errors.New("indexing disabled"))
+		return
+	}
+
+	var payload struct {
+		Query     string `json:"query"`
+		Limit     int    `json:"limit"`
+		Filter    string `json:"filter"`
+		Neighbors int    `json:"neighbors"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("decode request: %w", err))
+		return
+	}
+	payload.Query = strings.TrimSpace(payload.Query)
+	if payload.Query == "" {
+		writeError(w, http.StatusBadRequest, errors.New("query must not be empty"))
+		return
+	}
+	if payload.Limit <= 0 {
+		payload.Limit = s.cfg.Database.SearchTopK
+	}
+	if payload.Limit > 100 {
+		writeError(w, http.StatusBadRequest, errors.New("limit must be at most 100"))
+		return
+	}
+
+	if payload.Neighbors < 0 || payload.Neighbors > maxNeighbors {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("neighbors must be between 0 and %d", maxNeighbors))
+		return
+	}
+
+	filter, err := vectorstore.ParseFilter(payload.Filter)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid filter: %w", err))
+		return
+	}
+
+	started := time.Now()
+	result, err := s.indexer.Search(r.Context(), id, payload.Query, payload.Limit, filter)
+	if err != nil {
+		writeError(w, upstreamStatus(w, err), fmt.Errorf("search: %w", err))
+		return
+	}
+	total := time.Since(started)
+
+	names := map[string]string{}
+	if documents, err := s.storage.ListDocuments(id); err == nil {
+		for _, doc := range documents {
+			names[doc.ID] = doc.Name
+		}
+	}
+
+	hits := make([]searchHit, len(result.Chunks))
+	for i, chunk := range result.Chunks {
+		hits[i] = searchHit{
+			Rank:         i + 1,
+			Score:        chunk.Score,
+			ChunkID:      chunk.ID.String(),
+			DocumentID:   chunk.DocumentID,
+			DocumentName: names[chunk.DocumentID],
+			ChunkIndex:   chunk.ChunkIndex,
+			Content:      chunk.Content,
+			Metadata:     chunk.Metadata,
+		}
+	}
+
+	response := map[string]any{
+		"query":   payload.Query,
+		"model":   result.Model.Name,
+		"filter":  filter,
+		"results": hits,
+		"timings": searchTimings{
+			EmbedMS: milliseconds(result.EmbedTime),
+			QueryMS: milliseconds(result.QueryTime),
+			TotalMS: milliseconds(total),
+		},
+	}
+	passages, err := s.indexer.Passages(r.Context(), id, result, payload.Neighbors)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("expand results: %w", err))
+		return
+	}
+	if passages != nil {
+		response["passages"] = passages
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
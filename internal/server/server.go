@@ -7,9 +7,13 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"math"
 	"net/http"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
@@ -18,7 +22,10 @@ import (
 
 	"github.com/fabfab/airplane-chat/internal/config"
 	"github.com/fabfab/airplane-chat/internal/embeddings"
+	"github.com/fabfab/airplane-chat/internal/indexing"
+	"github.com/fabfab/airplane-chat/internal/llm"
 	"github.com/fabfab/airplane-chat/internal/ollama"
+	"github.com/fabfab/airplane-chat/internal/resilience"
 	"github.com/fabfab/airplane-chat/internal/storage"
 	"github.com/fabfab/airplane-chat/internal/vectorstore"
 )
@@ -27,14 +34,16 @@ import (
 type Server struct {
 	cfg         config.Config
 	router      http.Handler
-	storage     *storage.Manager
+	storage     storage.Store
 	llm         ollama.Client
 	embedder    embeddings.Embedder
-	vectorStore *vectorstore.Store
+	vectorStore vectorstore.VectorStore
+	indexer     *indexing.Indexer
+	generations generations
 }
 
 // New constructs a Server with the provided dependencies.
-func New(cfg config.Config, store *storage.Manager, llmClient ollama.Client, embedder embeddings.Embedder, vectors *vectorstore.Store) *Server {
+func New(cfg config.Config, store storage.Store, llmClient ollama.Client, embedder embeddings.Embedder, vectors vectorstore.VectorStore, indexer *indexing.Indexer) *Server {
 	mux := chi.NewRouter()
 	mux.Use(middleware.RequestID)
 	mux.Use(middleware.RealIP)
@@ -42,8 +51,8 @@ func New(cfg config.Config, store *storage.Manager, llmClient ollama.Client, emb
 	mux.Use(middleware.Recoverer)
 	mux.Use(cors.Handler(cors.Options{
 		AllowedOrigins:   []string{"http://localhost:5173", "http://127.0.0.1:5173"},
-		AllowedMethods:   []string{http.MethodGet, http.MethodPost, http.MethodOptions},
-		AllowedHeaders:   []string{"Accept", "Content-Type", "X-CSRF-Token"},
+		AllowedMethods:   []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodDelete, http.MethodOptions},
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", conversationHeader},
 		AllowCredentials: true,
 		MaxAge:           300,
 	}))
@@ -55,14 +64,40 @@ func New(cfg config.Config, store *storage.Manager, llmClient ollama.Client, emb
 		llm:         llmClient,
 		embedder:    embedder,
 		vectorStore: vectors,
+		indexer:     indexer,
 	}
 
 	mux.Get("/api/health", s.handleHealth)
+	mux.Get("/api/health/ready", s.handleReady)
 	mux.Post("/api/conversations", s.handleCreateConversation)
 	mux.Get("/api/conversations/{id}/messages", s.handleGetMessages)
 	mux.Post("/api/conversations/{id}/messages", s.handlePostMessage)
+	mux.Post("/api/conversations/{id}/cancel", s.handleCancel)
+	mux.Get("/api/conversations/{id}/messages/{msgId}", s.handleGetMessage)
+	mux.Put("/api/conversations/{id}/messages/{msgId}", s.handleEditMessage)
+	mux.Delete("/api/conversations/{id}/messages/{msgId}", s.handleDeleteMessage)
+	mux.Post("/api/conversations/{id}/messages/{msgId}/regenerate", s.handleRegenerateMessage)
+	mux.Put("/api/conversations/{id}/messages/{msgId}/pin", s.handlePinMessage)
+	mux.Delete("/api/conversations/{id}/messages/{msgId}/pin", s.handlePinMessage)
+	mux.Put("/api/conversations/{id}/messages/{msgId}/rating", s.handleRateMessage)
+	mux.Delete("/api/conversations/{id}/messages/{msgId}/rating", s.handleDeleteRating)
+	mux.Get("/api/conversations/{id}/settings", s.handleGetSettings)
+	mux.Put("/api/conversations/{id}/settings", s.handlePutSettings)
 	mux.Get("/api/conversations/{id}/documents", s.handleListDocuments)
 	mux.Post("/api/conversations/{id}/documents", s.handleUploadDocument)
+	mux.Post("/api/conversations/{id}/search", s.handleSearch)
+	mux.Post("/api/conversations/{id}/documents/{docId}/reindex", s.handleReindexDocument)
+	mux.Post("/api/conversations/{id}/reindex", s.handleReindexConversation)
+	mux.Post("/api/reindex", s.handleReindexAll)
+	mux.Get("/api/embeddings/status", s.handleEmbeddingStatus)
+	mux.Get("/api/ratings", s.handleExportRatings)
+	mux.Get("/api/admin/fsck", s.handleFsck)
+	mux.Post("/api/admin/fsck", s.handleFsck)
+	mux.Post("/api/admin/index/rebuild", s.handleRebuildIndex)
+
+	mux.Get("/v1/models", s.handleOpenAIModels)
+	mux.Post("/v1/chat/completions", s.handleOpenAIChatCompletions)
+	mux.Post("/v1/embeddings", s.handleOpenAIEmbeddings)
 
 	return s
 }
@@ -98,7 +133,88 @@ func (s *Server) handleGetMessages(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	writeJSON(w, http.StatusOK, map[string]any{"messages": history})
+	tree := storage.NewTree(history)
+	if pinned, _ := strconv.ParseBool(r.URL.Query().Get("pinned")); pinned {
+		messages := []branchMessage{}
+		for _, message := range history {
+			if message.Pinned {
+				messages = append(messages, describeMessage(tree, message))
+			}
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"messages": messages})
+		return
+	}
+
+	// By default the branch that was used last; ?message= selects the
+	// branch through another message, such as a sibling.
+	through := r.URL.Query().Get("message")
+	if _, ok := tree.Message(through); through != "" && !ok {
+		writeError(w, http.StatusNotFound, storage.ErrMessageNotFound)
+		return
+	}
+
+	branch := tree.Branch(tree.Latest(through))
+	messages := make([]branchMessage, 0, len(branch))
+	for _, message := range branch {
+		messages = append(messages, describeMessage(tree, message))
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{"messages": messages})
+}
+
+// turnRequest is the payload of the endpoints that generate an answer.
+type turnRequest struct {
+	Content string       `json:"content"`
+	Options *llm.Options `json:"options"`
+	Filter  string       `json:"filter"`
+	// Neighbors overrides RETRIEVAL_NEIGHBORS for this turn.
+	Neighbors *int `json:"neighbors"`
+	// ReturnPrompt adds the exact messages and options sent to the model
+	// to the response.
+	ReturnPrompt bool `json:"return_prompt"`
+	// ParentID continues the branch ending at this message instead of the
+	// one used last.
+	ParentID string `json:"parent_id"`
+}
+
+// turn is a validated turnRequest.
+type turn struct {
+	filter       vectorstore.Filter
+	neighbors    int
+	options      llm.Options
+	returnPrompt bool
+}
+
+// parseTurn validates payload against the conversation settings. On failure
+// it writes the error response and returns false.
+func (s *Server) parseTurn(w http.ResponseWriter, conversationID string, payload turnRequest) (turn, bool) {
+	filter, err := vectorstore.ParseFilter(payload.Filter)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid filter: %w", err))
+		return turn{}, false
+	}
+
+	neighbors := s.cfg.Database.SearchNeighbors
+	if payload.Neighbors != nil {
+		neighbors = *payload.Neighbors
+	}
+	if neighbors < 0 || neighbors > maxNeighbors {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("neighbors must be between 0 and %d", maxNeighbors))
+		return turn{}, false
+	}
+
+	options, err := s.generationOptions(conversationID, payload.Options)
+	if err != nil {
+		var invalid *invalidOptionsError
+		if errors.As(err, &invalid) {
+			writeError(w, http.StatusBadRequest, err)
+			return turn{}, false
+		}
+		writeError(w, http.StatusInternalServerError, err)
+		return turn{}, false
+	}
+
+	return turn{filter: filter, neighbors: neighbors, options: options, returnPrompt: payload.ReturnPrompt}, true
 }
 
 func (s *Server) handlePostMessage(w http.ResponseWriter, r *http.Request) {
@@ -108,10 +224,105 @@ func (s *Server) handlePostMessage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var payload struct {
-		Content string `json:"content"`
+	var payload turnRequest
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("decode request: %w", err))
+		return
+	}
+
+	payload.Content = strings.TrimSpace(payload.Content)
+	if payload.Content == "" {
+		writeError(w, http.StatusBadRequest, errors.New("content must not be empty"))
+		return
+	}
+
+	t, ok := s.parseTurn(w, id, payload)
+	if !ok {
+		return
+	}
+
+	ctx, done, err := s.generations.start(r.Context(), id)
+	if err != nil {
+		writeError(w, http.StatusConflict, err)
+		return
 	}
+	defer done()
 
+	history, err := s.storage.LoadHistory(id)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("load history: %w", err))
+		return
+	}
+	tree := storage.NewTree(history)
+	parentID := payload.ParentID
+	if parentID == "" {
+		parentID = tree.Latest("")
+	} else if _, ok := tree.Message(parentID); !ok {
+		writeError(w, http.StatusNotFound, storage.ErrMessageNotFound)
+		return
+	}
+
+	s.answer(ctx, w, id, tree.Branch(parentID), payload.Content, t)
+}
+
+// handleRegenerateMessage answers a user message again. For an assistant
+// message it answers the user message before it, adding a sibling of the
+// regenerated answer.
+func (s *Server) handleRegenerateMessage(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	messageID := chi.URLParam(r, "msgId")
+
+	// The body is optional; without one the conversation settings apply.
+	var payload turnRequest
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil && !errors.Is(err, io.EOF) {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("decode request: %w", err))
+		return
+	}
+
+	t, ok := s.parseTurn(w, id, payload)
+	if !ok {
+		return
+	}
+
+	ctx, done, err := s.generations.start(r.Context(), id)
+	if err != nil {
+		writeError(w, http.StatusConflict, err)
+		return
+	}
+	defer done()
+
+	history, err := s.storage.LoadHistory(id)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("load history: %w", err))
+		return
+	}
+	tree := storage.NewTree(history)
+	message, ok := tree.Message(messageID)
+	if !ok {
+		writeError(w, http.StatusNotFound, storage.ErrMessageNotFound)
+		return
+	}
+	if message.Role == "assistant" {
+		if message, ok = tree.Message(message.ParentID); !ok || message.Role != "user" {
+			writeError(w, http.StatusBadRequest, errors.New("message does not answer a user message"))
+			return
+		}
+	}
+	if message.Role != "user" {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("cannot regenerate a %s message", message.Role))
+		return
+	}
+
+	s.generate(ctx, w, id, tree.Branch(message.ID), t, nil)
+}
+
+// handleEditMessage replaces a user message with new content on a new branch
+// and answers it. The original message and its answers are kept.
+func (s *Server) handleEditMessage(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	messageID := chi.URLParam(r, "msgId")
+
+	var payload turnRequest
 	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
 		writeError(w, http.StatusBadRequest, fmt.Errorf("decode request: %w", err))
 		return
@@ -123,50 +334,81 @@ func (s *Server) handlePostMessage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	userMessage := storage.Message{
-		Role:      "user",
-		Content:   payload.Content,
-		Timestamp: time.Now().UTC(),
+	t, ok := s.parseTurn(w, id, payload)
+	if !ok {
+		return
 	}
 
-	if err := s.storage.AppendMessage(id, userMessage); err != nil {
-		writeError(w, http.StatusInternalServerError, fmt.Errorf("store user message: %w", err))
+	ctx, done, err := s.generations.start(r.Context(), id)
+	if err != nil {
+		writeError(w, http.StatusConflict, err)
 		return
 	}
+	defer done()
 
 	history, err := s.storage.LoadHistory(id)
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, fmt.Errorf("load history: %w", err))
 		return
 	}
+	tree := storage.NewTree(history)
+	message, ok := tree.Message(messageID)
+	if !ok {
+		writeError(w, http.StatusNotFound, storage.ErrMessageNotFound)
+		return
+	}
+	if message.Role != "user" {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("cannot edit a %s message", message.Role))
+		return
+	}
 
-	var snippetTexts []string
-	if s.embedder != nil && s.vectorStore != nil {
-		if queries, err := s.embedder.Embed(r.Context(), []string{payload.Content}); err != nil {
-			log.Printf("embed query failed: %v", err)
-		} else if len(queries) > 0 {
-			if chunks, err := s.vectorStore.QuerySimilar(r.Context(), id, queries[0], s.cfg.Database.SearchTopK); err != nil {
-				log.Printf("query similar chunks failed: %v", err)
-			} else {
-				for i, chunk := range chunks {
-					content := strings.TrimSpace(trimToLimit(chunk.Content, 2000))
-					if content == "" {
-						continue
-					}
-					snippetTexts = append(snippetTexts, fmt.Sprintf("Snippet %d (score %.2f, doc %s):\n%s", i+1, chunk.Score, chunk.DocumentID, content))
-				}
-			}
-		}
+	s.answer(ctx, w, id, tree.Branch(message.ParentID), payload.Content, t)
+}
+
+// answer stores content as a user message following branch and generates the
+// reply.
+func (s *Server) answer(ctx context.Context, w http.ResponseWriter, conversationID string, branch []storage.Message, content string, t turn) {
+	userMessage := storage.Message{
+		ID:        uuid.NewString(),
+		Role:      "user",
+		Content:   content,
+		Timestamp: time.Now().UTC(),
+	}
+	if len(branch) > 0 {
+		userMessage.ParentID = branch[len(branch)-1].ID
+	}
+
+	if err := s.storage.AppendMessage(conversationID, userMessage); err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("store user message: %w", err))
+		return
 	}
 
-	if len(snippetTexts) == 0 {
+	s.generate(ctx, w, conversationID, append(branch, userMessage), t, &userMessage)
+}
+
+// generate answers the user message that ends branch, with document context
+// retrieved for it, and stores the reply as its child. userMessage, when set,
+// is the just stored question and is echoed in the response. When ctx is
+// cancelled, by the client going away or by the cancel endpoint, an empty
+// answer marked as cancelled is stored instead.
+func (s *Server) generate(ctx context.Context, w http.ResponseWriter, conversationID string, branch []storage.Message, t turn, userMessage *storage.Message) {
+	question := branch[len(branch)-1]
+	snippetTexts, documentIDs := s.retrieveSnippets(ctx, conversationID, question.Content, t.filter, t.neighbors)
+
+	// Whole-document excerpts would ignore the filter, so a filtered turn
+	// without matches goes without context.
+	if len(snippetTexts) == 0 && len(t.filter) == 0 {
 		const (
 			maxDocCharacters = 1200
 			maxCombinedDocs  = 8000
 		)
-		if texts, err := s.storage.LoadDocumentTexts(id); err == nil {
+		if documents, err := s.storage.ListDocuments(conversationID); err == nil {
 			total := 0
-			for i, text := range texts {
+			for i, document := range documents {
+				text, err := s.storage.DocumentText(document)
+				if err != nil {
+					continue
+				}
 				trimmed := strings.TrimSpace(trimToLimit(text, maxDocCharacters))
 				if trimmed == "" {
 					continue
@@ -174,40 +416,126 @@ func (s *Server) handlePostMessage(w http.ResponseWriter, r *http.Request) {
 				if total+len(trimmed) > maxCombinedDocs {
 					break
 				}
-				snippetTexts = append(snippetTexts, fmt.Sprintf("Document %d excerpt:\n%s", i+1, trimmed))
+				snippetTexts = append(snippetTexts, fmt.Sprintf("Document %d excerpt (doc %s, %s):\n%s", i+1, document.ID, document.Name, trimmed))
+				documentIDs = append(documentIDs, document.ID)
 				total += len(trimmed)
 			}
 		}
 	}
 
-	ollamaMessages := buildPrompt(history, snippetTexts)
-	response, err := s.llm.Generate(r.Context(), ollamaMessages)
-	if err != nil {
-		writeError(w, http.StatusBadGateway, fmt.Errorf("generate response: %w", err))
+	ollamaMessages := buildPrompt(branch, snippetTexts)
+	response, err := s.llm.Generate(ctx, ollamaMessages, t.options)
+	cancelled := err != nil && ctx.Err() != nil
+	if err != nil && !cancelled {
+		writeError(w, upstreamStatus(w, err), fmt.Errorf("generate response: %w", err))
 		return
 	}
 
 	assistantMessage := storage.Message{
+		ID:        uuid.NewString(),
+		ParentID:  question.ID,
 		Role:      "assistant",
 		Content:   response,
 		Timestamp: time.Now().UTC(),
 	}
+	if !t.options.IsZero() {
+		assistantMessage.Options = &t.options
+	}
+	if cancelled {
+		assistantMessage.Content = ""
+		assistantMessage.Cancelled = true
+	}
 
-	if err := s.storage.AppendMessage(id, assistantMessage); err != nil {
+	if err := s.storage.AppendMessage(conversationID, assistantMessage); err != nil {
 		writeError(w, http.StatusInternalServerError, fmt.Errorf("store assistant message: %w", err))
 		return
 	}
 
-	if _, err := s.storage.SaveTranscript(id, response, assistantMessage.Timestamp); err != nil {
-		writeError(w, http.StatusInternalServerError, fmt.Errorf("save transcript: %w", err))
+	if !cancelled {
+		if _, err := s.storage.SaveTranscript(conversationID, response, assistantMessage.Timestamp); err != nil {
+			writeError(w, http.StatusInternalServerError, fmt.Errorf("save transcript: %w", err))
+			return
+		}
+	}
+
+	result := map[string]any{
+		"message": assistantMessage,
+	}
+	if userMessage != nil {
+		result["user_message"] = userMessage
+	}
+	if t.returnPrompt {
+		result["prompt"] = map[string]any{
+			"model":     s.cfg.ChatModel(),
+			"messages":  ollamaMessages,
+			"options":   t.options,
+			"documents": documentIDs,
+		}
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// handleCancel aborts the answer being generated in the conversation. The
+// interrupted request stores the answer as cancelled.
+func (s *Server) handleCancel(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if status, err := s.checkConversation(id); err != nil {
+		writeError(w, status, err)
+		return
+	}
+
+	if !s.generations.cancel(id) {
+		writeError(w, http.StatusConflict, errNotGenerating)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"cancelled": true})
+}
+
+func (s *Server) handleGetSettings(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		writeError(w, http.StatusBadRequest, errors.New("missing conversation id"))
+		return
+	}
+
+	settings, err := s.storage.LoadSettings(id)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("load settings: %w", err))
 		return
 	}
 
 	writeJSON(w, http.StatusOK, map[string]any{
-		"message": assistantMessage,
+		"settings": settings,
+		"defaults": s.cfg.Ollama.Options,
 	})
 }
 
+func (s *Server) handlePutSettings(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		writeError(w, http.StatusBadRequest, errors.New("missing conversation id"))
+		return
+	}
+
+	var settings storage.Settings
+	if err := json.NewDecoder(r.Body).Decode(&settings); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("decode request: %w", err))
+		return
+	}
+
+	if err := settings.Options.Validate(); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid options: %w", err))
+		return
+	}
+
+	if err := s.storage.SaveSettings(id, settings); err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("save settings: %w", err))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{"settings": settings})
+}
+
 func (s *Server) handleListDocuments(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
 	if id == "" {
@@ -251,7 +579,7 @@ func (s *Server) handleUploadDocument(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	document, err := s.storage.SaveDocument(id, header.Filename, data)
+	document, err := s.storage.SaveDocument(id, header.Filename, data, strings.Split(r.FormValue("tags"), ","))
 	if err != nil {
 		if errors.Is(err, storage.ErrUnsupportedFileType) {
 			writeError(w, http.StatusBadRequest, err)
@@ -261,55 +589,170 @@ func (s *Server) handleUploadDocument(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if s.embedder != nil && s.vectorStore != nil {
-		if err := s.indexDocument(r.Context(), id, document); err != nil {
+	indexing := indexingResult{Status: "skipped"}
+	if s.indexer != nil {
+		chunks, err := s.indexer.IndexDocument(r.Context(), id, document)
+		if err != nil {
 			log.Printf("index document %s failed: %v", document.ID, err)
+			indexing = indexingFailure(err)
+		} else {
+			indexing = indexingResult{Status: "indexed", Chunks: chunks}
 		}
 	}
 
 	writeJSON(w, http.StatusCreated, map[string]any{
 		"document": document,
+		"indexing": indexing,
 	})
 }
 
-func (s *Server) indexDocument(ctx context.Context, conversationID string, document storage.Document) error {
-	if s.embedder == nil || s.vectorStore == nil {
-		return nil
+// indexingResult reports whether an uploaded document made it into the vector
+// store. The document itself is stored either way.
+type indexingResult struct {
+	Status string `json:"status"`
+	Chunks int    `json:"chunks,omitempty"`
+	Code   string `json:"code,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+func indexingFailure(err error) indexingResult {
+	code := "error"
+	var unavailable *resilience.UnavailableError
+	switch {
+	case errors.Is(err, embeddings.ErrModelNotFound):
+		code = "model_not_found"
+	case errors.Is(err, embeddings.ErrInputTooLong):
+		code = "input_too_long"
+	case errors.Is(err, embeddings.ErrDimensionMismatch):
+		code = "dimension_mismatch"
+	case errors.As(err, &unavailable):
+		code = "embedder_unavailable"
+	}
+	return indexingResult{Status: "failed", Code: code, Error: err.Error()}
+}
+
+func (s *Server) handleEmbeddingStatus(w http.ResponseWriter, r *http.Request) {
+	if s.indexer == nil {
+		writeError(w, http.StatusServiceUnavailable, errors.New("indexing disabled"))
+		return
 	}
+	writeJSON(w, http.StatusOK, s.indexer.Status())
+}
+
+type invalidOptionsError struct {
+	err error
+}
+
+func (e *invalidOptionsError) Error() string { return "invalid options: " + e.err.Error() }
+func (e *invalidOptionsError) Unwrap() error { return e.err }
 
-	text, err := s.storage.DocumentText(document)
+// generationOptions layers the configured defaults, the conversation settings
+// and the per-request override, in that order of precedence.
+func (s *Server) generationOptions(conversationID string, override *llm.Options) (llm.Options, error) {
+	settings, err := s.storage.LoadSettings(conversationID)
 	if err != nil {
-		return err
+		return llm.Options{}, fmt.Errorf("load settings: %w", err)
+	}
+
+	options := s.cfg.Ollama.Options.Merge(settings.Options)
+	if override != nil {
+		options = options.Merge(*override)
 	}
 
-	chunks := chunkText(text, 1500, 250)
-	if len(chunks) == 0 {
-		return nil
+	if err := options.Validate(); err != nil {
+		return llm.Options{}, &invalidOptionsError{err: err}
 	}
+	return options, nil
+}
+
+// maxNeighbors caps per-request neighbour expansion so a single turn cannot
+// pull whole documents into the prompt.
+const maxNeighbors = 5
+
+// chunkCharacters caps how much of a single chunk goes into the prompt.
+const chunkCharacters = 2000
 
-	vectors, err := s.embedder.Embed(ctx, chunks)
+// retrieveSnippets embeds the query and returns the formatted top-matching
+// chunks for the conversation, along with the IDs of the documents they come
+// from in rank order. Hits are replaced by their enclosing sections, or
+// widened by neighbouring chunks, when either applies. Failures are logged
+// and yield no snippets so the caller can fall back to other context.
+func (s *Server) retrieveSnippets(ctx context.Context, conversationID, query string, filter vectorstore.Filter, neighbors int) ([]string, []string) {
+	if s.indexer == nil {
+		return nil, nil
+	}
+
+	result, err := s.indexer.Search(ctx, conversationID, query, s.cfg.Database.SearchTopK, filter)
 	if err != nil {
-		return err
+		log.Printf("search document chunks failed: %v", err)
+		return nil, nil
+	}
+
+	var snippetTexts, documentIDs []string
+	addDocument := func(id string) {
+		if !slices.Contains(documentIDs, id) {
+			documentIDs = append(documentIDs, id)
+		}
+	}
+	if passages, limit, ok := s.passages(ctx, conversationID, result, neighbors); ok {
+		for i, passage := range passages {
+			content := strings.TrimSpace(trimToLimit(passage.Content, limit))
+			if content == "" {
+				continue
+			}
+			where := fmt.Sprintf("chunks %d-%d", passage.FirstChunk, passage.LastChunk)
+			if passage.Section != nil {
+				where = fmt.Sprintf("section %d", *passage.Section)
+			}
+			snippetTexts = append(snippetTexts, fmt.Sprintf("Snippet %d (score %.2f, doc %s, %s):\n%s", i+1, passage.Score, passage.DocumentID, where, content))
+			addDocument(passage.DocumentID)
+		}
+		return snippetTexts, documentIDs
 	}
 
-	return s.vectorStore.UpsertDocumentChunks(ctx, conversationID, document.ID, chunks, vectors)
+	for i, chunk := range result.Chunks {
+		content := strings.TrimSpace(trimToLimit(chunk.Content, chunkCharacters))
+		if content == "" {
+			continue
+		}
+		snippetTexts = append(snippetTexts, fmt.Sprintf("Snippet %d (score %.2f, doc %s):\n%s", i+1, chunk.Score, chunk.DocumentID, content))
+		addDocument(chunk.DocumentID)
+	}
+	return snippetTexts, documentIDs
+}
+
+// passages turns search hits into the passages sent to the model and returns
+// the character limit per passage. ok is false when the hits should be used
+// as they are, including when the lookup fails.
+func (s *Server) passages(ctx context.Context, conversationID string, result indexing.SearchResult, neighbors int) (passages []indexing.Passage, limit int, ok bool) {
+	passages, err := s.indexer.Passages(ctx, conversationID, result, neighbors)
+	if err != nil {
+		log.Printf("expand document chunks failed: %v", err)
+		return nil, 0, false
+	}
+	if passages == nil {
+		return nil, 0, false
+	}
+	if result.HasSections() {
+		// Sections are sized in runes but trimmed in bytes, so allow for the
+		// longest UTF-8 encoding to keep them whole.
+		return passages, utf8.UTFMax * max(s.cfg.Chunks.SectionSize, chunkCharacters), true
+	}
+	return passages, chunkCharacters * (2*neighbors + 1), true
 }
 
 func buildPrompt(history []storage.Message, snippets []string) []ollama.Message {
 	var messages []ollama.Message
 
-	systemContent := "You are a helpful assistant. Answer the user's question using the conversation history."
-	if len(snippets) > 0 {
-		systemContent += " The following document snippets may be useful:\n\n"
-		systemContent += strings.Join(snippets, "\n\n")
-		systemContent += "\n\nCite snippets explicitly when you rely on them."
-	}
 	messages = append(messages, ollama.Message{
 		Role:    "system",
-		Content: systemContent,
+		Content: "You are a helpful assistant. Answer the user's question using the conversation history." + snippetInstructions(snippets),
 	})
 
 	for _, msg := range history {
+		if msg.Cancelled {
+			continue
+		}
 		messages = append(messages, ollama.Message{
 			Role:    msg.Role,
 			Content: msg.Content,
@@ -319,6 +762,15 @@ func buildPrompt(history []storage.Message, snippets []string) []ollama.Message
 	return messages
 }
 
+func snippetInstructions(snippets []string) string {
+	if len(snippets) == 0 {
+		return ""
+	}
+	return " The following document snippets may be useful:\n\n" +
+		strings.Join(snippets, "\n\n") +
+		"\n\nCite snippets explicitly when you rely on them."
+}
+
 func trimToLimit(text string, limit int) string {
 	if len(text) <= limit {
 		return text
@@ -326,45 +778,18 @@ func trimToLimit(text string, limit int) string {
 	return text[:limit]
 }
 
-func chunkText(input string, chunkSize int, overlap int) []string {
-	if chunkSize <= 0 {
-		return []string{}
+// upstreamStatus maps an LLM or embedding failure to an HTTP status. When the
+// upstream is temporarily unavailable it answers 503 and sets Retry-After.
+func upstreamStatus(w http.ResponseWriter, err error) int {
+	var unavailable *resilience.UnavailableError
+	if !errors.As(err, &unavailable) {
+		return http.StatusBadGateway
 	}
-	if len(input) <= chunkSize {
-		return []string{strings.TrimSpace(input)}
+	if unavailable.RetryAfter > 0 {
+		seconds := int(math.Ceil(unavailable.RetryAfter.Seconds()))
+		w.Header().Set("Retry-After", strconv.Itoa(seconds))
 	}
-
-	if overlap >= chunkSize {
-		overlap = chunkSize / 4
-	}
-	if overlap < 0 {
-		overlap = 0
-	}
-
-	var chunks []string
-	runes := []rune(input)
-	total := len(runes)
-
-	step := chunkSize - overlap
-	if step <= 0 {
-		step = chunkSize
-	}
-
-	for start := 0; start < total; start += step {
-		end := start + chunkSize
-		if end > total {
-			end = total
-		}
-		chunk := strings.TrimSpace(string(runes[start:end]))
-		if chunk != "" {
-			chunks = append(chunks, chunk)
-		}
-		if end == total {
-			break
-		}
-	}
-
-	return chunks
+	return http.StatusServiceUnavailable
 }
 
 func writeJSON(w http.ResponseWriter, status int, payload any) {
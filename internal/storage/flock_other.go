@@ -0,0 +1,11 @@
+//go:build !unix
+
+package storage
+
+import "os"
+
+// Advisory locking is only implemented on Unix; elsewhere locks always
+// succeed and only the in-process mutexes protect the data directory.
+func flock(f *os.File, exclusive, wait bool) error { return nil }
+
+func funlock(f *os.File) error { return nil }
@@ -0,0 +1,201 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const transcriptTimestampKey = "timestamp: "
+
+// ImportReport summarises an ImportFiles run.
+type ImportReport struct {
+	Conversations int
+	Skipped       int
+	Messages      int
+	Documents     int
+	Transcripts   int
+}
+
+// ImportFiles copies every conversation from the filesystem layout managed by
+// src into dst. Conversations already present in dst are skipped, so the
+// import can be re-run safely after an interruption. Document files are not
+// moved; dst references them at their current paths.
+func ImportFiles(src *Manager, dst *SQLiteStore) (ImportReport, error) {
+	var report ImportReport
+
+	ids, err := src.ListConversations()
+	if err != nil {
+		return report, err
+	}
+
+	for _, id := range ids {
+		var exists int
+		if err := dst.db.QueryRow(`SELECT COUNT(*) FROM conversations WHERE id = ?`, id).Scan(&exists); err != nil {
+			return report, fmt.Errorf("check conversation %s: %w", id, err)
+		}
+		if exists > 0 {
+			report.Skipped++
+			continue
+		}
+
+		counts, err := importConversation(src, dst, id)
+		if err != nil {
+			return report, fmt.Errorf("import conversation %s: %w", id, err)
+		}
+		report.Conversations++
+		report.Messages += counts.Messages
+		report.Documents += counts.Documents
+		report.Transcripts += counts.Transcripts
+	}
+
+	return report, nil
+}
+
+// importConversation copies one conversation inside a single transaction so a
+// failure leaves no partial conversation behind.
+func importConversation(src *Manager, dst *SQLiteStore, id string) (ImportReport, error) {
+	var counts ImportReport
+
+	history, err := src.LoadHistory(id)
+	if err != nil {
+		return counts, err
+	}
+	settings, err := src.LoadSettings(id)
+	if err != nil {
+		return counts, err
+	}
+	documents, err := src.loadDocuments(id)
+	if err != nil {
+		return counts, err
+	}
+	transcripts, err := src.loadTranscripts(id)
+	if err != nil {
+		return counts, err
+	}
+
+	created := time.Now()
+	if info, err := os.Stat(src.conversationDir(id)); err == nil {
+		created = info.ModTime()
+	}
+	if len(history) > 0 && history[0].Timestamp.Before(created) {
+		created = history[0].Timestamp
+	}
+
+	tx, err := dst.db.Begin()
+	if err != nil {
+		return counts, fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`INSERT INTO conversations (id, created_at) VALUES (?, ?)`, id, formatTime(created)); err != nil {
+		return counts, fmt.Errorf("insert conversation: %w", err)
+	}
+
+	for _, message := range history {
+		options, rating, err := encodeMessageFields(message)
+		if err != nil {
+			return counts, err
+		}
+		if _, err := tx.Exec(
+			`INSERT INTO messages (conversation_id, id, parent_id, role, content, timestamp, options, pinned, rating, cancelled) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			id, message.ID, message.ParentID, message.Role, message.Content, formatTime(message.Timestamp), options, message.Pinned, rating, message.Cancelled,
+		); err != nil {
+			return counts, fmt.Errorf("insert message: %w", err)
+		}
+		counts.Messages++
+	}
+
+	if !settings.Options.IsZero() {
+		data, err := jsonString(settings)
+		if err != nil {
+			return counts, err
+		}
+		if _, err := tx.Exec(`INSERT INTO settings (conversation_id, data) VALUES (?, ?)`, id, data); err != nil {
+			return counts, fmt.Errorf("insert settings: %w", err)
+		}
+	}
+
+	for _, doc := range documents {
+		if err := insertDocument(tx, id, doc); err != nil {
+			return counts, err
+		}
+		counts.Documents++
+	}
+
+	for _, transcript := range transcripts {
+		if _, err := tx.Exec(
+			`INSERT INTO transcripts (conversation_id, content, timestamp) VALUES (?, ?, ?)`,
+			id, transcript.content, formatTime(transcript.timestamp),
+		); err != nil {
+			return counts, fmt.Errorf("insert transcript: %w", err)
+		}
+		counts.Transcripts++
+	}
+
+	if err := tx.Commit(); err != nil {
+		return counts, fmt.Errorf("commit transaction: %w", err)
+	}
+	return counts, nil
+}
+
+type transcriptFile struct {
+	content   string
+	timestamp time.Time
+}
+
+// loadTranscripts parses the Markdown transcripts written by SaveTranscript,
+// oldest first.
+func (m *Manager) loadTranscripts(conversationID string) ([]transcriptFile, error) {
+	paths, err := filepath.Glob(filepath.Join(m.conversationDir(conversationID), "transcripts", "*.md"))
+	if err != nil {
+		return nil, fmt.Errorf("list transcripts: %w", err)
+	}
+	sort.Strings(paths)
+
+	transcripts := make([]transcriptFile, 0, len(paths))
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("read transcript: %w", err)
+		}
+		transcript, err := parseTranscript(string(data))
+		if err != nil {
+			return nil, fmt.Errorf("parse transcript %s: %w", filepath.Base(path), err)
+		}
+		transcripts = append(transcripts, transcript)
+	}
+	return transcripts, nil
+}
+
+func parseTranscript(data string) (transcriptFile, error) {
+	rest, ok := strings.CutPrefix(data, "---\n")
+	if !ok {
+		return transcriptFile{}, errors.New("missing front matter")
+	}
+	header, body, ok := strings.Cut(rest, "\n---\n")
+	if !ok {
+		return transcriptFile{}, errors.New("unterminated front matter")
+	}
+
+	var transcript transcriptFile
+	for _, line := range strings.Split(header, "\n") {
+		if value, ok := strings.CutPrefix(line, transcriptTimestampKey); ok {
+			t, err := time.Parse(time.RFC3339, strings.TrimSpace(value))
+			if err != nil {
+				return transcriptFile{}, fmt.Errorf("parse timestamp: %w", err)
+			}
+			transcript.timestamp = t
+		}
+	}
+	if transcript.timestamp.IsZero() {
+		return transcriptFile{}, errors.New("missing timestamp")
+	}
+
+	transcript.content = strings.TrimSuffix(strings.TrimPrefix(body, "\n"), "\n")
+	return transcript, nil
+}
@@ -0,0 +1,182 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// journalCompactEvery is how many journal entries accumulate before they are
+// folded into history.json.
+const journalCompactEvery = 64
+
+// journalEntry is one line of history.journal. Seq is the message's index in
+// the full history, which lets replay skip entries already folded into the
+// snapshot if a crash interrupted compaction.
+type journalEntry struct {
+	Seq     int     `json:"seq"`
+	Message Message `json:"message"`
+}
+
+// appendJournal durably appends a single entry to the journal file.
+func appendJournal(path string, entry journalEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("encode journal entry: %w", err)
+	}
+	line = append(line, '\n')
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("open journal: %w", err)
+	}
+	if _, err := f.Write(line); err != nil {
+		f.Close()
+		return fmt.Errorf("append journal: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return fmt.Errorf("sync journal: %w", err)
+	}
+	return f.Close()
+}
+
+// readJournal returns the complete entries in the journal and the byte offset
+// just past the last one. A trailing line without a newline, or one that does
+// not decode, is a torn write from a crash and is ignored; Recover truncates
+// it. Corruption before the tail is reported as an error.
+func readJournal(path string) ([]journalEntry, int64, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, 0, nil
+	}
+	if err != nil {
+		return nil, 0, fmt.Errorf("read journal: %w", err)
+	}
+
+	var (
+		entries []journalEntry
+		offset  int64
+	)
+	reader := bufio.NewReader(bytes.NewReader(data))
+	for {
+		line, err := reader.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			// Incomplete final line: the append never finished.
+			return entries, offset, nil
+		}
+		if err != nil {
+			return nil, 0, fmt.Errorf("read journal: %w", err)
+		}
+
+		var entry journalEntry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			if int(offset)+len(line) == len(data) {
+				return entries, offset, nil
+			}
+			return nil, 0, fmt.Errorf("decode journal entry at byte %d: %w", offset, err)
+		}
+		entries = append(entries, entry)
+		offset += int64(len(line))
+	}
+}
+
+// replayJournal appends the journal entries not yet contained in history.
+func replayJournal(history []Message, entries []journalEntry) []Message {
+	for _, entry := range entries {
+		if entry.Seq == len(history) {
+			history = append(history, entry.Message)
+		}
+	}
+	return history
+}
+
+// journalState is what AppendMessage needs to know about a conversation's
+// journal: the Seq of the next message and how many entries await
+// compaction. It is cached per conversation together with a stamp of the
+// files it was derived from, so appends neither parse history.json nor
+// re-read the journal unless another writer changed them.
+type journalState struct {
+	next    int
+	entries int
+	stamp   fileStamp
+}
+
+// fileStamp identifies the versions of history.json and history.journal.
+type fileStamp struct {
+	journalSize  int64
+	snapshotSize int64
+	snapshotMod  time.Time
+}
+
+func (m *Manager) stampFiles(conversationID string) (fileStamp, error) {
+	var stamp fileStamp
+	info, err := os.Stat(m.journalPath(conversationID))
+	switch {
+	case err == nil:
+		stamp.journalSize = info.Size()
+	case !errors.Is(err, os.ErrNotExist):
+		return fileStamp{}, fmt.Errorf("stat journal: %w", err)
+	}
+	info, err = os.Stat(m.historyPath(conversationID))
+	switch {
+	case err == nil:
+		stamp.snapshotSize, stamp.snapshotMod = info.Size(), info.ModTime()
+	case !errors.Is(err, os.ErrNotExist):
+		return fileStamp{}, fmt.Errorf("stat history: %w", err)
+	}
+	return stamp, nil
+}
+
+// journalState returns the cached state of the conversation's journal, or
+// rebuilds it from the journal when the files changed. history.json is only
+// parsed when the journal is empty. Callers must hold the conversation lock.
+func (m *Manager) journalState(conversationID string) (journalState, error) {
+	stamp, err := m.stampFiles(conversationID)
+	if err != nil {
+		return journalState{}, err
+	}
+	m.mu.Lock()
+	state, ok := m.journals[conversationID]
+	m.mu.Unlock()
+	if ok && state.stamp == stamp {
+		return state, nil
+	}
+
+	entries, _, err := readJournal(m.journalPath(conversationID))
+	if err != nil {
+		return journalState{}, err
+	}
+	state = journalState{entries: len(entries), stamp: stamp}
+	if len(entries) > 0 {
+		// Entries are written in sequence and the snapshot never runs
+		// ahead of the journal's last entry.
+		state.next = entries[len(entries)-1].Seq + 1
+	} else {
+		snapshot, err := m.loadSnapshot(conversationID)
+		if err != nil {
+			return journalState{}, err
+		}
+		state.next = len(snapshot)
+	}
+	return state, nil
+}
+
+// rememberJournal caches state after a write, stamped with the files as
+// they are now. Callers must hold the conversation lock.
+func (m *Manager) rememberJournal(conversationID string, state journalState) error {
+	stamp, err := m.stampFiles(conversationID)
+	if err != nil {
+		return err
+	}
+	state.stamp = stamp
+	m.mu.Lock()
+	m.journals[conversationID] = state
+	m.mu.Unlock()
+	return nil
+}
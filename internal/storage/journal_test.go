@@ -0,0 +1,124 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"testing"
+)
+
+func newTestManager(t *testing.T) *Manager {
+	t.Helper()
+	m, err := NewManager(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewManager: %v", err)
+	}
+	return m
+}
+
+func appendMessages(t *testing.T, m *Manager, conversationID string, contents ...string) {
+	t.Helper()
+	for _, content := range contents {
+		if err := m.AppendMessage(conversationID, Message{Role: "user", Content: content}); err != nil {
+			t.Fatalf("AppendMessage(%q): %v", content, err)
+		}
+	}
+}
+
+func historyContents(t *testing.T, m *Manager, conversationID string) []string {
+	t.Helper()
+	history, err := m.LoadHistory(conversationID)
+	if err != nil {
+		t.Fatalf("LoadHistory: %v", err)
+	}
+	contents := make([]string, len(history))
+	for i, message := range history {
+		contents[i] = message.Content
+	}
+	return contents
+}
+
+func TestAppendMessageCompactsJournal(t *testing.T) {
+	m := newTestManager(t)
+	var want []string
+	for i := 0; i < journalCompactEvery+5; i++ {
+		want = append(want, fmt.Sprint(i))
+	}
+	appendMessages(t, m, "c", want...)
+
+	snapshot, err := m.loadSnapshot("c")
+	if err != nil {
+		t.Fatalf("loadSnapshot: %v", err)
+	}
+	entries, _, err := readJournal(m.journalPath("c"))
+	if err != nil {
+		t.Fatalf("readJournal: %v", err)
+	}
+	if len(snapshot) != journalCompactEvery || len(entries) != 5 {
+		t.Errorf("snapshot %d, journal %d; want %d and 5", len(snapshot), len(entries), journalCompactEvery)
+	}
+	if got := historyContents(t, m, "c"); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("history = %v, want %v", got, want)
+	}
+}
+
+func TestAppendMessageSeesOtherWriters(t *testing.T) {
+	root := t.TempDir()
+	a, _ := NewManager(root)
+	b, _ := NewManager(root)
+
+	appendMessages(t, a, "c", "a1", "a2")
+	appendMessages(t, b, "c", "b1")
+	appendMessages(t, a, "c", "a3")
+
+	// A compaction by the other writer shrinks the journal behind a's cache.
+	history, _ := b.LoadHistory("c")
+	if _, err := b.DeleteMessage("c", history[0].ID); err != nil {
+		t.Fatalf("DeleteMessage: %v", err)
+	}
+	appendMessages(t, a, "c", "a4")
+
+	want := []string{"a2", "b1", "a3", "a4"}
+	if got := historyContents(t, a, "c"); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("history = %v, want %v", got, want)
+	}
+}
+
+func TestTornJournalTail(t *testing.T) {
+	m := newTestManager(t)
+	appendMessages(t, m, "c", "one", "two")
+
+	journal, err := os.OpenFile(m.journalPath("c"), os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	journal.WriteString(`{"seq": 2, "message": {"role": "user", "con`)
+	journal.Close()
+
+	if got := historyContents(t, m, "c"); fmt.Sprint(got) != "[one two]" {
+		t.Errorf("history with torn tail = %v, want [one two]", got)
+	}
+
+	actions, err := m.Recover()
+	if err != nil {
+		t.Fatalf("Recover: %v", err)
+	}
+	if len(actions) != 1 || actions[0].Action != "truncated" {
+		t.Errorf("actions = %v, want one truncation", actions)
+	}
+
+	appendMessages(t, m, "c", "three")
+	if got := historyContents(t, m, "c"); fmt.Sprint(got) != "[one two three]" {
+		t.Errorf("history after recovery = %v, want [one two three]", got)
+	}
+}
+
+func TestJournalCorruptBeforeTail(t *testing.T) {
+	m := newTestManager(t)
+	appendMessages(t, m, "c", "one")
+	data, _ := os.ReadFile(m.journalPath("c"))
+	os.WriteFile(m.journalPath("c"), append([]byte("not json\n"), data...), 0o644)
+
+	if _, err := m.LoadHistory("c"); err == nil {
+		t.Error("LoadHistory succeeded on a journal corrupt before its tail")
+	}
+}
@@ -0,0 +1,165 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+var errLocked = errors.New("locked by another process")
+
+// fileLock is an advisory lock held on an open file. Locks are released when
+// the file is closed, including when the process dies.
+type fileLock struct {
+	f *os.File
+}
+
+func lockFile(path string, exclusive, wait bool) (*fileLock, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("open lock file: %w", err)
+	}
+	if err := flock(f, exclusive, wait); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &fileLock{f: f}, nil
+}
+
+func (l *fileLock) unlock() error {
+	if err := funlock(l.f); err != nil {
+		l.f.Close()
+		return fmt.Errorf("unlock: %w", err)
+	}
+	return l.f.Close()
+}
+
+// lockConversation serialises writers to one conversation, both between
+// goroutines (mutex) and between processes sharing DATA_DIR (an advisory lock
+// on conversations/<id>/.lock). It blocks until the lock is available, and
+// returns ErrConversationNotFound rather than creating the directory.
+func (m *Manager) lockConversation(conversationID string) (func(), error) {
+	if _, err := os.Stat(m.conversationDir(conversationID)); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("lock conversation %s: %w", conversationID, ErrConversationNotFound)
+		}
+		return nil, fmt.Errorf("lock conversation %s: %w", conversationID, err)
+	}
+
+	mu := m.lockFor(conversationID)
+	mu.Lock()
+
+	fl, err := lockFile(filepath.Join(m.conversationDir(conversationID), ".lock"), true, true)
+	if err != nil {
+		mu.Unlock()
+		return nil, fmt.Errorf("lock conversation %s: %w", conversationID, err)
+	}
+
+	return func() {
+		fl.unlock()
+		mu.Unlock()
+	}, nil
+}
+
+func (m *Manager) lockFor(conversationID string) *sync.Mutex {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if lock, ok := m.locks[conversationID]; ok {
+		return lock
+	}
+
+	lock := &sync.Mutex{}
+	m.locks[conversationID] = lock
+	return lock
+}
+
+// LockOwner identifies the process holding the data directory lock.
+type LockOwner struct {
+	PID     int       `json:"pid"`
+	Host    string    `json:"host"`
+	Command string    `json:"command"`
+	Since   time.Time `json:"since"`
+}
+
+// DataDirInUseError is returned by LockDataDir when another process already
+// owns the data directory.
+type DataDirInUseError struct {
+	Dir   string
+	Owner LockOwner
+}
+
+func (e *DataDirInUseError) Error() string {
+	if e.Owner.PID == 0 {
+		return fmt.Sprintf("data directory %s is in use by another process", e.Dir)
+	}
+	return fmt.Sprintf("data directory %s is in use by %q (pid %d on %s) since %s; stop it or point DATA_DIR elsewhere",
+		e.Dir, e.Owner.Command, e.Owner.PID, e.Owner.Host, e.Owner.Since.Format(time.RFC3339))
+}
+
+// DataDirLock is the exclusive ownership lock on a data directory.
+type DataDirLock struct {
+	lock *fileLock
+}
+
+// LockDataDir takes exclusive ownership of root for a writer process and
+// records who holds it in root/.lock. It fails immediately with a
+// *DataDirInUseError if another process holds the lock.
+func LockDataDir(root, command string) (*DataDirLock, error) {
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return nil, fmt.Errorf("create data directory: %w", err)
+	}
+
+	path := filepath.Join(root, ".lock")
+	fl, err := lockFile(path, true, false)
+	if errors.Is(err, errLocked) {
+		inUse := &DataDirInUseError{Dir: root}
+		if data, readErr := os.ReadFile(path); readErr == nil {
+			json.Unmarshal(data, &inUse.Owner)
+		}
+		return nil, inUse
+	}
+	if err != nil {
+		return nil, fmt.Errorf("lock data directory: %w", err)
+	}
+
+	host, _ := os.Hostname()
+	owner, err := json.Marshal(LockOwner{
+		PID:     os.Getpid(),
+		Host:    host,
+		Command: strings.TrimSpace(command),
+		Since:   time.Now().UTC(),
+	})
+	if err != nil {
+		fl.unlock()
+		return nil, fmt.Errorf("encode lock owner: %w", err)
+	}
+	if err := fl.f.Truncate(0); err != nil {
+		fl.unlock()
+		return nil, fmt.Errorf("write lock owner: %w", err)
+	}
+	if _, err := fl.f.WriteAt(owner, 0); err != nil {
+		fl.unlock()
+		return nil, fmt.Errorf("write lock owner: %w", err)
+	}
+	fl.f.Sync()
+
+	return &DataDirLock{lock: fl}, nil
+}
+
+// Release gives up ownership of the data directory.
+func (l *DataDirLock) Release() error {
+	if l == nil || l.lock == nil {
+		return nil
+	}
+	if err := l.lock.f.Truncate(0); err != nil {
+		l.lock.unlock()
+		return fmt.Errorf("clear lock owner: %w", err)
+	}
+	return l.lock.unlock()
+}
@@ -0,0 +1,83 @@
+//go:build unix
+
+package storage
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLockDataDirContention(t *testing.T) {
+	root := t.TempDir()
+	held, err := LockDataDir(root, "serve")
+	if err != nil {
+		t.Fatalf("LockDataDir: %v", err)
+	}
+
+	_, err = LockDataDir(root, "index")
+	var inUse *DataDirInUseError
+	if !errors.As(err, &inUse) {
+		t.Fatalf("second LockDataDir: %v, want *DataDirInUseError", err)
+	}
+	if inUse.Owner.Command != "serve" || inUse.Owner.PID != os.Getpid() {
+		t.Errorf("owner = %+v, want serve in this process", inUse.Owner)
+	}
+
+	if err := held.Release(); err != nil {
+		t.Fatalf("Release: %v", err)
+	}
+	again, err := LockDataDir(root, "index")
+	if err != nil {
+		t.Fatalf("LockDataDir after Release: %v", err)
+	}
+	again.Release()
+}
+
+func TestLockFileNoWait(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".lock")
+	held, err := lockFile(path, true, false)
+	if err != nil {
+		t.Fatalf("lockFile: %v", err)
+	}
+	defer held.unlock()
+
+	if _, err := lockFile(path, true, false); !errors.Is(err, errLocked) {
+		t.Errorf("exclusive lock on a held file: %v, want errLocked", err)
+	}
+	if _, err := lockFile(path, false, false); !errors.Is(err, errLocked) {
+		t.Errorf("shared lock on an exclusively held file: %v, want errLocked", err)
+	}
+}
+
+func TestLockConversationWaitsForOtherProcess(t *testing.T) {
+	root := t.TempDir()
+	a, _ := NewManager(root)
+	b, _ := NewManager(root)
+	appendMessages(t, a, "c", "one")
+
+	// Separate Managers share no mutex, so only the file lock keeps b out.
+	unlock, err := a.lockConversation("c")
+	if err != nil {
+		t.Fatalf("lockConversation: %v", err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- b.AppendMessage("c", Message{Role: "user", Content: "two"})
+	}()
+
+	select {
+	case err := <-done:
+		t.Fatalf("AppendMessage finished while the conversation was locked: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	unlock()
+	if err := <-done; err != nil {
+		t.Fatalf("AppendMessage: %v", err)
+	}
+	if got := historyContents(t, a, "c"); len(got) != 2 {
+		t.Errorf("history = %v, want two messages", got)
+	}
+}
@@ -0,0 +1,59 @@
+package storage
+
+import (
+	"sort"
+	"time"
+
+	"github.com/fabfab/airplane-chat/internal/llm"
+)
+
+// RatedAnswer is a rated assistant message together with the question it
+// answered, as exported for evaluation.
+type RatedAnswer struct {
+	ConversationID string       `json:"conversation_id"`
+	MessageID      string       `json:"message_id"`
+	Question       string       `json:"question"`
+	Answer         string       `json:"answer"`
+	Rating         string       `json:"rating"`
+	Comment        string       `json:"comment,omitempty"`
+	RatedAt        time.Time    `json:"rated_at"`
+	Options        *llm.Options `json:"options,omitempty"`
+}
+
+// Ratings collects the rated answers of every conversation, oldest rating
+// first.
+func Ratings(store Store) ([]RatedAnswer, error) {
+	conversations, err := store.ListConversations()
+	if err != nil {
+		return nil, err
+	}
+
+	ratings := []RatedAnswer{}
+	for _, conversationID := range conversations {
+		history, err := store.LoadHistory(conversationID)
+		if err != nil {
+			return nil, err
+		}
+		tree := NewTree(history)
+		for _, message := range history {
+			if message.Rating == nil {
+				continue
+			}
+			rated := RatedAnswer{
+				ConversationID: conversationID,
+				MessageID:      message.ID,
+				Answer:         message.Content,
+				Rating:         message.Rating.Value,
+				Comment:        message.Rating.Comment,
+				RatedAt:        message.Rating.RatedAt,
+				Options:        message.Options,
+			}
+			if question, ok := tree.Message(message.ParentID); ok {
+				rated.Question = question.Content
+			}
+			ratings = append(ratings, rated)
+		}
+	}
+	sort.SliceStable(ratings, func(i, j int) bool { return ratings[i].RatedAt.Before(ratings[j].RatedAt) })
+	return ratings, nil
+}
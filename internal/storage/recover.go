@@ -0,0 +1,221 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// RecoveryAction describes one repair made by Recover.
+type RecoveryAction struct {
+	ConversationID string
+	File           string
+	Action         string
+	Detail         string
+}
+
+func (a RecoveryAction) String() string {
+	return fmt.Sprintf("conversation %s: %s %s (%s)", a.ConversationID, a.Action, a.File, a.Detail)
+}
+
+// Recover scans every conversation for damage left by a crash and repairs it
+// so LoadHistory and ListDocuments keep working:
+//
+//   - leftover temporary files from interrupted atomic writes are removed
+//   - a torn final journal line is truncated
+//   - a journal corrupt before its tail is quarantined
+//   - an undecodable history.json is quarantined and rebuilt from the journal
+//   - an undecodable documents.json is quarantined and rebuilt from the files
+//     in the documents directory
+//   - an undecodable settings.json is quarantined so defaults apply
+//   - messages stored before messages had IDs are given IDs
+//
+// Quarantined files are renamed to <name>.corrupt-<timestamp> rather than
+// deleted. Recover should run before the server accepts requests.
+func (m *Manager) Recover() ([]RecoveryAction, error) {
+	ids, err := m.ListConversations()
+	if err != nil {
+		return nil, err
+	}
+
+	var actions []RecoveryAction
+	for _, id := range ids {
+		unlock, err := m.lockConversation(id)
+		if err != nil {
+			return actions, err
+		}
+		conversationActions, err := m.recoverConversation(id)
+		unlock()
+		actions = append(actions, conversationActions...)
+		if err != nil {
+			return actions, fmt.Errorf("recover conversation %s: %w", id, err)
+		}
+	}
+	return actions, nil
+}
+
+func (m *Manager) recoverConversation(id string) ([]RecoveryAction, error) {
+	var actions []RecoveryAction
+	record := func(file, action, detail string) {
+		actions = append(actions, RecoveryAction{ConversationID: id, File: file, Action: action, Detail: detail})
+	}
+
+	dir := m.conversationDir(id)
+	for _, sub := range []string{dir, filepath.Join(dir, "documents"), filepath.Join(dir, "transcripts")} {
+		leftovers, _ := filepath.Glob(filepath.Join(sub, ".*"+tempSuffix))
+		for _, path := range leftovers {
+			if err := os.Remove(path); err != nil {
+				return actions, fmt.Errorf("remove temporary file: %w", err)
+			}
+			record(m.relative(path), "removed", "incomplete write")
+		}
+	}
+
+	journalPath := m.journalPath(id)
+	entries, offset, err := readJournal(journalPath)
+	if err != nil {
+		if err := quarantine(journalPath); err != nil {
+			return actions, err
+		}
+		record(m.relative(journalPath), "quarantined", err.Error())
+		entries = nil
+	} else if info, statErr := os.Stat(journalPath); statErr == nil && info.Size() > offset {
+		if err := os.Truncate(journalPath, offset); err != nil {
+			return actions, fmt.Errorf("truncate journal: %w", err)
+		}
+		record(m.relative(journalPath), "truncated", fmt.Sprintf("dropped %d bytes of torn write", info.Size()-offset))
+	}
+
+	historyPath := m.historyPath(id)
+	if _, err := m.loadSnapshot(id); err != nil {
+		if err := quarantine(historyPath); err != nil {
+			return actions, err
+		}
+		record(m.relative(historyPath), "quarantined", err.Error())
+
+		// Without a snapshot, the journal is the best surviving record.
+		rebuilt := make([]Message, 0, len(entries))
+		for _, entry := range entries {
+			rebuilt = append(rebuilt, entry.Message)
+		}
+		if err := m.compactHistory(id, rebuilt); err != nil {
+			return actions, err
+		}
+		record(m.relative(historyPath), "rebuilt", fmt.Sprintf("%d messages recovered from journal", len(rebuilt)))
+	}
+
+	// Messages written before messages had IDs get theirs persisted, so they
+	// survive the removal of earlier messages.
+	history, err := m.readHistory(id)
+	if err != nil {
+		return actions, err
+	}
+	if changed := backfillIDs(id, history); changed > 0 {
+		if err := m.compactHistory(id, history); err != nil {
+			return actions, err
+		}
+		record(m.relative(historyPath), "upgraded", fmt.Sprintf("assigned IDs to %d messages", changed))
+	}
+
+	documentsPath := m.documentsPath(id)
+	if _, err := m.loadDocuments(id); err != nil {
+		if err := quarantine(documentsPath); err != nil {
+			return actions, err
+		}
+		record(m.relative(documentsPath), "quarantined", err.Error())
+
+		documents, err := m.scanDocuments(id)
+		if err != nil {
+			return actions, err
+		}
+		if err := m.saveDocuments(id, documents); err != nil {
+			return actions, err
+		}
+		record(m.relative(documentsPath), "rebuilt", fmt.Sprintf("%d documents recovered from disk", len(documents)))
+	}
+
+	settingsPath := m.settingsPath(id)
+	if _, err := m.LoadSettings(id); err != nil {
+		if err := quarantine(settingsPath); err != nil {
+			return actions, err
+		}
+		record(m.relative(settingsPath), "quarantined", err.Error())
+	}
+
+	return actions, nil
+}
+
+// scanDocuments reconstructs document metadata from the stored files. Each
+// upload produces <id>.txt with the extracted text and, for non-text uploads,
+// <id><ext> with the original bytes. Original file names cannot be recovered.
+func (m *Manager) scanDocuments(conversationID string) ([]Document, error) {
+	dir := filepath.Join(m.conversationDir(conversationID), "documents")
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return []Document{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("list documents directory: %w", err)
+	}
+
+	byID := make(map[string]*Document)
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || strings.HasPrefix(name, ".") {
+			continue
+		}
+		ext := filepath.Ext(name)
+		id := strings.TrimSuffix(name, ext)
+		doc, ok := byID[id]
+		if !ok {
+			doc = &Document{ID: id}
+			byID[id] = doc
+		}
+
+		path := filepath.Join(dir, name)
+		if ext == ".txt" {
+			doc.TextPath = path
+			if doc.StoredPath != "" {
+				continue
+			}
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, fmt.Errorf("stat document: %w", err)
+		}
+		doc.StoredPath = path
+		doc.Name = "recovered-" + name
+		doc.Size = info.Size()
+		doc.UploadedAt = info.ModTime().UTC()
+	}
+
+	documents := make([]Document, 0, len(byID))
+	for _, doc := range byID {
+		if doc.TextPath == "" {
+			continue
+		}
+		documents = append(documents, *doc)
+	}
+	sort.Slice(documents, func(i, j int) bool { return documents[i].UploadedAt.Before(documents[j].UploadedAt) })
+	return documents, nil
+}
+
+func (m *Manager) relative(path string) string {
+	if rel, err := filepath.Rel(m.root, path); err == nil {
+		return rel
+	}
+	return path
+}
+
+// quarantine moves a damaged file aside so it can be inspected later.
+func quarantine(path string) error {
+	target := fmt.Sprintf("%s.corrupt-%s", path, time.Now().UTC().Format("20060102T150405Z"))
+	if err := os.Rename(path, target); err != nil {
+		return fmt.Errorf("quarantine %s: %w", filepath.Base(path), err)
+	}
+	return nil
+}
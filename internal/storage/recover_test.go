@@ -0,0 +1,91 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRecoverRebuildsCorruptHistory(t *testing.T) {
+	m := newTestManager(t)
+	appendMessages(t, m, "c", "one", "two")
+	if err := os.WriteFile(m.historyPath("c"), []byte("{not json"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.LoadHistory("c"); err == nil {
+		t.Fatal("LoadHistory succeeded on a corrupt history.json")
+	}
+
+	actions, err := m.Recover()
+	if err != nil {
+		t.Fatalf("Recover: %v", err)
+	}
+	var got []string
+	for _, action := range actions {
+		got = append(got, action.Action+" "+filepath.Base(action.File))
+	}
+	if fmt.Sprint(got) != "[quarantined history.json rebuilt history.json]" {
+		t.Errorf("actions = %v", got)
+	}
+
+	quarantined, _ := filepath.Glob(m.historyPath("c") + ".corrupt-*")
+	if len(quarantined) != 1 {
+		t.Errorf("quarantined files = %v, want one", quarantined)
+	}
+	if got := historyContents(t, m, "c"); fmt.Sprint(got) != "[one two]" {
+		t.Errorf("history = %v, want the journaled [one two]", got)
+	}
+}
+
+func TestRecoverQuarantinesSettingsAndDocuments(t *testing.T) {
+	m := newTestManager(t)
+	doc, err := m.SaveDocument("c", "notes.txt", []byte("hello"), nil)
+	if err != nil {
+		t.Fatalf("SaveDocument: %v", err)
+	}
+	os.WriteFile(m.documentsPath("c"), []byte("["), 0o644)
+	os.WriteFile(m.settingsPath("c"), []byte("?"), 0o644)
+
+	if _, err := m.Recover(); err != nil {
+		t.Fatalf("Recover: %v", err)
+	}
+	documents, err := m.ListDocuments("c")
+	if err != nil || len(documents) != 1 || documents[0].ID != doc.ID {
+		t.Errorf("documents = %+v, %v; want %s rebuilt from disk", documents, err, doc.ID)
+	}
+	if _, err := m.LoadSettings("c"); err != nil {
+		t.Errorf("LoadSettings after recovery: %v", err)
+	}
+}
+
+func TestRecoverRemovesTemporaryFiles(t *testing.T) {
+	m := newTestManager(t)
+	appendMessages(t, m, "c", "one")
+	leftover := filepath.Join(m.conversationDir("c"), ".history.json.123"+tempSuffix)
+	os.WriteFile(leftover, []byte("partial"), 0o644)
+
+	if _, err := m.Recover(); err != nil {
+		t.Fatalf("Recover: %v", err)
+	}
+	if _, err := os.Stat(leftover); !os.IsNotExist(err) {
+		t.Errorf("temporary file survived recovery: %v", err)
+	}
+}
+
+func TestWriteFileAtomicReplaces(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.json")
+	for _, content := range []string{"first", "second"} {
+		if err := writeFileAtomic(path, []byte(content), 0o600); err != nil {
+			t.Fatalf("writeFileAtomic: %v", err)
+		}
+	}
+	data, _ := os.ReadFile(path)
+	info, _ := os.Stat(path)
+	if string(data) != "second" || info.Mode().Perm() != 0o600 {
+		t.Errorf("content %q mode %v, want second and 0600", data, info.Mode().Perm())
+	}
+	if leftovers, _ := filepath.Glob(filepath.Join(filepath.Dir(path), ".*"+tempSuffix)); len(leftovers) > 0 {
+		t.Errorf("leftover temporary files: %v", leftovers)
+	}
+}
@@ -0,0 +1,662 @@
+package storage
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/google/uuid"
+	_ "modernc.org/sqlite"
+)
+
+// SQLiteStore is a Store backed by a single SQLite database. Uploaded
+// documents are still written beneath root so their paths stay stable.
+type SQLiteStore struct {
+	db   *sql.DB
+	path string
+	root string
+}
+
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS conversations (
+	id TEXT PRIMARY KEY,
+	created_at TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS messages (
+	seq INTEGER PRIMARY KEY AUTOINCREMENT,
+	conversation_id TEXT NOT NULL REFERENCES conversations(id) ON DELETE CASCADE,
+	id TEXT,
+	parent_id TEXT,
+	role TEXT NOT NULL,
+	content TEXT NOT NULL,
+	timestamp TEXT NOT NULL,
+	options TEXT,
+	pinned INTEGER NOT NULL DEFAULT 0,
+	rating TEXT,
+	cancelled INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE INDEX IF NOT EXISTS messages_conversation_idx ON messages (conversation_id, seq);
+
+CREATE TABLE IF NOT EXISTS settings (
+	conversation_id TEXT PRIMARY KEY REFERENCES conversations(id) ON DELETE CASCADE,
+	data TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS documents (
+	seq INTEGER PRIMARY KEY AUTOINCREMENT,
+	id TEXT NOT NULL UNIQUE,
+	conversation_id TEXT NOT NULL REFERENCES conversations(id) ON DELETE CASCADE,
+	name TEXT NOT NULL,
+	stored_path TEXT NOT NULL,
+	text_path TEXT NOT NULL,
+	size INTEGER NOT NULL,
+	uploaded_at TEXT NOT NULL,
+	tags TEXT
+);
+
+CREATE INDEX IF NOT EXISTS documents_conversation_idx ON documents (conversation_id, seq);
+
+CREATE TABLE IF NOT EXISTS transcripts (
+	seq INTEGER PRIMARY KEY AUTOINCREMENT,
+	conversation_id TEXT NOT NULL REFERENCES conversations(id) ON DELETE CASCADE,
+	content TEXT NOT NULL,
+	timestamp TEXT NOT NULL
+);
+`
+
+// NewSQLiteStore opens (creating if needed) the database at path. root is the
+// data directory under which document files are stored.
+func NewSQLiteStore(path, root string) (*SQLiteStore, error) {
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return nil, fmt.Errorf("create data directory: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("create database directory: %w", err)
+	}
+
+	dsn := fmt.Sprintf("file:%s?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_pragma=foreign_keys(1)", path)
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("open sqlite database: %w", err)
+	}
+
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("create sqlite schema: %w", err)
+	}
+	for _, column := range []struct{ table, name, definition string }{
+		{"documents", "tags", "TEXT"},
+		{"messages", "id", "TEXT"},
+		{"messages", "parent_id", "TEXT"},
+		{"messages", "pinned", "INTEGER NOT NULL DEFAULT 0"},
+		{"messages", "rating", "TEXT"},
+		{"messages", "cancelled", "INTEGER NOT NULL DEFAULT 0"},
+	} {
+		if err := addColumnIfMissing(db, column.table, column.name, column.definition); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+	if err := backfillMessageIDs(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &SQLiteStore{db: db, path: path, root: root}, nil
+}
+
+// NewReadOnlySQLiteStore opens the existing database at path without creating
+// or upgrading its schema, for commands that only inspect it. Writes through
+// the returned store fail.
+func NewReadOnlySQLiteStore(path, root string) (*SQLiteStore, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, fmt.Errorf("open sqlite database: %w", err)
+	}
+	dsn := fmt.Sprintf("file:%s?mode=ro&_pragma=busy_timeout(5000)", path)
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("open sqlite database: %w", err)
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("open sqlite database: %w", err)
+	}
+	return &SQLiteStore{db: db, path: path, root: root}, nil
+}
+
+// Close releases the database handle.
+func (s *SQLiteStore) Close() error {
+	return s.db.Close()
+}
+
+// CheckWritable verifies the database accepts writes and the data directory
+// accepts new document files.
+func (s *SQLiteStore) CheckWritable() error {
+	if _, err := s.db.Exec(`CREATE TEMP TABLE IF NOT EXISTS write_probe (x INTEGER); DROP TABLE write_probe`); err != nil {
+		return fmt.Errorf("write sqlite database: %w", err)
+	}
+	probe, err := os.CreateTemp(s.root, ".write-probe-*")
+	if err != nil {
+		return fmt.Errorf("create probe file: %w", err)
+	}
+	probe.Close()
+	return os.Remove(probe.Name())
+}
+
+// ListConversations returns the IDs of all stored conversations.
+func (s *SQLiteStore) ListConversations() ([]string, error) {
+	rows, err := s.db.Query(`SELECT id FROM conversations ORDER BY created_at`)
+	if err != nil {
+		return nil, fmt.Errorf("list conversations: %w", err)
+	}
+	defer rows.Close()
+
+	ids := []string{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("scan conversation: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// EnsureConversation records the conversation and prepares its document
+// directory if they do not already exist.
+func (s *SQLiteStore) EnsureConversation(conversationID string) error {
+	if err := os.MkdirAll(s.documentsDir(conversationID), 0o755); err != nil {
+		return fmt.Errorf("create conversation directory: %w", err)
+	}
+	if _, err := s.db.Exec(
+		`INSERT INTO conversations (id, created_at) VALUES (?, ?) ON CONFLICT (id) DO NOTHING`,
+		conversationID, formatTime(time.Now()),
+	); err != nil {
+		return fmt.Errorf("insert conversation: %w", err)
+	}
+	return nil
+}
+
+// AppendMessage adds a message to the conversation history.
+func (s *SQLiteStore) AppendMessage(conversationID string, message Message) error {
+	if err := s.EnsureConversation(conversationID); err != nil {
+		return err
+	}
+
+	if message.ID == "" {
+		message.ID = uuid.NewString()
+	}
+	options, rating, err := encodeMessageFields(message)
+	if err != nil {
+		return err
+	}
+
+	if _, err := s.db.Exec(
+		`INSERT INTO messages (conversation_id, id, parent_id, role, content, timestamp, options, pinned, rating, cancelled) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		conversationID, message.ID, message.ParentID, message.Role, message.Content, formatTime(message.Timestamp), options, message.Pinned, rating, message.Cancelled,
+	); err != nil {
+		return fmt.Errorf("insert message: %w", err)
+	}
+	return nil
+}
+
+// LoadHistory retrieves the stored conversation history in insertion order.
+func (s *SQLiteStore) LoadHistory(conversationID string) ([]Message, error) {
+	rows, err := s.db.Query(
+		`SELECT `+messageColumns+` FROM messages WHERE conversation_id = ? ORDER BY seq`,
+		conversationID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("query history: %w", err)
+	}
+	defer rows.Close()
+
+	history := []Message{}
+	for rows.Next() {
+		message, err := scanMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+		history = append(history, message)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate history: %w", err)
+	}
+	backfillIDs(conversationID, history)
+	return history, nil
+}
+
+// UpdateMessage applies update to the message with the given ID. The ID,
+// parent, role and timestamp of the message are kept. An error from update
+// aborts the change and is returned as is.
+func (s *SQLiteStore) UpdateMessage(conversationID, messageID string, update func(*Message) error) (Message, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return Message{}, fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	original, err := scanMessage(tx.QueryRow(
+		`SELECT `+messageColumns+` FROM messages WHERE conversation_id = ? AND id = ?`,
+		conversationID, messageID,
+	))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Message{}, s.messageNotFound(tx, conversationID)
+	}
+	if err != nil {
+		return Message{}, err
+	}
+
+	updated := original
+	if err := update(&updated); err != nil {
+		return Message{}, err
+	}
+	updated.ID, updated.ParentID, updated.Role, updated.Timestamp = original.ID, original.ParentID, original.Role, original.Timestamp
+
+	options, rating, err := encodeMessageFields(updated)
+	if err != nil {
+		return Message{}, err
+	}
+	if _, err := tx.Exec(
+		`UPDATE messages SET content = ?, options = ?, pinned = ?, rating = ?, cancelled = ? WHERE conversation_id = ? AND id = ?`,
+		updated.Content, options, updated.Pinned, rating, updated.Cancelled, conversationID, messageID,
+	); err != nil {
+		return Message{}, fmt.Errorf("update message: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return Message{}, fmt.Errorf("commit message: %w", err)
+	}
+	return updated, nil
+}
+
+// DeleteMessage removes the message with the given ID together with every
+// message below it and returns the IDs of the removed messages.
+func (s *SQLiteStore) DeleteMessage(conversationID, messageID string) ([]string, error) {
+	history, err := s.LoadHistory(conversationID)
+	if err != nil {
+		return nil, err
+	}
+	removed := NewTree(history).Descendants(messageID)
+	if len(removed) == 0 {
+		return nil, s.messageNotFound(s.db, conversationID)
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+	for _, id := range removed {
+		if _, err := tx.Exec(`DELETE FROM messages WHERE conversation_id = ? AND id = ?`, conversationID, id); err != nil {
+			return nil, fmt.Errorf("delete message: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("commit deletion: %w", err)
+	}
+	return removed, nil
+}
+
+// messageNotFound returns ErrConversationNotFound when the conversation does
+// not exist, as Manager does, and ErrMessageNotFound otherwise.
+func (s *SQLiteStore) messageNotFound(q rowQuerier, conversationID string) error {
+	var exists int
+	if err := q.QueryRow(`SELECT COUNT(*) FROM conversations WHERE id = ?`, conversationID).Scan(&exists); err != nil {
+		return fmt.Errorf("check conversation: %w", err)
+	}
+	if exists == 0 {
+		return ErrConversationNotFound
+	}
+	return ErrMessageNotFound
+}
+
+// messageColumns are the columns scanMessage reads.
+const messageColumns = `coalesce(id, ''), coalesce(parent_id, ''), role, content, timestamp, options, pinned, rating, cancelled`
+
+// execer is implemented by *sql.DB and *sql.Tx.
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+// rowQuerier is implemented by *sql.DB and *sql.Tx.
+type rowQuerier interface {
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// rowScanner is implemented by *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanMessage(row rowScanner) (Message, error) {
+	var (
+		message   Message
+		timestamp string
+		options   sql.NullString
+		rating    sql.NullString
+	)
+	if err := row.Scan(&message.ID, &message.ParentID, &message.Role, &message.Content, &timestamp, &options, &message.Pinned, &rating, &message.Cancelled); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Message{}, err
+		}
+		return Message{}, fmt.Errorf("scan message: %w", err)
+	}
+	var err error
+	if message.Timestamp, err = parseTime(timestamp); err != nil {
+		return Message{}, err
+	}
+	if options.Valid {
+		if err := json.Unmarshal([]byte(options.String), &message.Options); err != nil {
+			return Message{}, fmt.Errorf("decode options: %w", err)
+		}
+	}
+	if rating.Valid {
+		if err := json.Unmarshal([]byte(rating.String), &message.Rating); err != nil {
+			return Message{}, fmt.Errorf("decode rating: %w", err)
+		}
+	}
+	return message, nil
+}
+
+// encodeMessageFields returns the JSON columns of message, NULL when unset.
+func encodeMessageFields(message Message) (options, rating sql.NullString, err error) {
+	if message.Options != nil {
+		data, err := jsonString(message.Options)
+		if err != nil {
+			return options, rating, err
+		}
+		options = sql.NullString{String: data, Valid: true}
+	}
+	if message.Rating != nil {
+		data, err := jsonString(message.Rating)
+		if err != nil {
+			return options, rating, err
+		}
+		rating = sql.NullString{String: data, Valid: true}
+	}
+	return options, rating, nil
+}
+
+// backfillMessageIDs stores IDs for messages written before messages had
+// IDs, so they survive the removal of earlier messages.
+func backfillMessageIDs(db *sql.DB) error {
+	rows, err := db.Query(`SELECT DISTINCT conversation_id FROM messages WHERE id IS NULL OR id = ''`)
+	if err != nil {
+		return fmt.Errorf("find messages without IDs: %w", err)
+	}
+	var conversations []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return fmt.Errorf("scan conversation: %w", err)
+		}
+		conversations = append(conversations, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("find messages without IDs: %w", err)
+	}
+
+	for _, conversationID := range conversations {
+		if err := backfillConversationIDs(db, conversationID); err != nil {
+			return fmt.Errorf("assign message IDs in %s: %w", conversationID, err)
+		}
+	}
+	return nil
+}
+
+func backfillConversationIDs(db *sql.DB, conversationID string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`SELECT seq, coalesce(id, ''), coalesce(parent_id, '') FROM messages WHERE conversation_id = ? ORDER BY seq`, conversationID)
+	if err != nil {
+		return err
+	}
+	var (
+		seqs    []int64
+		history []Message
+	)
+	for rows.Next() {
+		var (
+			seq     int64
+			message Message
+		)
+		if err := rows.Scan(&seq, &message.ID, &message.ParentID); err != nil {
+			rows.Close()
+			return err
+		}
+		seqs = append(seqs, seq)
+		history = append(history, message)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	stored := make([]bool, len(history))
+	for i, message := range history {
+		stored[i] = message.ID != ""
+	}
+	backfillIDs(conversationID, history)
+	for i, message := range history {
+		if stored[i] {
+			continue
+		}
+		if _, err := tx.Exec(`UPDATE messages SET id = ?, parent_id = ? WHERE seq = ?`, message.ID, message.ParentID, seqs[i]); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// LoadSettings retrieves the conversation settings, defaulting to zero values.
+func (s *SQLiteStore) LoadSettings(conversationID string) (Settings, error) {
+	var data string
+	err := s.db.QueryRow(`SELECT data FROM settings WHERE conversation_id = ?`, conversationID).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Settings{}, nil
+	}
+	if err != nil {
+		return Settings{}, fmt.Errorf("query settings: %w", err)
+	}
+
+	var settings Settings
+	if err := json.Unmarshal([]byte(data), &settings); err != nil {
+		return Settings{}, fmt.Errorf("decode settings: %w", err)
+	}
+	return settings, nil
+}
+
+// SaveSettings replaces the conversation settings.
+func (s *SQLiteStore) SaveSettings(conversationID string, settings Settings) error {
+	if err := s.EnsureConversation(conversationID); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(settings)
+	if err != nil {
+		return fmt.Errorf("encode settings: %w", err)
+	}
+	if _, err := s.db.Exec(
+		`INSERT INTO settings (conversation_id, data) VALUES (?, ?)
+		 ON CONFLICT (conversation_id) DO UPDATE SET data = excluded.data`,
+		conversationID, string(data),
+	); err != nil {
+		return fmt.Errorf("write settings: %w", err)
+	}
+	return nil
+}
+
+// SaveTranscript stores the assistant's response and returns a reference of
+// the form sqlite:<db path>#transcripts/<seq>.
+func (s *SQLiteStore) SaveTranscript(conversationID, content string, timestamp time.Time) (string, error) {
+	if err := s.EnsureConversation(conversationID); err != nil {
+		return "", err
+	}
+
+	result, err := s.db.Exec(
+		`INSERT INTO transcripts (conversation_id, content, timestamp) VALUES (?, ?, ?)`,
+		conversationID, content, formatTime(timestamp),
+	)
+	if err != nil {
+		return "", fmt.Errorf("insert transcript: %w", err)
+	}
+	seq, err := result.LastInsertId()
+	if err != nil {
+		return "", fmt.Errorf("transcript id: %w", err)
+	}
+	return fmt.Sprintf("sqlite:%s#transcripts/%d", s.path, seq), nil
+}
+
+// SaveDocument stores an uploaded file and its extracted text on disk and
+// records the metadata in the database.
+func (s *SQLiteStore) SaveDocument(conversationID, originalName string, data []byte, tags []string) (Document, error) {
+	if err := s.EnsureConversation(conversationID); err != nil {
+		return Document{}, err
+	}
+
+	document, err := writeDocumentFiles(s.documentsDir(conversationID), originalName, data, tags)
+	if err != nil {
+		return Document{}, err
+	}
+
+	if err := insertDocument(s.db, conversationID, document); err != nil {
+		return Document{}, err
+	}
+	return document, nil
+}
+
+// ListDocuments returns metadata for all documents of the conversation.
+func (s *SQLiteStore) ListDocuments(conversationID string) ([]Document, error) {
+	rows, err := s.db.Query(
+		`SELECT id, name, stored_path, text_path, size, uploaded_at, tags FROM documents WHERE conversation_id = ? ORDER BY seq`,
+		conversationID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("query documents: %w", err)
+	}
+	defer rows.Close()
+
+	docs := []Document{}
+	for rows.Next() {
+		var (
+			doc        Document
+			uploadedAt string
+			tags       sql.NullString
+		)
+		if err := rows.Scan(&doc.ID, &doc.Name, &doc.StoredPath, &doc.TextPath, &doc.Size, &uploadedAt, &tags); err != nil {
+			return nil, fmt.Errorf("scan document: %w", err)
+		}
+		if doc.UploadedAt, err = parseTime(uploadedAt); err != nil {
+			return nil, err
+		}
+		if tags.Valid {
+			if err := json.Unmarshal([]byte(tags.String), &doc.Tags); err != nil {
+				return nil, fmt.Errorf("decode document tags: %w", err)
+			}
+		}
+		docs = append(docs, doc)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate documents: %w", err)
+	}
+
+	fillContentCache(docs)
+	return docs, nil
+}
+
+// LoadDocumentTexts returns the extracted text of all documents.
+func (s *SQLiteStore) LoadDocumentTexts(conversationID string) ([]string, error) {
+	docs, err := s.ListDocuments(conversationID)
+	if err != nil {
+		return nil, err
+	}
+	return readDocumentTexts(docs)
+}
+
+// DocumentText returns the extracted text for a specific document.
+func (s *SQLiteStore) DocumentText(doc Document) (string, error) {
+	return documentText(doc)
+}
+
+// insertDocument records doc through s.db or an import transaction.
+func insertDocument(e execer, conversationID string, doc Document) error {
+	var tags sql.NullString
+	if len(doc.Tags) > 0 {
+		encoded, err := jsonString(doc.Tags)
+		if err != nil {
+			return err
+		}
+		tags = sql.NullString{String: encoded, Valid: true}
+	}
+	if _, err := e.Exec(
+		`INSERT INTO documents (id, conversation_id, name, stored_path, text_path, size, uploaded_at, tags) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		doc.ID, conversationID, doc.Name, doc.StoredPath, doc.TextPath, doc.Size, formatTime(doc.UploadedAt), tags,
+	); err != nil {
+		return fmt.Errorf("insert document: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLiteStore) documentsDir(conversationID string) string {
+	return filepath.Join(s.root, "conversations", conversationID, "documents")
+}
+
+// addColumnIfMissing upgrades tables created by earlier releases, since
+// CREATE TABLE IF NOT EXISTS leaves existing tables untouched.
+func addColumnIfMissing(db *sql.DB, table, column, definition string) error {
+	rows, err := db.Query(fmt.Sprintf(`SELECT name FROM pragma_table_info('%s')`, table))
+	if err != nil {
+		return fmt.Errorf("inspect %s table: %w", table, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return fmt.Errorf("inspect %s table: %w", table, err)
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("inspect %s table: %w", table, err)
+	}
+
+	if _, err := db.Exec(fmt.Sprintf(`ALTER TABLE %s ADD COLUMN %s %s`, table, column, definition)); err != nil {
+		return fmt.Errorf("add %s.%s: %w", table, column, err)
+	}
+	return nil
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+func parseTime(value string) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("parse timestamp %q: %w", value, err)
+	}
+	return t, nil
+}
+
+func jsonString(value any) (string, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return "", fmt.Errorf("encode %T: %w", value, err)
+	}
+	return string(data), nil
+}
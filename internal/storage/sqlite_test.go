@@ -0,0 +1,190 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/fabfab/airplane-chat/internal/llm"
+)
+
+func newTestSQLiteStore(t *testing.T) *SQLiteStore {
+	t.Helper()
+	root := t.TempDir()
+	s, err := NewSQLiteStore(filepath.Join(root, "chat.db"), root)
+	if err != nil {
+		t.Fatalf("NewSQLiteStore: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestReadOnlySQLiteStore(t *testing.T) {
+	s := newTestSQLiteStore(t)
+	if _, err := s.SaveDocument("c", "notes.txt", []byte("hello"), nil); err != nil {
+		t.Fatalf("SaveDocument: %v", err)
+	}
+
+	ro, err := NewReadOnlySQLiteStore(s.path, s.root)
+	if err != nil {
+		t.Fatalf("NewReadOnlySQLiteStore: %v", err)
+	}
+	defer ro.Close()
+
+	documents, err := ro.ListDocuments("c")
+	if err != nil || len(documents) != 1 {
+		t.Errorf("ListDocuments = %v, %v; want the stored document", documents, err)
+	}
+	if err := ro.AppendMessage("c", Message{Role: "user", Content: "hi"}); err == nil {
+		t.Error("AppendMessage succeeded on a read-only store")
+	}
+
+	if _, err := NewReadOnlySQLiteStore(filepath.Join(s.root, "missing.db"), s.root); err == nil {
+		t.Error("NewReadOnlySQLiteStore created a missing database")
+	}
+}
+
+// exercise runs the same operations against store and records what it
+// observes, so two Store implementations can be compared.
+func exercise(t *testing.T, store Store) []string {
+	t.Helper()
+	var log []string
+	record := func(label string, values ...any) {
+		data, err := json.Marshal(values)
+		if err != nil {
+			t.Fatalf("encode %s: %v", label, err)
+		}
+		log = append(log, label+" "+string(data))
+	}
+
+	at := time.Date(2024, 5, 1, 12, 30, 0, 123456789, time.UTC)
+	temperature := 0.3
+	for _, message := range []Message{
+		{ID: "q1", Role: "user", Content: "question", Timestamp: at},
+		{ID: "a1", ParentID: "q1", Role: "assistant", Content: "answer", Timestamp: at, Options: &llm.Options{Temperature: &temperature}},
+		{ID: "a2", ParentID: "q1", Role: "assistant", Timestamp: at, Cancelled: true},
+		{ID: "q2", ParentID: "a1", Role: "user", Content: "follow-up", Timestamp: at},
+	} {
+		if err := store.AppendMessage("c", message); err != nil {
+			t.Fatalf("AppendMessage: %v", err)
+		}
+	}
+	ids, err := store.ListConversations()
+	record("conversations", ids, err)
+	history, err := store.LoadHistory("c")
+	record("history", history, err)
+
+	rating := Rating{Value: "up", Comment: "good", RatedAt: at}
+	updated, err := store.UpdateMessage("c", "a1", func(m *Message) error {
+		m.Pinned, m.Rating, m.ID = true, &rating, "renamed"
+		return nil
+	})
+	record("update", updated, err)
+	_, err = store.UpdateMessage("c", "a1", func(*Message) error { return errors.New("refused") })
+	record("refused update", err.Error())
+	_, err = store.UpdateMessage("c", "missing", func(*Message) error { return nil })
+	record("update missing", errors.Is(err, ErrMessageNotFound))
+	_, err = store.UpdateMessage("nope", "a1", func(*Message) error { return nil })
+	record("update in missing conversation", errors.Is(err, ErrConversationNotFound))
+
+	removed, err := store.DeleteMessage("c", "a1")
+	record("delete", removed, err)
+	_, err = store.DeleteMessage("c", "a1")
+	record("delete again", errors.Is(err, ErrMessageNotFound))
+	_, err = store.DeleteMessage("nope", "a1")
+	record("delete in missing conversation", errors.Is(err, ErrConversationNotFound))
+	history, err = store.LoadHistory("c")
+	record("history after delete", history, err)
+	history, err = store.LoadHistory("nope")
+	record("history of missing conversation", history, err)
+
+	settings, err := store.LoadSettings("c")
+	record("default settings", settings, err)
+	if err := store.SaveSettings("c", Settings{Options: llm.Options{Temperature: &temperature}}); err != nil {
+		t.Fatalf("SaveSettings: %v", err)
+	}
+	settings, err = store.LoadSettings("c")
+	record("settings", settings, err)
+
+	if _, err := store.SaveDocument("c", "Notes.MD", []byte("# Notes\nbody"), []string{"Ops", "ops", " runbook "}); err != nil {
+		t.Fatalf("SaveDocument: %v", err)
+	}
+	_, err = store.SaveDocument("c", "image.png", []byte("png"), nil)
+	record("unsupported document", errors.Is(err, ErrUnsupportedFileType))
+	documents, err := store.ListDocuments("c")
+	if err != nil || len(documents) != 1 {
+		t.Fatalf("ListDocuments = %v, %v", documents, err)
+	}
+	text, err := store.DocumentText(documents[0])
+	record("document", documents[0].Name, documents[0].Size, documents[0].Tags, text, err)
+	texts, err := store.LoadDocumentTexts("c")
+	record("document texts", texts, err)
+
+	return log
+}
+
+func TestSQLiteStoreMatchesManager(t *testing.T) {
+	want := exercise(t, newTestManager(t))
+	got := exercise(t, newTestSQLiteStore(t))
+	for i := range max(len(want), len(got)) {
+		var w, g string
+		if i < len(want) {
+			w = want[i]
+		}
+		if i < len(got) {
+			g = got[i]
+		}
+		if w != g {
+			t.Errorf("SQLiteStore: %s\nManager:     %s", g, w)
+		}
+	}
+}
+
+func TestImportFiles(t *testing.T) {
+	src := newTestManager(t)
+	at := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	appendMessages(t, src, "c", "one", "two")
+	if err := src.SaveSettings("c", Settings{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := src.SaveDocument("c", "notes.txt", []byte("hello"), []string{"ops"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := src.SaveTranscript("c", "two", at); err != nil {
+		t.Fatal(err)
+	}
+	if err := src.EnsureConversation("empty"); err != nil {
+		t.Fatal(err)
+	}
+
+	dst := newTestSQLiteStore(t)
+	report, err := ImportFiles(src, dst)
+	if err != nil {
+		t.Fatalf("ImportFiles: %v", err)
+	}
+	if report.Conversations != 2 || report.Messages != 2 || report.Documents != 1 || report.Transcripts != 1 {
+		t.Errorf("report = %+v", report)
+	}
+
+	want, _ := src.LoadHistory("c")
+	got, err := dst.LoadHistory("c")
+	if err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("imported history = %+v, %v; want %+v", got, err, want)
+	}
+	documents, _ := dst.ListDocuments("c")
+	if len(documents) != 1 || documents[0].Name != "notes.txt" || fmt.Sprint(documents[0].Tags) != "[ops]" {
+		t.Errorf("imported documents = %+v", documents)
+	}
+	if text, err := dst.DocumentText(documents[0]); err != nil || text != "hello" {
+		t.Errorf("imported document text = %q, %v", text, err)
+	}
+
+	again, err := ImportFiles(src, dst)
+	if err != nil || again.Conversations != 0 || again.Skipped != 2 {
+		t.Errorf("second import = %+v, %v; want both conversations skipped", again, err)
+	}
+}
@@ -6,18 +6,61 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/google/uuid"
+
+	"github.com/fabfab/airplane-chat/internal/llm"
 )
 
 // Message represents a single conversation turn stored in history.json.
+// ParentID links it to the message it follows; messages sharing a parent are
+// alternative versions created by edits and regenerations.
 type Message struct {
+	ID        string    `json:"id"`
+	ParentID  string    `json:"parent_id,omitempty"`
 	Role      string    `json:"role"`
 	Content   string    `json:"content"`
 	Timestamp time.Time `json:"timestamp"`
+	// Options records the effective generation options used to produce an
+	// assistant message so the answer can be reproduced.
+	Options *llm.Options `json:"options,omitempty"`
+	// Pinned marks a message the user wants to find again.
+	Pinned bool `json:"pinned,omitempty"`
+	// Rating is the user's verdict on an assistant message.
+	Rating *Rating `json:"rating,omitempty"`
+	// Cancelled marks an assistant message whose generation was cancelled.
+	// It has no content and is left out of later prompts.
+	Cancelled bool `json:"cancelled,omitempty"`
+}
+
+// Rating is a thumbs up or down on an answer, with an optional comment.
+type Rating struct {
+	Value   string    `json:"value"`
+	Comment string    `json:"comment,omitempty"`
+	RatedAt time.Time `json:"rated_at"`
+}
+
+// Rating values.
+const (
+	RatingUp   = "up"
+	RatingDown = "down"
+)
+
+// Validate reports whether the rating is a thumbs up or down.
+func (r Rating) Validate() error {
+	if r.Value != RatingUp && r.Value != RatingDown {
+		return fmt.Errorf("rating must be %q or %q", RatingUp, RatingDown)
+	}
+	return nil
+}
+
+// Settings holds per-conversation preferences stored in settings.json.
+type Settings struct {
+	Options llm.Options `json:"options"`
 }
 
 // Document holds metadata about an uploaded document that can be reused for
@@ -29,6 +72,7 @@ type Document struct {
 	TextPath     string    `json:"text_path"`
 	Size         int64     `json:"size"`
 	UploadedAt   time.Time `json:"uploaded_at"`
+	Tags         []string  `json:"tags,omitempty"`
 	ContentCache string    `json:"-"` // populated on load to avoid repeat disk reads
 }
 
@@ -37,25 +81,82 @@ type Document struct {
 type Manager struct {
 	root string
 
-	mu    sync.Mutex
-	locks map[string]*sync.Mutex
+	mu       sync.Mutex
+	locks    map[string]*sync.Mutex
+	journals map[string]journalState
 }
 
 // ErrUnsupportedFileType is returned when a document with an unsupported
 // extension is uploaded.
 var ErrUnsupportedFileType = errors.New("unsupported file type")
 
+// ErrDocumentNotFound is returned when a conversation has no document with
+// the requested ID.
+var ErrDocumentNotFound = errors.New("document not found")
+
+// ErrMessageNotFound is returned when a conversation has no message with the
+// requested ID.
+var ErrMessageNotFound = errors.New("message not found")
+
+// ErrConversationNotFound is returned when a change is made to a conversation
+// that does not exist.
+var ErrConversationNotFound = errors.New("conversation not found")
+
 // NewManager initialises a Manager rooted at the provided directory.
 func NewManager(root string) (*Manager, error) {
 	if err := os.MkdirAll(root, 0o755); err != nil {
 		return nil, fmt.Errorf("create data directory: %w", err)
 	}
 	return &Manager{
-		root:  root,
-		locks: make(map[string]*sync.Mutex),
+		root:     root,
+		locks:    make(map[string]*sync.Mutex),
+		journals: make(map[string]journalState),
 	}, nil
 }
 
+// CheckWritable verifies the data directory accepts new files by creating and
+// removing a probe file.
+func (m *Manager) CheckWritable() error {
+	probe, err := os.CreateTemp(m.root, ".write-probe-*")
+	if err != nil {
+		return fmt.Errorf("create probe file: %w", err)
+	}
+	name := probe.Name()
+	if err := probe.Close(); err != nil {
+		os.Remove(name)
+		return fmt.Errorf("close probe file: %w", err)
+	}
+	if err := os.Remove(name); err != nil {
+		return fmt.Errorf("remove probe file: %w", err)
+	}
+	return nil
+}
+
+// Close is a no-op; Manager holds no open resources.
+func (m *Manager) Close() error {
+	return nil
+}
+
+// ListConversations returns the IDs of all conversations with a directory
+// under the data root.
+func (m *Manager) ListConversations() ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(m.root, "conversations"))
+	if errors.Is(err, os.ErrNotExist) {
+		return []string{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("list conversations: %w", err)
+	}
+
+	ids := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() {
+			ids = append(ids, entry.Name())
+		}
+	}
+	return ids, nil
+}
+
 // EnsureConversation prepares the directory structure for the requested
 // conversation ID if it does not already exist.
 func (m *Manager) EnsureConversation(conversationID string) error {
@@ -75,40 +176,145 @@ func (m *Manager) EnsureConversation(conversationID string) error {
 	return nil
 }
 
-// AppendMessage adds a message to the conversation history.
+// AppendMessage adds a message to the conversation history. The message is
+// appended to history.journal; every journalCompactEvery messages the journal
+// is folded into history.json.
 func (m *Manager) AppendMessage(conversationID string, message Message) error {
 	if err := m.EnsureConversation(conversationID); err != nil {
 		return err
 	}
 
-	lock := m.lockFor(conversationID)
-	lock.Lock()
-	defer lock.Unlock()
+	if message.ID == "" {
+		message.ID = uuid.NewString()
+	}
 
-	history, err := m.LoadHistory(conversationID)
+	unlock, err := m.lockConversation(conversationID)
 	if err != nil {
 		return err
 	}
+	defer unlock()
 
-	history = append(history, message)
+	state, err := m.journalState(conversationID)
+	if err != nil {
+		return err
+	}
+	if err := appendJournal(m.journalPath(conversationID), journalEntry{Seq: state.next, Message: message}); err != nil {
+		return err
+	}
+	state.next++
+	state.entries++
 
-	data, err := json.MarshalIndent(history, "", "  ")
+	if state.entries >= journalCompactEvery {
+		history, err := m.readHistory(conversationID)
+		if err != nil {
+			return err
+		}
+		return m.compactHistory(conversationID, history)
+	}
+	return m.rememberJournal(conversationID, state)
+}
+
+// LoadHistory retrieves the stored conversation history: the history.json
+// snapshot followed by any journaled messages, in the order they were added.
+// Missing files are treated as an empty conversation.
+func (m *Manager) LoadHistory(conversationID string) ([]Message, error) {
+	history, err := m.readHistory(conversationID)
 	if err != nil {
-		return fmt.Errorf("encode history: %w", err)
+		return nil, err
 	}
+	backfillIDs(conversationID, history)
+	return history, nil
+}
 
-	if err := os.WriteFile(m.historyPath(conversationID), data, 0o644); err != nil {
-		return fmt.Errorf("write history: %w", err)
+// readHistory returns the snapshot followed by the journaled messages, as
+// stored.
+func (m *Manager) readHistory(conversationID string) ([]Message, error) {
+	history, err := m.loadSnapshot(conversationID)
+	if err != nil {
+		return nil, err
+	}
+	entries, _, err := readJournal(m.journalPath(conversationID))
+	if err != nil {
+		return nil, err
 	}
+	return replayJournal(history, entries), nil
+}
 
-	return nil
+// UpdateMessage applies update to the message with the given ID and rewrites
+// history.json. The ID, parent, role and timestamp of the message are kept.
+// An error from update aborts the change and is returned as is.
+func (m *Manager) UpdateMessage(conversationID, messageID string, update func(*Message) error) (Message, error) {
+	unlock, err := m.lockConversation(conversationID)
+	if err != nil {
+		return Message{}, err
+	}
+	defer unlock()
+
+	history, err := m.LoadHistory(conversationID)
+	if err != nil {
+		return Message{}, err
+	}
+	for i := range history {
+		if history[i].ID != messageID {
+			continue
+		}
+		updated := history[i]
+		if err := update(&updated); err != nil {
+			return Message{}, err
+		}
+		updated.ID, updated.ParentID, updated.Role, updated.Timestamp = history[i].ID, history[i].ParentID, history[i].Role, history[i].Timestamp
+		history[i] = updated
+		if err := m.compactHistory(conversationID, history); err != nil {
+			return Message{}, err
+		}
+		return updated, nil
+	}
+	return Message{}, ErrMessageNotFound
 }
 
-// LoadHistory retrieves the stored conversation history. Missing history files
-// are treated as an empty conversation.
-func (m *Manager) LoadHistory(conversationID string) ([]Message, error) {
-	path := m.historyPath(conversationID)
-	data, err := os.ReadFile(path)
+// DeleteMessage removes the message with the given ID together with every
+// message below it, such as the answers to a deleted question, and rewrites
+// history.json. It returns the IDs of the removed messages.
+func (m *Manager) DeleteMessage(conversationID, messageID string) ([]string, error) {
+	unlock, err := m.lockConversation(conversationID)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	history, err := m.LoadHistory(conversationID)
+	if err != nil {
+		return nil, err
+	}
+	removed := NewTree(history).Descendants(messageID)
+	if len(removed) == 0 {
+		return nil, ErrMessageNotFound
+	}
+
+	// Replay only skips journal entries the snapshot's length covers, so a
+	// shorter snapshot next to the old journal could bring journaled
+	// messages, deleted ones included, back after a crash. Fold the journal
+	// in first.
+	if _, err := os.Stat(m.journalPath(conversationID)); err == nil {
+		if err := m.compactHistory(conversationID, history); err != nil {
+			return nil, err
+		}
+	}
+
+	kept := make([]Message, 0, len(history)-len(removed))
+	for _, message := range history {
+		if !slices.Contains(removed, message.ID) {
+			kept = append(kept, message)
+		}
+	}
+	if err := m.compactHistory(conversationID, kept); err != nil {
+		return nil, err
+	}
+	return removed, nil
+}
+
+func (m *Manager) loadSnapshot(conversationID string) ([]Message, error) {
+	data, err := os.ReadFile(m.historyPath(conversationID))
 	if errors.Is(err, os.ErrNotExist) {
 		return []Message{}, nil
 	}
@@ -124,6 +330,65 @@ func (m *Manager) LoadHistory(conversationID string) ([]Message, error) {
 	return history, nil
 }
 
+// compactHistory atomically rewrites history.json with the full history and
+// then drops the journal. A crash in between is harmless as long as history
+// did not shrink: replay skips journal entries whose sequence is already
+// covered by the snapshot. Callers removing messages empty the journal first.
+func (m *Manager) compactHistory(conversationID string, history []Message) error {
+	data, err := json.MarshalIndent(history, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode history: %w", err)
+	}
+
+	if err := writeFileAtomic(m.historyPath(conversationID), data, 0o644); err != nil {
+		return fmt.Errorf("write history: %w", err)
+	}
+	if err := os.Remove(m.journalPath(conversationID)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("remove journal: %w", err)
+	}
+	return m.rememberJournal(conversationID, journalState{next: len(history)})
+}
+
+// LoadSettings retrieves the conversation settings. A missing settings file
+// yields zero-value settings.
+func (m *Manager) LoadSettings(conversationID string) (Settings, error) {
+	data, err := os.ReadFile(m.settingsPath(conversationID))
+	if errors.Is(err, os.ErrNotExist) {
+		return Settings{}, nil
+	}
+	if err != nil {
+		return Settings{}, fmt.Errorf("read settings: %w", err)
+	}
+
+	var settings Settings
+	if err := json.Unmarshal(data, &settings); err != nil {
+		return Settings{}, fmt.Errorf("decode settings: %w", err)
+	}
+	return settings, nil
+}
+
+// SaveSettings replaces the conversation settings.
+func (m *Manager) SaveSettings(conversationID string, settings Settings) error {
+	if err := m.EnsureConversation(conversationID); err != nil {
+		return err
+	}
+
+	unlock, err := m.lockConversation(conversationID)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	data, err := json.MarshalIndent(settings, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode settings: %w", err)
+	}
+	if err := writeFileAtomic(m.settingsPath(conversationID), data, 0o644); err != nil {
+		return fmt.Errorf("write settings: %w", err)
+	}
+	return nil
+}
+
 // SaveTranscript writes the assistant's response to a markdown file for later
 // reference.
 func (m *Manager) SaveTranscript(conversationID, content string, timestamp time.Time) (string, error) {
@@ -137,12 +402,12 @@ func (m *Manager) SaveTranscript(conversationID, content string, timestamp time.
 	body := strings.Builder{}
 	body.WriteString("---\n")
 	body.WriteString(fmt.Sprintf("conversation_id: %s\n", conversationID))
-	body.WriteString(fmt.Sprintf("timestamp: %s\n", timestamp.Format(time.RFC3339)))
+	body.WriteString(fmt.Sprintf("%s%s\n", transcriptTimestampKey, timestamp.Format(time.RFC3339)))
 	body.WriteString("---\n\n")
 	body.WriteString(content)
 	body.WriteString("\n")
 
-	if err := os.WriteFile(path, []byte(body.String()), 0o644); err != nil {
+	if err := writeFileAtomic(path, []byte(body.String()), 0o644); err != nil {
 		return "", fmt.Errorf("write transcript: %w", err)
 	}
 
@@ -150,49 +415,21 @@ func (m *Manager) SaveTranscript(conversationID, content string, timestamp time.
 }
 
 // SaveDocument stores an uploaded file and its extracted text representation.
-func (m *Manager) SaveDocument(conversationID, originalName string, data []byte) (Document, error) {
+func (m *Manager) SaveDocument(conversationID, originalName string, data []byte, tags []string) (Document, error) {
 	if err := m.EnsureConversation(conversationID); err != nil {
 		return Document{}, err
 	}
 
-	ext := strings.ToLower(filepath.Ext(originalName))
-	if ext == "" {
-		ext = ".txt"
-	}
-	if !isSupportedExtension(ext) {
-		return Document{}, ErrUnsupportedFileType
-	}
-
-	docID := uuid.NewString()
-	now := time.Now().UTC()
-
-	// We always store the exact bytes that were uploaded so the user can
-	// download them later if desired.
-	storedName := fmt.Sprintf("%s%s", docID, ext)
-	storedPath := filepath.Join(m.conversationDir(conversationID), "documents", storedName)
-	if err := os.WriteFile(storedPath, data, 0o644); err != nil {
-		return Document{}, fmt.Errorf("write document: %w", err)
-	}
-
-	text := extractText(ext, data)
-	textPath := filepath.Join(m.conversationDir(conversationID), "documents", docID+".txt")
-	if err := os.WriteFile(textPath, []byte(text), 0o644); err != nil {
-		return Document{}, fmt.Errorf("write extracted text: %w", err)
+	document, err := writeDocumentFiles(filepath.Join(m.conversationDir(conversationID), "documents"), originalName, data, tags)
+	if err != nil {
+		return Document{}, err
 	}
 
-	document := Document{
-		ID:           docID,
-		Name:         originalName,
-		StoredPath:   storedPath,
-		TextPath:     textPath,
-		Size:         int64(len(data)),
-		UploadedAt:   now,
-		ContentCache: text,
+	unlock, err := m.lockConversation(conversationID)
+	if err != nil {
+		return Document{}, err
 	}
-
-	lock := m.lockFor(conversationID)
-	lock.Lock()
-	defer lock.Unlock()
+	defer unlock()
 
 	documents, err := m.loadDocuments(conversationID)
 	if err != nil {
@@ -218,14 +455,7 @@ func (m *Manager) ListDocuments(conversationID string) ([]Document, error) {
 		return nil, err
 	}
 
-	for i := range docs {
-		if docs[i].ContentCache == "" {
-			if data, err := os.ReadFile(docs[i].TextPath); err == nil {
-				docs[i].ContentCache = string(data)
-			}
-		}
-	}
-
+	fillContentCache(docs)
 	return docs, nil
 }
 
@@ -236,29 +466,12 @@ func (m *Manager) LoadDocumentTexts(conversationID string) ([]string, error) {
 	if err != nil {
 		return nil, err
 	}
-
-	var texts []string
-	for _, doc := range docs {
-		data, err := os.ReadFile(doc.TextPath)
-		if err != nil {
-			return nil, fmt.Errorf("read document text: %w", err)
-		}
-		texts = append(texts, string(data))
-	}
-	return texts, nil
+	return readDocumentTexts(docs)
 }
 
 // DocumentText returns the extracted text for a specific document.
 func (m *Manager) DocumentText(doc Document) (string, error) {
-	if doc.ContentCache != "" {
-		return doc.ContentCache, nil
-	}
-
-	data, err := os.ReadFile(doc.TextPath)
-	if err != nil {
-		return "", fmt.Errorf("read document text: %w", err)
-	}
-	return string(data), nil
+	return documentText(doc)
 }
 
 func (m *Manager) loadDocuments(conversationID string) ([]Document, error) {
@@ -283,25 +496,12 @@ func (m *Manager) saveDocuments(conversationID string, documents []Document) err
 	if err != nil {
 		return fmt.Errorf("encode documents: %w", err)
 	}
-	if err := os.WriteFile(m.documentsPath(conversationID), data, 0o644); err != nil {
+	if err := writeFileAtomic(m.documentsPath(conversationID), data, 0o644); err != nil {
 		return fmt.Errorf("write documents: %w", err)
 	}
 	return nil
 }
 
-func (m *Manager) lockFor(conversationID string) *sync.Mutex {
-	m.mu.Lock()
-	defer m.mu.Unlock()
-
-	if lock, ok := m.locks[conversationID]; ok {
-		return lock
-	}
-
-	lock := &sync.Mutex{}
-	m.locks[conversationID] = lock
-	return lock
-}
-
 func (m *Manager) conversationDir(conversationID string) string {
 	return filepath.Join(m.root, "conversations", conversationID)
 }
@@ -310,10 +510,151 @@ func (m *Manager) historyPath(conversationID string) string {
 	return filepath.Join(m.conversationDir(conversationID), "history.json")
 }
 
+func (m *Manager) journalPath(conversationID string) string {
+	return filepath.Join(m.conversationDir(conversationID), "history.journal")
+}
+
 func (m *Manager) documentsPath(conversationID string) string {
 	return filepath.Join(m.conversationDir(conversationID), "documents.json")
 }
 
+func (m *Manager) settingsPath(conversationID string) string {
+	return filepath.Join(m.conversationDir(conversationID), "settings.json")
+}
+
+// writeDocumentFiles stores the uploaded bytes and their extracted text in dir
+// and returns the resulting document metadata.
+func writeDocumentFiles(dir, originalName string, data []byte, tags []string) (Document, error) {
+	ext := strings.ToLower(filepath.Ext(originalName))
+	if ext == "" {
+		ext = ".txt"
+	}
+	if !isSupportedExtension(ext) {
+		return Document{}, ErrUnsupportedFileType
+	}
+
+	docID := uuid.NewString()
+	now := time.Now().UTC()
+
+	// We always store the exact bytes that were uploaded so the user can
+	// download them later if desired.
+	storedName := fmt.Sprintf("%s%s", docID, ext)
+	storedPath := filepath.Join(dir, storedName)
+	if err := writeFileAtomic(storedPath, data, 0o644); err != nil {
+		return Document{}, fmt.Errorf("write document: %w", err)
+	}
+
+	text := extractText(ext, data)
+	textPath := filepath.Join(dir, docID+".txt")
+	if err := writeFileAtomic(textPath, []byte(text), 0o644); err != nil {
+		return Document{}, fmt.Errorf("write extracted text: %w", err)
+	}
+
+	return Document{
+		ID:           docID,
+		Name:         originalName,
+		StoredPath:   storedPath,
+		TextPath:     textPath,
+		Size:         int64(len(data)),
+		UploadedAt:   now,
+		Tags:         NormalizeTags(tags),
+		ContentCache: text,
+	}, nil
+}
+
+// NormalizeTags lowercases and trims tags, dropping empty and duplicate ones.
+func NormalizeTags(tags []string) []string {
+	var normalized []string
+	seen := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+	return normalized
+}
+
+func fillContentCache(docs []Document) {
+	for i := range docs {
+		if docs[i].ContentCache == "" {
+			if data, err := os.ReadFile(docs[i].TextPath); err == nil {
+				docs[i].ContentCache = string(data)
+			}
+		}
+	}
+}
+
+func readDocumentTexts(docs []Document) ([]string, error) {
+	var texts []string
+	for _, doc := range docs {
+		data, err := os.ReadFile(doc.TextPath)
+		if err != nil {
+			return nil, fmt.Errorf("read document text: %w", err)
+		}
+		texts = append(texts, string(data))
+	}
+	return texts, nil
+}
+
+func documentText(doc Document) (string, error) {
+	if doc.ContentCache != "" {
+		return doc.ContentCache, nil
+	}
+
+	data, err := os.ReadFile(doc.TextPath)
+	if err != nil {
+		return "", fmt.Errorf("read document text: %w", err)
+	}
+	return string(data), nil
+}
+
+// FindDocument returns the document of a conversation with the given ID.
+func FindDocument(store Store, conversationID, documentID string) (Document, error) {
+	documents, err := store.ListDocuments(conversationID)
+	if err != nil {
+		return Document{}, err
+	}
+	for _, doc := range documents {
+		if doc.ID == documentID {
+			return doc, nil
+		}
+	}
+	return Document{}, ErrDocumentNotFound
+}
+
+// FindMessage returns the message of a conversation with the given ID.
+func FindMessage(store Store, conversationID, messageID string) (Message, error) {
+	history, err := store.LoadHistory(conversationID)
+	if err != nil {
+		return Message{}, err
+	}
+	for _, message := range history {
+		if message.ID == messageID {
+			return message, nil
+		}
+	}
+	return Message{}, ErrMessageNotFound
+}
+
+// ReextractText extracts the text of a document again from its stored
+// original and rewrites the extracted copy, so documents uploaded before an
+// extractor change pick it up.
+func ReextractText(doc Document) (string, error) {
+	data, err := os.ReadFile(doc.StoredPath)
+	if err != nil {
+		return "", fmt.Errorf("read stored document: %w", err)
+	}
+
+	text := extractText(filepath.Ext(doc.StoredPath), data)
+	if err := writeFileAtomic(doc.TextPath, []byte(text), 0o644); err != nil {
+		return "", fmt.Errorf("write extracted text: %w", err)
+	}
+	return text, nil
+}
+
 func isSupportedExtension(ext string) bool {
 	switch strings.ToLower(ext) {
 	case ".txt", ".md", ".markdown":
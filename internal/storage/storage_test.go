@@ -0,0 +1,83 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+)
+
+func TestDeleteMessageRemovesDescendants(t *testing.T) {
+	m := newTestManager(t)
+	for _, message := range []Message{
+		{ID: "q1", Role: "user", Content: "q1"},
+		{ID: "a1", ParentID: "q1", Role: "assistant", Content: "a1"},
+		{ID: "q2", ParentID: "a1", Role: "user", Content: "q2"},
+		{ID: "q3", Role: "user", Content: "q3"},
+	} {
+		if err := m.AppendMessage("c", message); err != nil {
+			t.Fatalf("AppendMessage: %v", err)
+		}
+	}
+
+	removed, err := m.DeleteMessage("c", "a1")
+	if err != nil {
+		t.Fatalf("DeleteMessage: %v", err)
+	}
+	if fmt.Sprint(removed) != "[a1 q2]" {
+		t.Errorf("removed = %v, want [a1 q2]", removed)
+	}
+	if _, err := os.Stat(m.journalPath("c")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("journal left behind after delete: %v", err)
+	}
+	if got := historyContents(t, m, "c"); fmt.Sprint(got) != "[q1 q3]" {
+		t.Errorf("history = %v, want [q1 q3]", got)
+	}
+
+	appendMessages(t, m, "c", "q4")
+	if got := historyContents(t, m, "c"); fmt.Sprint(got) != "[q1 q3 q4]" {
+		t.Errorf("history after append = %v, want [q1 q3 q4]", got)
+	}
+
+	if _, err := m.DeleteMessage("c", "a1"); !errors.Is(err, ErrMessageNotFound) {
+		t.Errorf("deleting a removed message: %v, want ErrMessageNotFound", err)
+	}
+}
+
+func TestUpdateMessageKeepsIdentity(t *testing.T) {
+	m := newTestManager(t)
+	if err := m.AppendMessage("c", Message{ID: "q", Role: "user", Content: "question"}); err != nil {
+		t.Fatalf("AppendMessage: %v", err)
+	}
+
+	updated, err := m.UpdateMessage("c", "q", func(message *Message) error {
+		message.ID, message.Role, message.Pinned = "other", "assistant", true
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("UpdateMessage: %v", err)
+	}
+	if updated.ID != "q" || updated.Role != "user" || !updated.Pinned {
+		t.Errorf("updated = %+v", updated)
+	}
+
+	history, _ := m.LoadHistory("c")
+	if len(history) != 1 || !history[0].Pinned {
+		t.Errorf("history = %+v", history)
+	}
+}
+
+func TestUnknownConversation(t *testing.T) {
+	m := newTestManager(t)
+
+	if _, err := m.DeleteMessage("missing", "q"); !errors.Is(err, ErrConversationNotFound) {
+		t.Errorf("DeleteMessage: %v, want ErrConversationNotFound", err)
+	}
+	_, err := m.UpdateMessage("missing", "q", func(*Message) error { return nil })
+	if !errors.Is(err, ErrConversationNotFound) {
+		t.Errorf("UpdateMessage: %v, want ErrConversationNotFound", err)
+	}
+	if _, err := os.Stat(m.conversationDir("missing")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("conversation directory created: %v", err)
+	}
+}
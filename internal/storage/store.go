@@ -0,0 +1,30 @@
+package storage
+
+import "time"
+
+// Store persists conversations, their messages, settings, document metadata
+// and transcripts. Manager keeps everything in per-conversation files under
+// DATA_DIR; SQLiteStore keeps the same data in a single database file.
+// Uploaded originals and extracted text always live on the filesystem.
+type Store interface {
+	CheckWritable() error
+	ListConversations() ([]string, error)
+	EnsureConversation(conversationID string) error
+	AppendMessage(conversationID string, message Message) error
+	LoadHistory(conversationID string) ([]Message, error)
+	UpdateMessage(conversationID, messageID string, update func(*Message) error) (Message, error)
+	DeleteMessage(conversationID, messageID string) ([]string, error)
+	LoadSettings(conversationID string) (Settings, error)
+	SaveSettings(conversationID string, settings Settings) error
+	SaveTranscript(conversationID, content string, timestamp time.Time) (string, error)
+	SaveDocument(conversationID, originalName string, data []byte, tags []string) (Document, error)
+	ListDocuments(conversationID string) ([]Document, error)
+	LoadDocumentTexts(conversationID string) ([]string, error)
+	DocumentText(doc Document) (string, error)
+	Close() error
+}
+
+var (
+	_ Store = (*Manager)(nil)
+	_ Store = (*SQLiteStore)(nil)
+)
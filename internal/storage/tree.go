@@ -0,0 +1,150 @@
+package storage
+
+import (
+	"fmt"
+
+	"github.com/google/uuid"
+)
+
+// legacyNamespace seeds the IDs of messages stored before messages had IDs.
+var legacyNamespace = uuid.MustParse("6f1c2a8e-3d4b-4e59-9a7c-2b8d0f5e1c34")
+
+// backfillIDs gives messages stored before messages had IDs an ID derived
+// from their conversation and position, so it is the same on every load, and
+// chains each to the message before it as the flat history implied. It
+// returns how many messages it changed. The IDs only stay stable while no
+// message before them is removed, so stores persist them before deleting.
+func backfillIDs(conversationID string, history []Message) int {
+	previous, changed := "", 0
+	for i := range history {
+		if history[i].ID == "" {
+			history[i].ID = uuid.NewSHA1(legacyNamespace, []byte(fmt.Sprintf("%s/%d", conversationID, i))).String()
+			history[i].ParentID = previous
+			changed++
+		}
+		previous = history[i].ID
+	}
+	return changed
+}
+
+// Tree indexes a conversation history by message ID. History is stored in
+// the order messages were added; an edit or a regeneration adds a sibling of
+// the message it replaces rather than overwriting it, so every earlier
+// version stays reachable.
+type Tree struct {
+	messages []Message
+	index    map[string]int
+	children map[string][]int
+}
+
+// NewTree indexes history. Messages whose parent is unknown are treated as
+// roots.
+func NewTree(history []Message) *Tree {
+	t := &Tree{
+		messages: history,
+		index:    make(map[string]int, len(history)),
+		children: make(map[string][]int),
+	}
+	for i, message := range history {
+		t.index[message.ID] = i
+	}
+	for i, message := range history {
+		parent := message.ParentID
+		if _, ok := t.index[parent]; !ok {
+			parent = ""
+		}
+		t.children[parent] = append(t.children[parent], i)
+	}
+	return t
+}
+
+// Message returns the message with the given ID.
+func (t *Tree) Message(id string) (Message, bool) {
+	i, ok := t.index[id]
+	if !ok {
+		return Message{}, false
+	}
+	return t.messages[i], true
+}
+
+// Latest returns the ID of the most recently added message at or below id,
+// which ends the branch through id that was used last. An empty id stands for
+// the whole conversation. Latest returns "" for an empty history.
+func (t *Tree) Latest(id string) string {
+	for i := len(t.messages) - 1; i >= 0; i-- {
+		if id == "" || t.descends(i, id) {
+			return t.messages[i].ID
+		}
+	}
+	return ""
+}
+
+// descends reports whether the message at position i is id or one of its
+// descendants.
+func (t *Tree) descends(i int, id string) bool {
+	for steps := 0; steps <= len(t.messages); steps++ {
+		message := t.messages[i]
+		if message.ID == id {
+			return true
+		}
+		parent, ok := t.index[message.ParentID]
+		if !ok {
+			return false
+		}
+		i = parent
+	}
+	return false
+}
+
+// Branch returns the messages from the root down to leaf, or nil when leaf is
+// unknown.
+func (t *Tree) Branch(leaf string) []Message {
+	i, ok := t.index[leaf]
+	if !ok {
+		return nil
+	}
+	var branch []Message
+	for steps := 0; steps <= len(t.messages); steps++ {
+		branch = append(branch, t.messages[i])
+		if i, ok = t.index[t.messages[i].ParentID]; !ok {
+			break
+		}
+	}
+	for l, r := 0, len(branch)-1; l < r; l, r = l+1, r-1 {
+		branch[l], branch[r] = branch[r], branch[l]
+	}
+	return branch
+}
+
+// Siblings returns the IDs of the messages that share id's parent, id
+// included, in the order they were added.
+func (t *Tree) Siblings(id string) []string {
+	i, ok := t.index[id]
+	if !ok {
+		return nil
+	}
+	parent := t.messages[i].ParentID
+	if _, ok := t.index[parent]; !ok {
+		parent = ""
+	}
+	ids := make([]string, 0, len(t.children[parent]))
+	for _, child := range t.children[parent] {
+		ids = append(ids, t.messages[child].ID)
+	}
+	return ids
+}
+
+// Descendants returns id and the IDs of every message below it, or nil when
+// id is unknown.
+func (t *Tree) Descendants(id string) []string {
+	if _, ok := t.index[id]; !ok {
+		return nil
+	}
+	ids := []string{id}
+	for next := 0; next < len(ids) && len(ids) <= len(t.messages); next++ {
+		for _, child := range t.children[ids[next]] {
+			ids = append(ids, t.messages[child].ID)
+		}
+	}
+	return ids
+}
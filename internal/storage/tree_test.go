@@ -0,0 +1,118 @@
+package storage
+
+import (
+	"fmt"
+	"testing"
+)
+
+// testTree builds:
+//
+//	q1 ─ a1
+//	   └ a2 ─ q2 ─ a3
+//	q1e ─ a4
+func testTree() *Tree {
+	return NewTree([]Message{
+		{ID: "q1", Role: "user"},
+		{ID: "a1", ParentID: "q1", Role: "assistant"},
+		{ID: "a2", ParentID: "q1", Role: "assistant"},
+		{ID: "q2", ParentID: "a2", Role: "user"},
+		{ID: "a3", ParentID: "q2", Role: "assistant"},
+		{ID: "q1e", Role: "user"},
+		{ID: "a4", ParentID: "q1e", Role: "assistant"},
+	})
+}
+
+func ids(messages []Message) []string {
+	ids := make([]string, len(messages))
+	for i, message := range messages {
+		ids[i] = message.ID
+	}
+	return ids
+}
+
+func TestTreeLatest(t *testing.T) {
+	tree := testTree()
+	for id, want := range map[string]string{
+		"":        "a4",
+		"q1":      "a3",
+		"a1":      "a1",
+		"a2":      "a3",
+		"q1e":     "a4",
+		"unknown": "",
+	} {
+		if got := tree.Latest(id); got != want {
+			t.Errorf("Latest(%q) = %q, want %q", id, got, want)
+		}
+	}
+	if got := NewTree(nil).Latest(""); got != "" {
+		t.Errorf("Latest on empty history = %q", got)
+	}
+}
+
+func TestTreeBranch(t *testing.T) {
+	tree := testTree()
+	if got := fmt.Sprint(ids(tree.Branch("a3"))); got != "[q1 a2 q2 a3]" {
+		t.Errorf("Branch(a3) = %s", got)
+	}
+	if got := fmt.Sprint(ids(tree.Branch("q1"))); got != "[q1]" {
+		t.Errorf("Branch(q1) = %s", got)
+	}
+	if got := tree.Branch("unknown"); got != nil {
+		t.Errorf("Branch(unknown) = %v, want nil", got)
+	}
+}
+
+func TestTreeSiblings(t *testing.T) {
+	tree := testTree()
+	for id, want := range map[string]string{
+		"a1":  "[a1 a2]",
+		"a2":  "[a1 a2]",
+		"q1":  "[q1 q1e]",
+		"q2":  "[q2]",
+		"q1e": "[q1 q1e]",
+	} {
+		if got := fmt.Sprint(tree.Siblings(id)); got != want {
+			t.Errorf("Siblings(%q) = %s, want %s", id, got, want)
+		}
+	}
+}
+
+func TestTreeDescendants(t *testing.T) {
+	tree := testTree()
+	if got := fmt.Sprint(tree.Descendants("q1")); got != "[q1 a1 a2 q2 a3]" {
+		t.Errorf("Descendants(q1) = %s", got)
+	}
+	if got := tree.Descendants("unknown"); got != nil {
+		t.Errorf("Descendants(unknown) = %v, want nil", got)
+	}
+}
+
+func TestTreeOrphanIsRoot(t *testing.T) {
+	tree := NewTree([]Message{
+		{ID: "q1"},
+		{ID: "a1", ParentID: "deleted"},
+	})
+	if got := fmt.Sprint(tree.Siblings("a1")); got != "[q1 a1]" {
+		t.Errorf("Siblings(a1) = %s, want [q1 a1]", got)
+	}
+	if got := fmt.Sprint(ids(tree.Branch("a1"))); got != "[a1]" {
+		t.Errorf("Branch(a1) = %s, want [a1]", got)
+	}
+}
+
+func TestBackfillIDsIsStable(t *testing.T) {
+	legacy := func() []Message {
+		return []Message{{Content: "q"}, {Content: "a"}, {ID: "kept", Content: "q2"}, {Content: "a2"}}
+	}
+	first, second := legacy(), legacy()
+	if changed := backfillIDs("c", first); changed != 3 {
+		t.Errorf("backfillIDs changed %d messages, want 3", changed)
+	}
+	backfillIDs("c", second)
+	if fmt.Sprint(ids(first)) != fmt.Sprint(ids(second)) {
+		t.Errorf("IDs differ between loads: %v and %v", ids(first), ids(second))
+	}
+	if first[1].ParentID != first[0].ID || first[3].ParentID != "kept" || first[0].ParentID != "" {
+		t.Errorf("legacy messages not chained: %+v", first)
+	}
+}
@@ -0,0 +1,515 @@
+package vectorstore
+
+import (
+	"context"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// FileStore is a pure-Go VectorStore that keeps one gob file per conversation
+// under its root directory and answers queries by brute-force cosine
+// similarity. It needs no external services, which suits offline laptops
+// where conversations hold at most a few thousand chunks.
+type FileStore struct {
+	root string
+
+	mu     sync.Mutex
+	cache  map[string]*fileCollection
+	models []EmbeddingModel
+}
+
+type fileCollection struct {
+	Chunks []fileChunk
+}
+
+type fileChunk struct {
+	ID         uuid.UUID
+	Model      string
+	DocumentID string
+	ChunkIndex int
+	Content    string
+	Metadata   []byte    // JSON, decoded on demand
+	Embedding  []float32 // nil for sections
+	Norm       float32
+	ParentID   uuid.UUID
+	CreatedAt  time.Time
+}
+
+// isSection reports whether c is a section of a two-level chunking.
+func (c fileChunk) isSection() bool {
+	return c.Embedding == nil
+}
+
+// decodeMetadata returns the chunk's metadata.
+func (c fileChunk) decodeMetadata() (Metadata, error) {
+	metadata := Metadata{}
+	if len(c.Metadata) > 0 {
+		if err := json.Unmarshal(c.Metadata, &metadata); err != nil {
+			return nil, fmt.Errorf("decode chunk metadata: %w", err)
+		}
+	}
+	return metadata, nil
+}
+
+// NewFileStore prepares a FileStore rooted at dir.
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create vector directory: %w", err)
+	}
+	store := &FileStore{
+		root:  dir,
+		cache: make(map[string]*fileCollection),
+	}
+	if err := store.loadModels(); err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+// Close releases cached collections.
+func (s *FileStore) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cache = make(map[string]*fileCollection)
+}
+
+// Ping verifies the store directory is still accessible.
+func (s *FileStore) Ping(ctx context.Context) error {
+	info, err := os.Stat(s.root)
+	if err != nil {
+		return fmt.Errorf("stat vector directory: %w", err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("vector path %q is not a directory", s.root)
+	}
+	return nil
+}
+
+// UpsertDocumentChunks replaces the embeddings a model holds for a document.
+func (s *FileStore) UpsertDocumentChunks(ctx context.Context, model, conversationID, documentID string, chunking Chunking, vectors [][]float32) error {
+	if err := chunking.validate(vectors); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	dimension, err := s.modelDimension(model)
+	if err != nil {
+		return err
+	}
+	for _, vec := range vectors {
+		if len(vec) != dimension {
+			return fmt.Errorf("vector dimension mismatch: expected %d got %d", dimension, len(vec))
+		}
+	}
+
+	collection, err := s.load(conversationID)
+	if err != nil {
+		return err
+	}
+
+	kept := collection.Chunks[:0:0]
+	for _, chunk := range collection.Chunks {
+		if chunk.Model != model || chunk.DocumentID != documentID {
+			kept = append(kept, chunk)
+		}
+	}
+
+	now := time.Now().UTC()
+	sectionIDs := make([]uuid.UUID, len(chunking.Sections))
+	for idx, section := range chunking.Sections {
+		_, attributes, err := section.Metadata.normalize()
+		if err != nil {
+			return err
+		}
+		sectionIDs[idx] = uuid.New()
+		kept = append(kept, fileChunk{
+			ID:         sectionIDs[idx],
+			Model:      model,
+			DocumentID: documentID,
+			ChunkIndex: idx,
+			Content:    section.Content,
+			Metadata:   attributes,
+			CreatedAt:  now,
+		})
+	}
+
+	for idx, content := range chunking.Contents {
+		var attributes []byte
+		if chunking.Metadata != nil {
+			if _, attributes, err = chunking.Metadata[idx].normalize(); err != nil {
+				return err
+			}
+		}
+		chunk := fileChunk{
+			ID:         uuid.New(),
+			Model:      model,
+			DocumentID: documentID,
+			ChunkIndex: idx,
+			Content:    content,
+			Metadata:   attributes,
+			Embedding:  vectors[idx],
+			Norm:       norm(vectors[idx]),
+			CreatedAt:  now,
+		}
+		if len(sectionIDs) > 0 {
+			chunk.ParentID = sectionIDs[chunking.Parents[idx]]
+		}
+		kept = append(kept, chunk)
+	}
+
+	updated := &fileCollection{Chunks: kept}
+	if err := s.save(conversationID, updated); err != nil {
+		return err
+	}
+	s.cache[conversationID] = updated
+	return nil
+}
+
+// QuerySimilar returns the most relevant chunks of a model for the provided
+// embedding, restricted to chunks whose metadata matches filter.
+func (s *FileStore) QuerySimilar(ctx context.Context, model, conversationID string, embedding []float32, limit int, filter Filter) ([]Chunk, error) {
+	if err := filter.Validate(); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	dimension, err := s.modelDimension(model)
+	if err != nil {
+		s.mu.Unlock()
+		return nil, err
+	}
+	collection, err := s.load(conversationID)
+	s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	if len(embedding) != dimension {
+		return nil, fmt.Errorf("embedding dimension mismatch: expected %d got %d", dimension, len(embedding))
+	}
+
+	queryNorm := norm(embedding)
+	chunks := make([]Chunk, 0, len(collection.Chunks))
+	for _, chunk := range collection.Chunks {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if chunk.Model != model || chunk.isSection() {
+			continue
+		}
+		metadata, err := chunk.decodeMetadata()
+		if err != nil {
+			return nil, err
+		}
+		if !filter.Match(metadata) {
+			continue
+		}
+		chunks = append(chunks, Chunk{
+			ID:             chunk.ID,
+			DocumentID:     chunk.DocumentID,
+			ConversationID: conversationID,
+			ChunkIndex:     chunk.ChunkIndex,
+			Content:        chunk.Content,
+			Metadata:       metadata,
+			Score:          cosine(embedding, queryNorm, chunk.Embedding, chunk.Norm),
+			ParentID:       chunk.ParentID,
+		})
+	}
+
+	sort.SliceStable(chunks, func(i, j int) bool { return chunks[i].Score > chunks[j].Score })
+	if limit >= 0 && len(chunks) > limit {
+		chunks = chunks[:limit]
+	}
+	return chunks, nil
+}
+
+// ChunkRange returns a model's chunks of a document whose index lies in
+// [first, last], ordered by index.
+func (s *FileStore) ChunkRange(ctx context.Context, model, conversationID, documentID string, first, last int) ([]Chunk, error) {
+	s.mu.Lock()
+	collection, err := s.load(conversationID)
+	s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	var chunks []Chunk
+	for _, chunk := range collection.Chunks {
+		if chunk.Model != model || chunk.DocumentID != documentID || chunk.isSection() || chunk.ChunkIndex < first || chunk.ChunkIndex > last {
+			continue
+		}
+		metadata, err := chunk.decodeMetadata()
+		if err != nil {
+			return nil, err
+		}
+		chunks = append(chunks, Chunk{
+			ID:             chunk.ID,
+			DocumentID:     documentID,
+			ConversationID: conversationID,
+			ChunkIndex:     chunk.ChunkIndex,
+			Content:        chunk.Content,
+			Metadata:       metadata,
+			ParentID:       chunk.ParentID,
+		})
+	}
+	sort.Slice(chunks, func(i, j int) bool { return chunks[i].ChunkIndex < chunks[j].ChunkIndex })
+	return chunks, nil
+}
+
+// Sections returns the sections of a model with the given IDs, in no
+// particular order. Unknown IDs are skipped.
+func (s *FileStore) Sections(ctx context.Context, model, conversationID string, ids []uuid.UUID) ([]Chunk, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	s.mu.Lock()
+	collection, err := s.load(conversationID)
+	s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	wanted := make(map[uuid.UUID]bool, len(ids))
+	for _, id := range ids {
+		wanted[id] = true
+	}
+
+	var sections []Chunk
+	for _, chunk := range collection.Chunks {
+		if chunk.Model != model || !chunk.isSection() || !wanted[chunk.ID] {
+			continue
+		}
+		metadata, err := chunk.decodeMetadata()
+		if err != nil {
+			return nil, err
+		}
+		sections = append(sections, Chunk{
+			ID:             chunk.ID,
+			DocumentID:     chunk.DocumentID,
+			ConversationID: conversationID,
+			ChunkIndex:     chunk.ChunkIndex,
+			Content:        chunk.Content,
+			Metadata:       metadata,
+		})
+	}
+	return sections, nil
+}
+
+// CountDocumentChunks returns how many chunks a model holds for a document.
+func (s *FileStore) CountDocumentChunks(ctx context.Context, model, conversationID, documentID string) (int, error) {
+	s.mu.Lock()
+	collection, err := s.load(conversationID)
+	s.mu.Unlock()
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, chunk := range collection.Chunks {
+		if chunk.Model == model && chunk.DocumentID == documentID && !chunk.isSection() {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// ListDocumentChunks returns chunk counts per document and model.
+func (s *FileStore) ListDocumentChunks(ctx context.Context) ([]DocumentChunks, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	conversations, err := s.conversations()
+	if err != nil {
+		return nil, err
+	}
+
+	var documents []DocumentChunks
+	for _, conversationID := range conversations {
+		collection, err := s.load(conversationID)
+		if err != nil {
+			return nil, err
+		}
+		index := make(map[[2]string]int)
+		for _, chunk := range collection.Chunks {
+			if chunk.isSection() {
+				continue
+			}
+			key := [2]string{chunk.DocumentID, chunk.Model}
+			i, ok := index[key]
+			if !ok {
+				i = len(documents)
+				index[key] = i
+				documents = append(documents, DocumentChunks{ConversationID: conversationID, DocumentID: chunk.DocumentID, Model: chunk.Model})
+			}
+			documents[i].Chunks++
+		}
+	}
+	return documents, nil
+}
+
+// DeleteDocumentChunks removes the embeddings of every model for a document.
+func (s *FileStore) DeleteDocumentChunks(ctx context.Context, conversationID, documentID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	collection, err := s.load(conversationID)
+	if err != nil {
+		return err
+	}
+	kept := collection.Chunks[:0:0]
+	for _, chunk := range collection.Chunks {
+		if chunk.DocumentID != documentID {
+			kept = append(kept, chunk)
+		}
+	}
+	if len(kept) == len(collection.Chunks) {
+		return nil
+	}
+
+	updated := &fileCollection{Chunks: kept}
+	if err := s.save(conversationID, updated); err != nil {
+		return err
+	}
+	s.cache[conversationID] = updated
+	return nil
+}
+
+// DeleteConversation removes all embeddings for the given conversation.
+func (s *FileStore) DeleteConversation(ctx context.Context, conversationID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.cache, conversationID)
+	if err := os.Remove(s.path(conversationID)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("remove vector file: %w", err)
+	}
+	return nil
+}
+
+// load returns the cached collection, reading it from disk on first use.
+// Callers must hold s.mu. Collections are replaced, never mutated, so the
+// returned value may be read after the lock is released.
+func (s *FileStore) load(conversationID string) (*fileCollection, error) {
+	if collection, ok := s.cache[conversationID]; ok {
+		return collection, nil
+	}
+
+	collection := &fileCollection{}
+	file, err := os.Open(s.path(conversationID))
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return nil, fmt.Errorf("open vector file: %w", err)
+	default:
+		defer file.Close()
+		if err := gob.NewDecoder(file).Decode(collection); err != nil {
+			return nil, fmt.Errorf("decode vector file: %w", err)
+		}
+	}
+
+	s.cache[conversationID] = collection
+	return collection, nil
+}
+
+// save writes the collection to a temporary file and renames it into place so
+// readers never observe a partially written file.
+func (s *FileStore) save(conversationID string, collection *fileCollection) error {
+	tmp, err := os.CreateTemp(s.root, conversationID+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("create vector file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := gob.NewEncoder(tmp).Encode(collection); err != nil {
+		tmp.Close()
+		return fmt.Errorf("encode vector file: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("sync vector file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("close vector file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), s.path(conversationID)); err != nil {
+		return fmt.Errorf("replace vector file: %w", err)
+	}
+	return nil
+}
+
+// rewriteAll applies fn to every conversation file, saving those it changes.
+// Callers must hold s.mu.
+func (s *FileStore) rewriteAll(fn func([]fileChunk) ([]fileChunk, bool)) error {
+	conversations, err := s.conversations()
+	if err != nil {
+		return err
+	}
+	for _, conversationID := range conversations {
+		collection, err := s.load(conversationID)
+		if err != nil {
+			return err
+		}
+		chunks, changed := fn(collection.Chunks)
+		if !changed {
+			continue
+		}
+		updated := &fileCollection{Chunks: chunks}
+		if err := s.save(conversationID, updated); err != nil {
+			return err
+		}
+		s.cache[conversationID] = updated
+	}
+	return nil
+}
+
+// conversations lists the conversations that have a vector file.
+func (s *FileStore) conversations() ([]string, error) {
+	entries, err := os.ReadDir(s.root)
+	if err != nil {
+		return nil, fmt.Errorf("read vector directory: %w", err)
+	}
+	var conversations []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || filepath.Ext(name) != ".gob" {
+			continue
+		}
+		conversations = append(conversations, strings.TrimSuffix(name, ".gob"))
+	}
+	return conversations, nil
+}
+
+func (s *FileStore) path(conversationID string) string {
+	return filepath.Join(s.root, conversationID+".gob")
+}
+
+func norm(vec []float32) float32 {
+	var sum float64
+	for _, v := range vec {
+		sum += float64(v) * float64(v)
+	}
+	return float32(math.Sqrt(sum))
+}
+
+func cosine(a []float32, aNorm float32, b []float32, bNorm float32) float32 {
+	if aNorm == 0 || bNorm == 0 {
+		return 0
+	}
+	var dot float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+	}
+	return float32(dot / (float64(aNorm) * float64(bNorm)))
+}
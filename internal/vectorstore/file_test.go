@@ -0,0 +1,152 @@
+package vectorstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func newTestFileStore(t *testing.T, dir string, models ...string) *FileStore {
+	t.Helper()
+	store, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatalf("NewFileStore: %v", err)
+	}
+	for i, model := range models {
+		state := ModelBuilding
+		if i == 0 {
+			state = ModelActive
+		}
+		if err := store.RegisterModel(context.Background(), model, 2, state); err != nil {
+			t.Fatalf("RegisterModel: %v", err)
+		}
+	}
+	return store
+}
+
+func upsert(t *testing.T, store *FileStore, model, conversationID, documentID string, contents []string, vectors [][]float32, metadata ...Metadata) {
+	t.Helper()
+	chunking := Chunking{Contents: contents}
+	if len(metadata) > 0 {
+		chunking.Metadata = metadata
+	}
+	if err := store.UpsertDocumentChunks(context.Background(), model, conversationID, documentID, chunking, vectors); err != nil {
+		t.Fatalf("UpsertDocumentChunks: %v", err)
+	}
+}
+
+func contents(chunks []Chunk) string {
+	var out []string
+	for _, chunk := range chunks {
+		out = append(out, chunk.Content)
+	}
+	return fmt.Sprint(out)
+}
+
+func TestFileStoreQuerySimilar(t *testing.T) {
+	ctx := context.Background()
+	store := newTestFileStore(t, t.TempDir(), "m")
+	upsert(t, store, "m", "c", "d1", []string{"east", "north", "northeast"},
+		[][]float32{{1, 0}, {0, 1}, {1, 1}},
+		Metadata{"page": 1}, Metadata{"page": 2}, Metadata{"page": 3})
+	upsert(t, store, "m", "other", "d2", []string{"elsewhere"}, [][]float32{{1, 0}})
+
+	chunks, err := store.QuerySimilar(ctx, "m", "c", []float32{1, 0}, 2, nil)
+	if err != nil {
+		t.Fatalf("QuerySimilar: %v", err)
+	}
+	if got := contents(chunks); got != "[east northeast]" {
+		t.Errorf("closest chunks = %s, want [east northeast]", got)
+	}
+	if chunks[0].Score < 0.99 || chunks[1].Score > 0.71 {
+		t.Errorf("scores = %v, %v; want cosine similarities 1 and 0.707", chunks[0].Score, chunks[1].Score)
+	}
+
+	chunks, err = store.QuerySimilar(ctx, "m", "c", []float32{1, 0}, 10, Filter{{Field: "page", Min: "2"}})
+	if err != nil {
+		t.Fatalf("QuerySimilar with filter: %v", err)
+	}
+	if got := contents(chunks); got != "[northeast north]" {
+		t.Errorf("filtered chunks = %s, want [northeast north]", got)
+	}
+
+	if _, err := store.QuerySimilar(ctx, "m", "c", []float32{1, 0, 0}, 1, nil); err == nil {
+		t.Error("QuerySimilar accepted an embedding of the wrong dimension")
+	}
+	if _, err := store.QuerySimilar(ctx, "unknown", "c", []float32{1, 0}, 1, nil); !errors.Is(err, ErrUnknownModel) {
+		t.Errorf("QuerySimilar on an unknown model: %v, want ErrUnknownModel", err)
+	}
+}
+
+func TestFileStoreUpsertReplacesAndPersists(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	store := newTestFileStore(t, dir, "m")
+	upsert(t, store, "m", "c", "d", []string{"old", "older"}, [][]float32{{1, 0}, {1, 0}})
+	upsert(t, store, "m", "c", "d", []string{"new"}, [][]float32{{0, 1}})
+
+	reopened := newTestFileStore(t, dir)
+	chunks, err := reopened.ChunkRange(ctx, "m", "c", "d", 0, 10)
+	if err != nil {
+		t.Fatalf("ChunkRange: %v", err)
+	}
+	if got := contents(chunks); got != "[new]" {
+		t.Errorf("chunks after reopening = %s, want [new]", got)
+	}
+	if count, _ := reopened.CountDocumentChunks(ctx, "m", "c", "d"); count != 1 {
+		t.Errorf("CountDocumentChunks = %d, want 1", count)
+	}
+
+	if err := reopened.DeleteDocumentChunks(ctx, "c", "d"); err != nil {
+		t.Fatalf("DeleteDocumentChunks: %v", err)
+	}
+	if listed, _ := reopened.ListDocumentChunks(ctx); len(listed) != 0 {
+		t.Errorf("ListDocumentChunks after delete = %+v", listed)
+	}
+}
+
+func TestFileStoreModelSwitch(t *testing.T) {
+	ctx := context.Background()
+	store := newTestFileStore(t, t.TempDir(), "old", "new")
+	upsert(t, store, "old", "c", "d", []string{"old"}, [][]float32{{1, 0}})
+	upsert(t, store, "new", "c", "d", []string{"new"}, [][]float32{{1, 0}})
+
+	chunks, _ := store.QuerySimilar(ctx, "old", "c", []float32{1, 0}, 10, nil)
+	if got := contents(chunks); got != "[old]" {
+		t.Errorf("old model chunks = %s, want [old]", got)
+	}
+
+	if err := store.ActivateModel(ctx, "new"); err != nil {
+		t.Fatalf("ActivateModel: %v", err)
+	}
+	models, _ := store.Models(ctx)
+	if active, _ := ActiveModel(models); active.Name != "new" {
+		t.Errorf("active model = %q, want new", active.Name)
+	}
+	listed, _ := store.ListDocumentChunks(ctx)
+	if len(listed) != 1 || listed[0].Model != "new" {
+		t.Errorf("chunks after the switch = %+v, want only the new model's", listed)
+	}
+	if err := store.UpsertDocumentChunks(ctx, "old", "c", "d", Chunking{Contents: []string{"x"}}, [][]float32{{1, 0}}); err == nil {
+		t.Error("UpsertDocumentChunks accepted a retired model")
+	}
+	if err := store.RegisterModel(ctx, "other", 2, ModelActive); err == nil {
+		t.Error("RegisterModel activated a second model")
+	}
+}
+
+func TestFileStoreDeleteConversation(t *testing.T) {
+	ctx := context.Background()
+	store := newTestFileStore(t, t.TempDir(), "m")
+	upsert(t, store, "m", "c", "d", []string{"gone"}, [][]float32{{1, 0}})
+	upsert(t, store, "m", "keep", "d", []string{"kept"}, [][]float32{{1, 0}})
+
+	if err := store.DeleteConversation(ctx, "c"); err != nil {
+		t.Fatalf("DeleteConversation: %v", err)
+	}
+	listed, _ := store.ListDocumentChunks(ctx)
+	if len(listed) != 1 || listed[0].ConversationID != "keep" {
+		t.Errorf("chunks after delete = %+v, want only conversation keep", listed)
+	}
+}
@@ -0,0 +1,333 @@
+package vectorstore
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Metadata holds the JSON attributes stored with a chunk, such as the
+// document name, file type, tags, page and heading.
+type Metadata map[string]any
+
+// Filter restricts a similarity search to chunks whose metadata satisfies
+// every condition. The zero Filter matches everything.
+type Filter []Condition
+
+// Condition matches one metadata field. With Values it matches when the field
+// equals any of them, or for array fields such as tags, contains any of them.
+// With Min and Max it matches a scalar field within an inclusive range; either
+// bound may be empty.
+// Numeric bounds compare numerically and RFC 3339 timestamps chronologically,
+// with a date bound covering its whole day in UTC. Anything else compares as
+// text.
+type Condition struct {
+	Field  string   `json:"field"`
+	Values []string `json:"values,omitempty"`
+	Min    string   `json:"min,omitempty"`
+	Max    string   `json:"max,omitempty"`
+}
+
+var fieldPattern = regexp.MustCompile(`^[a-z_][a-z0-9_]*$`)
+
+// ParseFilter parses a filter expression made of whitespace-separated terms:
+//
+//	tags:runbook                 field equals (or contains) a value
+//	file_type:md,markdown        any of several values
+//	page:10..20                  inclusive range; "10.." and "..20" are open
+//	uploaded_at:2024-01-01..     dates cover whole days
+//	document_name:"Ops Manual.md"
+//
+// Terms are combined with AND. Tag values are lowercased, as tags are when
+// documents are saved.
+func ParseFilter(expression string) (Filter, error) {
+	terms, err := splitTerms(expression)
+	if err != nil {
+		return nil, err
+	}
+
+	var filter Filter
+	for _, term := range terms {
+		field, value, ok := strings.Cut(term, ":")
+		if !ok || value == "" {
+			return nil, fmt.Errorf("filter term %q must look like field:value", term)
+		}
+		field = strings.ToLower(field)
+		if !fieldPattern.MatchString(field) {
+			return nil, fmt.Errorf("invalid filter field %q", field)
+		}
+
+		condition := Condition{Field: field}
+		if lo, hi, isRange := strings.Cut(value, ".."); isRange {
+			if lo == "" && hi == "" {
+				return nil, fmt.Errorf("filter range for %s needs at least one bound", field)
+			}
+			condition.Min, condition.Max = lo, hi
+		} else {
+			for _, v := range strings.Split(value, ",") {
+				if field == "tags" {
+					v = strings.ToLower(v)
+				}
+				if v = strings.TrimSpace(v); v != "" {
+					condition.Values = append(condition.Values, v)
+				}
+			}
+			if len(condition.Values) == 0 {
+				return nil, fmt.Errorf("filter term %q has no values", term)
+			}
+		}
+		filter = append(filter, condition)
+	}
+	return filter, nil
+}
+
+// Validate rejects conditions the stores cannot evaluate.
+func (f Filter) Validate() error {
+	for _, c := range f {
+		if !fieldPattern.MatchString(c.Field) {
+			return fmt.Errorf("invalid filter field %q", c.Field)
+		}
+		if len(c.Values) == 0 && c.Min == "" && c.Max == "" {
+			return fmt.Errorf("filter on %s needs values or a range", c.Field)
+		}
+		if len(c.Values) > 0 && (c.Min != "" || c.Max != "") {
+			return fmt.Errorf("filter on %s mixes values and a range", c.Field)
+		}
+	}
+	return nil
+}
+
+// Match reports whether metadata satisfies every condition.
+func (f Filter) Match(metadata Metadata) bool {
+	for _, c := range f {
+		if !c.match(metadata[c.Field]) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c Condition) match(value any) bool {
+	if items, ok := value.([]any); ok && len(c.Values) > 0 {
+		for _, item := range items {
+			if c.match(item) {
+				return true
+			}
+		}
+		return false
+	}
+
+	text, number, isNumber, ok := scalar(value)
+	if !ok {
+		return false
+	}
+
+	if len(c.Values) > 0 {
+		for _, want := range c.Values {
+			if isNumber {
+				if n, ok := jsonNumber(want); ok && n == number {
+					return true
+				}
+				continue
+			}
+			if want == text {
+				return true
+			}
+		}
+		return false
+	}
+
+	return withinBound(c.Min, text, number, isNumber, 1) && withinBound(c.Max, text, number, isNumber, -1)
+}
+
+// withinBound checks value against bound; sign is 1 for a lower bound and -1
+// for an upper bound.
+func withinBound(bound, text string, number float64, isNumber bool, sign int) bool {
+	if bound == "" {
+		return true
+	}
+	if limit, exclusive, ok := timeBound(bound, sign < 0); ok {
+		t, err := time.Parse(time.RFC3339Nano, text)
+		if isNumber || err != nil {
+			return false
+		}
+		switch {
+		case sign > 0:
+			return !t.Before(limit)
+		case exclusive:
+			return t.Before(limit)
+		}
+		return !t.After(limit)
+	}
+	if n, ok := jsonNumber(bound); ok {
+		if !isNumber {
+			return false
+		}
+		switch {
+		case number > n:
+			return sign > 0
+		case number < n:
+			return sign < 0
+		}
+		return true
+	}
+	if isNumber {
+		return false
+	}
+	return strings.Compare(text, bound)*sign >= 0
+}
+
+func scalar(value any) (text string, number float64, isNumber, ok bool) {
+	switch v := value.(type) {
+	case string:
+		return v, 0, false, true
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), v, true, true
+	case bool:
+		return strconv.FormatBool(v), 0, false, true
+	default:
+		return "", 0, false, false
+	}
+}
+
+// timeBound interprets bound as an instant when it is a date or an RFC 3339
+// timestamp. A date covers its whole day: as a lower bound it stands for the
+// day's start, as an upper bound for the next day's start, which is then
+// exclusive. Comparing instants rather than text keeps timestamps with
+// fractional seconds or other offsets in range.
+func timeBound(bound string, upper bool) (limit time.Time, exclusive, ok bool) {
+	if day, err := time.Parse(time.DateOnly, bound); err == nil {
+		if upper {
+			return day.AddDate(0, 0, 1), true, true
+		}
+		return day, false, true
+	}
+	if t, err := time.Parse(time.RFC3339Nano, bound); err == nil {
+		return t, false, true
+	}
+	return time.Time{}, false, false
+}
+
+func splitTerms(expression string) ([]string, error) {
+	var (
+		terms   []string
+		current strings.Builder
+		quoted  bool
+	)
+	for _, r := range expression {
+		switch {
+		case r == '"':
+			quoted = !quoted
+		case !quoted && (r == ' ' || r == '\t' || r == '\n'):
+			if current.Len() > 0 {
+				terms = append(terms, current.String())
+				current.Reset()
+			}
+		default:
+			current.WriteRune(r)
+		}
+	}
+	if quoted {
+		return nil, errors.New("unterminated quote in filter")
+	}
+	if current.Len() > 0 {
+		terms = append(terms, current.String())
+	}
+	return terms, nil
+}
+
+// normalize round-trips metadata through JSON so stores see the same value
+// types (string, float64, bool, []any) whether it was just built or loaded.
+func (m Metadata) normalize() (Metadata, []byte, error) {
+	if len(m) == 0 {
+		return Metadata{}, []byte("{}"), nil
+	}
+	data, err := json.Marshal(m)
+	if err != nil {
+		return nil, nil, fmt.Errorf("encode chunk metadata: %w", err)
+	}
+	var out Metadata
+	if err := json.Unmarshal(data, &out); err != nil {
+		return nil, nil, fmt.Errorf("decode chunk metadata: %w", err)
+	}
+	return out, data, nil
+}
+
+// sqlCondition renders c as a predicate on the metadata column, appending its
+// parameters to args.
+func (c Condition) sqlCondition(args *[]any) string {
+	param := func(value any) string {
+		*args = append(*args, value)
+		return fmt.Sprintf("$%d", len(*args))
+	}
+	field := param(c.Field)
+
+	if len(c.Values) > 0 {
+		var alternatives []string
+		for _, want := range c.Values {
+			for _, candidate := range jsonCandidates(want) {
+				value := param(candidate)
+				alternatives = append(alternatives,
+					fmt.Sprintf("metadata @> jsonb_build_object(%s::text, %s::jsonb)", field, value),
+					fmt.Sprintf("metadata @> jsonb_build_object(%s::text, jsonb_build_array(%s::jsonb))", field, value),
+				)
+			}
+		}
+		return "(" + strings.Join(alternatives, " OR ") + ")"
+	}
+
+	var bounds []string
+	for _, b := range []struct {
+		value string
+		op    string
+		upper bool
+	}{{c.Min, ">=", false}, {c.Max, "<=", true}} {
+		if b.value == "" {
+			continue
+		}
+		if limit, exclusive, ok := timeBound(b.value, b.upper); ok {
+			op := b.op
+			if exclusive {
+				op = "<"
+			}
+			// The pattern guards the cast, which fails on other text.
+			bounds = append(bounds, fmt.Sprintf("(jsonb_typeof(metadata -> %[1]s::text) = 'string' AND CASE WHEN (metadata ->> %[1]s::text) ~ %[2]s THEN (metadata ->> %[1]s::text)::timestamptz %[3]s %[4]s::timestamptz ELSE false END)",
+				field, param(timestampPattern), op, param(limit.Format(time.RFC3339Nano))))
+			continue
+		}
+		if _, ok := jsonNumber(b.value); ok {
+			bounds = append(bounds, fmt.Sprintf("(jsonb_typeof(metadata -> %[1]s::text) = 'number' AND (metadata -> %[1]s::text)::numeric %[2]s %[3]s::numeric)", field, b.op, param(b.value)))
+			continue
+		}
+		// Byte order, as Match compares text.
+		bounds = append(bounds, fmt.Sprintf("(jsonb_typeof(metadata -> %[1]s::text) = 'string' AND (metadata ->> %[1]s::text) COLLATE \"C\" %[2]s %[3]s::text)", field, b.op, param(b.value)))
+	}
+	return "(" + strings.Join(bounds, " AND ") + ")"
+}
+
+// timestampPattern matches the RFC 3339 timestamps Postgres can cast to
+// timestamptz the way time.Parse reads them.
+const timestampPattern = `^\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}(\.\d+)?(Z|[+-]\d{2}:\d{2})$`
+
+// jsonCandidates returns the JSON encodings a filter value may be stored as.
+func jsonCandidates(value string) []string {
+	encoded, _ := json.Marshal(value)
+	candidates := []string{string(encoded)}
+	if _, ok := jsonNumber(value); ok || value == "true" || value == "false" {
+		candidates = append(candidates, value)
+	}
+	return candidates
+}
+
+// jsonNumber parses value if it is a valid JSON number.
+func jsonNumber(value string) (float64, bool) {
+	var n float64
+	if err := json.Unmarshal([]byte(value), &n); err != nil {
+		return 0, false
+	}
+	return n, true
+}
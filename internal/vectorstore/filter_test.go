@@ -0,0 +1,157 @@
+package vectorstore
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseFilter(t *testing.T) {
+	tests := []struct {
+		expression string
+		want       Filter
+	}{
+		{"", nil},
+		{"tags:Runbook", Filter{{Field: "tags", Values: []string{"runbook"}}}},
+		{"FILE_TYPE:md,,markdown", Filter{{Field: "file_type", Values: []string{"md", "markdown"}}}},
+		{"page:10..20", Filter{{Field: "page", Min: "10", Max: "20"}}},
+		{"page:..20", Filter{{Field: "page", Max: "20"}}},
+		{"uploaded_at:2024-01-01..", Filter{{Field: "uploaded_at", Min: "2024-01-01"}}},
+		{`document_name:"Ops Manual.md"  tags:ops`, Filter{
+			{Field: "document_name", Values: []string{"Ops Manual.md"}},
+			{Field: "tags", Values: []string{"ops"}},
+		}},
+	}
+	for _, tt := range tests {
+		got, err := ParseFilter(tt.expression)
+		if err != nil {
+			t.Errorf("ParseFilter(%q): %v", tt.expression, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseFilter(%q) = %+v, want %+v", tt.expression, got, tt.want)
+		}
+	}
+}
+
+func TestParseFilterErrors(t *testing.T) {
+	for _, expression := range []string{
+		"tags",
+		"tags:",
+		"page:..",
+		"tags:,",
+		"bad-field:x",
+		"1page:2",
+		`document_name:"Ops Manual.md`,
+	} {
+		if filter, err := ParseFilter(expression); err == nil {
+			t.Errorf("ParseFilter(%q) = %+v, want an error", expression, filter)
+		}
+	}
+}
+
+func TestFilterValidate(t *testing.T) {
+	for _, filter := range []Filter{
+		{{Field: "Bad Field", Values: []string{"x"}}},
+		{{Field: "page"}},
+		{{Field: "page", Values: []string{"1"}, Min: "1"}},
+	} {
+		if err := filter.Validate(); err == nil {
+			t.Errorf("Validate(%+v) succeeded", filter)
+		}
+	}
+	if err := (Filter{{Field: "page", Min: "1"}}).Validate(); err != nil {
+		t.Errorf("Validate of a range: %v", err)
+	}
+}
+
+func TestFilterMatchValues(t *testing.T) {
+	metadata := Metadata{
+		"tags":      []any{"ops", "runbook"},
+		"file_type": "md",
+		"page":      float64(12),
+		"draft":     true,
+	}
+	tests := []struct {
+		expression string
+		want       bool
+	}{
+		{"", true},
+		{"tags:runbook", true},
+		{"tags:RUNBOOK", true},
+		{"tags:billing", false},
+		{"file_type:txt,md", true},
+		{"page:12", true},
+		{"page:12.0", true},
+		{"page:13", false},
+		{"draft:true", true},
+		{"missing:x", false},
+		{"tags:ops file_type:txt", false},
+	}
+	for _, tt := range tests {
+		filter, err := ParseFilter(tt.expression)
+		if err != nil {
+			t.Fatalf("ParseFilter(%q): %v", tt.expression, err)
+		}
+		if got := filter.Match(metadata); got != tt.want {
+			t.Errorf("%q matches = %v, want %v", tt.expression, got, tt.want)
+		}
+	}
+}
+
+func TestFilterMatchRanges(t *testing.T) {
+	tests := []struct {
+		expression string
+		value      any
+		want       bool
+	}{
+		{"page:10..20", float64(10), true},
+		{"page:10..20", float64(20), true},
+		{"page:10..20", float64(9), false},
+		{"page:10..", float64(1e6), true},
+		{"page:..20", float64(21), false},
+		{"page:9..10", "10", false},
+		{"page:9..10", []any{float64(10)}, false},
+		{"name:b..c", "bravo", true},
+		{"name:b..c", "delta", false},
+
+		{"uploaded_at:2024-01-01..2024-01-31", "2024-01-01T00:00:00Z", true},
+		{"uploaded_at:2024-01-01..2024-01-31", "2023-12-31T23:59:59.999Z", false},
+		{"uploaded_at:2024-01-01..2024-01-31", "2024-01-31T23:59:59Z", true},
+		{"uploaded_at:2024-01-01..2024-01-31", "2024-01-31T23:59:59.5Z", true},
+		{"uploaded_at:2024-01-01..2024-01-31", "2024-02-01T00:00:00Z", false},
+		{"uploaded_at:2024-01-01..2024-01-31", "2024-02-01T00:00:00.5Z", false},
+		{"uploaded_at:2024-01-01..2024-01-31", "2024-02-01T00:30:00+01:00", true},
+		{"uploaded_at:2024-01-01..2024-01-31", "2024-01-31", false},
+		{"uploaded_at:2024-01-01..2024-01-31", float64(20240115), false},
+		{"uploaded_at:..2024-01-31T12:00:00Z", "2024-01-31T12:00:00Z", true},
+		{"uploaded_at:..2024-01-31T12:00:00Z", "2024-01-31T12:00:00.001Z", false},
+		{"uploaded_at:2024-01-31T12:00:00.5Z..", "2024-01-31T12:00:00Z", false},
+	}
+	for _, tt := range tests {
+		filter, err := ParseFilter(tt.expression)
+		if err != nil {
+			t.Fatalf("ParseFilter(%q): %v", tt.expression, err)
+		}
+		if got := filter.Match(Metadata{strings.SplitN(tt.expression, ":", 2)[0]: tt.value}); got != tt.want {
+			t.Errorf("%q matches %v = %v, want %v", tt.expression, tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestSQLConditionDateBounds(t *testing.T) {
+	filter, err := ParseFilter("uploaded_at:2024-01-01..2024-01-31")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var args []any
+	sql := filter[0].sqlCondition(&args)
+
+	if !strings.Contains(sql, "::timestamptz >= $3::timestamptz") || !strings.Contains(sql, "::timestamptz < $5::timestamptz") {
+		t.Errorf("sql = %s, want an inclusive lower and an exclusive upper timestamp bound", sql)
+	}
+	want := []any{"uploaded_at", timestampPattern, "2024-01-01T00:00:00Z", timestampPattern, "2024-02-01T00:00:00Z"}
+	if !reflect.DeepEqual(args, want) {
+		t.Errorf("args = %v, want %v", args, want)
+	}
+}
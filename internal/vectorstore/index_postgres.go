@@ -0,0 +1,266 @@
+package vectorstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Supported approximate nearest neighbour index methods.
+const (
+	IndexHNSW    = "hnsw"
+	IndexIVFFlat = "ivfflat"
+)
+
+// IndexOptions configures the per-model pgvector indexes. M and
+// EFConstruction shape HNSW graphs, EFSearch and Probes trade recall for
+// speed on every query.
+type IndexOptions struct {
+	Type           string
+	M              int
+	EFConstruction int
+	EFSearch       int
+	Probes         int
+}
+
+// DefaultIndexOptions matches pgvector's own defaults.
+var DefaultIndexOptions = IndexOptions{
+	Type:           IndexHNSW,
+	M:              16,
+	EFConstruction: 64,
+	EFSearch:       40,
+	Probes:         10,
+}
+
+// IndexInfo describes a model's vector index after a build.
+type IndexInfo struct {
+	Model    string        `json:"model"`
+	Name     string        `json:"name"`
+	Type     string        `json:"type"`
+	Rows     int64         `json:"rows"`
+	Lists    int           `json:"lists,omitempty"`
+	Built    bool          `json:"built"`
+	Duration time.Duration `json:"duration_ns"`
+}
+
+// IndexRebuilder is implemented by stores whose index quality depends on the
+// data present when it was built, so it should be rebuilt after bulk loads.
+type IndexRebuilder interface {
+	RebuildIndex(ctx context.Context, model string) (IndexInfo, error)
+}
+
+var _ IndexRebuilder = (*Store)(nil)
+
+type queryExecer interface {
+	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// RebuildIndex drops and rebuilds the vector index of model from the rows
+// currently stored. Writes to document_chunks block while it runs.
+func (s *Store) RebuildIndex(ctx context.Context, model string) (IndexInfo, error) {
+	dimension, err := s.modelDimension(ctx, model)
+	if err != nil {
+		return IndexInfo{}, err
+	}
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return IndexInfo{}, fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	info, err := s.buildModelIndex(ctx, tx, model, dimension)
+	if err != nil {
+		return IndexInfo{}, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return IndexInfo{}, fmt.Errorf("commit transaction: %w", err)
+	}
+	return info, nil
+}
+
+// ensureIndexes builds missing indexes, and rebuilds those of another method
+// or other HNSW parameters, for every model that is not retired.
+func (s *Store) ensureIndexes(ctx context.Context) error {
+	models, err := s.Models(ctx)
+	if err != nil {
+		return err
+	}
+	for _, model := range models {
+		if model.State == ModelRetired {
+			continue
+		}
+		if _, err := s.ensureModelIndex(ctx, s.pool, model.Name, model.Dimension); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ensureModelIndex builds the index of model unless one using the configured
+// method and build parameters already exists.
+func (s *Store) ensureModelIndex(ctx context.Context, q queryExecer, model string, dimension int) (IndexInfo, error) {
+	var definition string
+	err := q.QueryRow(ctx, `SELECT indexdef FROM pg_indexes WHERE indexname = $1`, modelIndexName(model)).Scan(&definition)
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+	case err != nil:
+		return IndexInfo{}, fmt.Errorf("inspect vector index: %w", err)
+	case s.indexMatches(definition):
+		return IndexInfo{Model: model, Name: modelIndexName(model), Type: s.index.Type, Built: true}, nil
+	}
+	return s.buildModelIndex(ctx, q, model, dimension)
+}
+
+var indexParameter = regexp.MustCompile(`(\w+)\s*=\s*'?(\d+)'?`)
+
+// indexMatches reports whether an index definition, as pg_indexes prints it,
+// uses the configured method and, for HNSW, the configured m and
+// ef_construction. IVF list counts follow the row count and are refreshed by
+// RebuildIndex, so they are not compared.
+func (s *Store) indexMatches(definition string) bool {
+	if !strings.Contains(definition, "USING "+s.index.Type+" ") {
+		return false
+	}
+	if s.index.Type != IndexHNSW {
+		return true
+	}
+
+	parameters := map[string]string{}
+	if start := strings.Index(definition, " WITH ("); start >= 0 {
+		options := definition[start:]
+		if end := strings.Index(options, ")"); end >= 0 {
+			options = options[:end]
+		}
+		for _, match := range indexParameter.FindAllStringSubmatch(options, -1) {
+			parameters[match[1]] = match[2]
+		}
+	}
+	return parameters["m"] == strconv.Itoa(s.index.M) &&
+		parameters["ef_construction"] == strconv.Itoa(s.index.EFConstruction)
+}
+
+func (s *Store) buildModelIndex(ctx context.Context, q queryExecer, model string, dimension int) (IndexInfo, error) {
+	started := time.Now()
+	name := pgx.Identifier{modelIndexName(model)}.Sanitize()
+	info := IndexInfo{Model: model, Name: modelIndexName(model), Type: s.index.Type}
+
+	if err := q.QueryRow(ctx, `SELECT COUNT(*) FROM document_chunks WHERE embedding_model = $1 AND embedding IS NOT NULL`, model).Scan(&info.Rows); err != nil {
+		return IndexInfo{}, fmt.Errorf("count chunks: %w", err)
+	}
+
+	if _, err := q.Exec(ctx, fmt.Sprintf(`DROP INDEX IF EXISTS %s`, name)); err != nil {
+		return IndexInfo{}, fmt.Errorf("drop vector index: %w", err)
+	}
+
+	var with string
+	switch s.index.Type {
+	case IndexIVFFlat:
+		// Centroids computed from an empty table are meaningless; queries
+		// scan sequentially until a rebuild after the first load.
+		if info.Rows == 0 {
+			info.Duration = time.Since(started)
+			return info, nil
+		}
+		info.Lists = ivfLists(info.Rows)
+		with = fmt.Sprintf("lists = %d", info.Lists)
+	default:
+		with = fmt.Sprintf("m = %d, ef_construction = %d", s.index.M, s.index.EFConstruction)
+	}
+
+	statement := fmt.Sprintf(
+		`CREATE INDEX %s ON document_chunks USING %s ((embedding::vector(%d)) vector_cosine_ops) WITH (%s) WHERE embedding_model = %s`,
+		name, s.index.Type, dimension, with, quoteLiteral(model),
+	)
+	if _, err := q.Exec(ctx, statement); err != nil {
+		return IndexInfo{}, fmt.Errorf("create vector index for %s: %w", model, err)
+	}
+
+	info.Built = true
+	info.Duration = time.Since(started)
+	return info, nil
+}
+
+// filteredScanFactor widens the candidate list of a filtered search on
+// pgvector releases without iterative scans.
+const filteredScanFactor = 10
+
+// maxEFSearch is the largest hnsw.ef_search pgvector accepts.
+const maxEFSearch = 1000
+
+// setSearchParameters applies the per-query recall settings for the
+// surrounding transaction. The index is scanned before the conversation and
+// metadata predicates are applied, so a selective filter would otherwise be
+// left with a handful of candidates. pgvector 0.8 and later keep scanning
+// until enough rows pass; older releases get a wider, fixed candidate list
+// when filtered is set.
+func (s *Store) setSearchParameters(ctx context.Context, tx pgx.Tx, limit int, filtered bool) error {
+	settings := map[string]string{}
+	switch s.index.Type {
+	case IndexIVFFlat:
+		probes := s.index.Probes
+		if s.iterativeScan {
+			settings["ivfflat.iterative_scan"] = "relaxed_order"
+		} else if filtered {
+			probes *= filteredScanFactor
+		}
+		if probes > 0 {
+			settings["ivfflat.probes"] = strconv.Itoa(probes)
+		}
+	default:
+		// HNSW returns at most ef_search candidates.
+		ef := max(s.index.EFSearch, limit)
+		if s.iterativeScan {
+			settings["hnsw.iterative_scan"] = "strict_order"
+		} else if filtered {
+			ef = min(max(ef, limit*filteredScanFactor), maxEFSearch)
+		}
+		if ef > 0 {
+			settings["hnsw.ef_search"] = strconv.Itoa(ef)
+		}
+	}
+
+	for name, value := range settings {
+		if _, err := tx.Exec(ctx, `SELECT set_config($1, $2, true)`, name, value); err != nil {
+			return fmt.Errorf("set %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// supportsIterativeScan reports whether the installed pgvector, 0.8 or later,
+// has the hnsw.iterative_scan and ivfflat.iterative_scan settings.
+func supportsIterativeScan(ctx context.Context, q queryExecer) (bool, error) {
+	var version string
+	if err := q.QueryRow(ctx, `SELECT extversion FROM pg_extension WHERE extname = 'vector'`).Scan(&version); err != nil {
+		return false, fmt.Errorf("query pgvector version: %w", err)
+	}
+	parts := strings.SplitN(version, ".", 3)
+	if len(parts) < 2 {
+		return false, nil
+	}
+	major, errMajor := strconv.Atoi(parts[0])
+	minor, errMinor := strconv.Atoi(parts[1])
+	if errMajor != nil || errMinor != nil {
+		return false, nil
+	}
+	return major > 0 || minor >= 8, nil
+}
+
+// ivfLists follows pgvector's guidance: rows/1000 up to a million rows and
+// sqrt(rows) beyond.
+func ivfLists(rows int64) int {
+	if rows > 1_000_000 {
+		return int(math.Sqrt(float64(rows)))
+	}
+	return max(1, int(rows/1000))
+}
@@ -0,0 +1,31 @@
+CREATE EXTENSION IF NOT EXISTS vector;
+
+CREATE TABLE IF NOT EXISTS document_chunks (
+	id UUID PRIMARY KEY,
+	conversation_id TEXT NOT NULL,
+	document_id TEXT NOT NULL,
+	chunk_index INT NOT NULL,
+	content TEXT NOT NULL,
+	embedding vector({{.Dimension}}) NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS document_chunks_conversation_idx
+	ON document_chunks (conversation_id);
+
+CREATE INDEX IF NOT EXISTS document_chunks_document_idx
+	ON document_chunks (document_id);
+
+-- Create the IVF index if it is missing. This is idempotent because we guard it.
+DO $$
+BEGIN
+	IF NOT EXISTS (
+		SELECT 1
+		FROM pg_indexes
+		WHERE schemaname = current_schema()
+			AND indexname = 'document_chunks_embedding_idx'
+	) THEN
+		EXECUTE 'CREATE INDEX document_chunks_embedding_idx ON document_chunks USING ivfflat (embedding vector_cosine_ops) WITH (lists = 100);';
+	END IF;
+END
+$$;
@@ -0,0 +1,25 @@
+-- Only chunks of the active model can be kept once the dimension is fixed again.
+DELETE FROM document_chunks
+WHERE embedding_model <> COALESCE((SELECT name FROM embedding_models WHERE state = 'active'), embedding_model);
+
+DROP TABLE embedding_models;
+DROP INDEX IF EXISTS document_chunks_model_conversation_idx;
+
+DO $$
+DECLARE
+	idx RECORD;
+BEGIN
+	FOR idx IN
+		SELECT indexname FROM pg_indexes
+		WHERE schemaname = current_schema() AND indexname LIKE 'document_chunks_embedding_%'
+	LOOP
+		EXECUTE format('DROP INDEX %I', idx.indexname);
+	END LOOP;
+END
+$$;
+
+ALTER TABLE document_chunks DROP COLUMN embedding_model;
+ALTER TABLE document_chunks ALTER COLUMN embedding TYPE vector({{.Dimension}});
+
+CREATE INDEX document_chunks_embedding_idx
+	ON document_chunks USING ivfflat (embedding vector_cosine_ops) WITH (lists = 100);
@@ -0,0 +1,21 @@
+-- Chunks from different embedding models live side by side, so the embedding
+-- column loses its fixed dimension and each chunk records its model. Indexes
+-- become per-model partial expression indexes managed by the store.
+DROP INDEX IF EXISTS document_chunks_embedding_idx;
+
+ALTER TABLE document_chunks ALTER COLUMN embedding TYPE vector;
+ALTER TABLE document_chunks ADD COLUMN embedding_model TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX document_chunks_model_conversation_idx
+	ON document_chunks (embedding_model, conversation_id);
+
+CREATE TABLE embedding_models (
+	name TEXT PRIMARY KEY,
+	dimension INT NOT NULL CHECK (dimension > 0),
+	state TEXT NOT NULL CHECK (state IN ('active', 'building', 'retired')),
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	activated_at TIMESTAMPTZ
+);
+
+CREATE UNIQUE INDEX embedding_models_single_active_idx
+	ON embedding_models (state) WHERE state = 'active';
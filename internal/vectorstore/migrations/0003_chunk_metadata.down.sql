@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS document_chunks_metadata_idx;
+ALTER TABLE document_chunks DROP COLUMN metadata;
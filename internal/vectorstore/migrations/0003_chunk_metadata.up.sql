@@ -0,0 +1,6 @@
+-- Chunk attributes (document name, file type, tags, page, heading, upload
+-- date) for filtered searches. Existing chunks get them on reindex.
+ALTER TABLE document_chunks ADD COLUMN metadata JSONB NOT NULL DEFAULT '{}';
+
+CREATE INDEX document_chunks_metadata_idx
+	ON document_chunks USING gin (metadata jsonb_path_ops);
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS document_chunks_parent_idx;
+ALTER TABLE document_chunks DROP COLUMN parent_id;
+DELETE FROM document_chunks WHERE embedding IS NULL;
+ALTER TABLE document_chunks ALTER COLUMN embedding SET NOT NULL;
@@ -0,0 +1,9 @@
+-- Two-level chunking for small-to-big retrieval. Section rows hold a larger
+-- stretch of a document without an embedding; the embedded chunks inside a
+-- section point at it.
+ALTER TABLE document_chunks ALTER COLUMN embedding DROP NOT NULL;
+ALTER TABLE document_chunks
+	ADD COLUMN parent_id UUID REFERENCES document_chunks (id) ON DELETE CASCADE;
+
+CREATE INDEX document_chunks_parent_idx
+	ON document_chunks (parent_id) WHERE parent_id IS NOT NULL;
@@ -0,0 +1,37 @@
+package vectorstore
+
+import (
+	"errors"
+	"time"
+)
+
+// Embedding model states. Exactly one model is active and serves queries; a
+// building model receives new uploads while the re-embed job backfills it.
+const (
+	ModelActive   = "active"
+	ModelBuilding = "building"
+	ModelRetired  = "retired"
+)
+
+// ErrUnknownModel is returned for operations on a model that is not
+// registered or has been retired.
+var ErrUnknownModel = errors.New("unknown embedding model")
+
+// EmbeddingModel describes a model whose chunks the store holds.
+type EmbeddingModel struct {
+	Name        string    `json:"name"`
+	Dimension   int       `json:"dimension"`
+	State       string    `json:"state"`
+	CreatedAt   time.Time `json:"created_at"`
+	ActivatedAt time.Time `json:"activated_at,omitzero"`
+}
+
+// ActiveModel returns the active entry of models, if any.
+func ActiveModel(models []EmbeddingModel) (EmbeddingModel, bool) {
+	for _, model := range models {
+		if model.State == ModelActive {
+			return model, true
+		}
+	}
+	return EmbeddingModel{}, false
+}
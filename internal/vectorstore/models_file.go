@@ -0,0 +1,199 @@
+package vectorstore
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const fileModelsName = "models.json"
+
+// Models lists the registered embedding models.
+func (s *FileStore) Models(ctx context.Context) ([]EmbeddingModel, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]EmbeddingModel(nil), s.models...), nil
+}
+
+// RegisterModel records a model in the given state. Re-registering a model
+// with a different dimension discards its existing chunks.
+func (s *FileStore) RegisterModel(ctx context.Context, name string, dimension int, state string) error {
+	if name == "" || dimension <= 0 {
+		return errors.New("embedding model needs a name and a positive dimension")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	models := append([]EmbeddingModel(nil), s.models...)
+	now := time.Now().UTC()
+	idx := -1
+	for i, model := range models {
+		if model.Name == name {
+			idx = i
+			break
+		}
+	}
+	if idx < 0 {
+		models = append(models, EmbeddingModel{Name: name, CreatedAt: now})
+		idx = len(models) - 1
+	} else if models[idx].Dimension != dimension {
+		if err := s.dropModelChunks(name); err != nil {
+			return err
+		}
+	}
+
+	if state == ModelActive {
+		for i := range models {
+			if i != idx && models[i].State == ModelActive {
+				return fmt.Errorf("model %s is already active", models[i].Name)
+			}
+		}
+		models[idx].ActivatedAt = now
+	}
+	models[idx].Dimension = dimension
+	models[idx].State = state
+
+	return s.saveModels(models)
+}
+
+// ActivateModel makes name the active model, retiring the previous one and
+// dropping its chunks.
+func (s *FileStore) ActivateModel(ctx context.Context, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	models := append([]EmbeddingModel(nil), s.models...)
+	found := false
+	var retired []string
+	for i := range models {
+		switch {
+		case models[i].Name == name:
+			models[i].State = ModelActive
+			models[i].ActivatedAt = time.Now().UTC()
+			found = true
+		case models[i].State != ModelRetired:
+			models[i].State = ModelRetired
+			retired = append(retired, models[i].Name)
+		}
+	}
+	if !found {
+		return fmt.Errorf("%w: %s", ErrUnknownModel, name)
+	}
+
+	// Switch the registry first so queries never see a model without chunks.
+	if err := s.saveModels(models); err != nil {
+		return err
+	}
+	for _, old := range retired {
+		if err := s.dropModelChunks(old); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AdoptUntaggedChunks assigns chunks written before models were tracked to
+// model, dropping those whose dimension differs.
+func (s *FileStore) AdoptUntaggedChunks(ctx context.Context, model string, dimension int) (adopted, dropped int64, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err = s.rewriteAll(func(chunks []fileChunk) ([]fileChunk, bool) {
+		changed := false
+		kept := chunks[:0:0]
+		for _, chunk := range chunks {
+			if chunk.Model != "" {
+				kept = append(kept, chunk)
+				continue
+			}
+			changed = true
+			if len(chunk.Embedding) != dimension {
+				dropped++
+				continue
+			}
+			chunk.Model = model
+			kept = append(kept, chunk)
+			adopted++
+		}
+		return kept, changed
+	})
+	return adopted, dropped, err
+}
+
+// modelDimension returns the dimension of a registered, non-retired model.
+// Callers must hold s.mu.
+func (s *FileStore) modelDimension(name string) (int, error) {
+	for _, model := range s.models {
+		if model.Name == name && model.State != ModelRetired {
+			return model.Dimension, nil
+		}
+	}
+	return 0, fmt.Errorf("%w: %s", ErrUnknownModel, name)
+}
+
+// dropModelChunks removes every chunk produced by model. Callers must hold
+// s.mu.
+func (s *FileStore) dropModelChunks(model string) error {
+	return s.rewriteAll(func(chunks []fileChunk) ([]fileChunk, bool) {
+		kept := chunks[:0:0]
+		for _, chunk := range chunks {
+			if chunk.Model != model {
+				kept = append(kept, chunk)
+			}
+		}
+		return kept, len(kept) != len(chunks)
+	})
+}
+
+func (s *FileStore) loadModels() error {
+	data, err := os.ReadFile(filepath.Join(s.root, fileModelsName))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("read model registry: %w", err)
+	}
+	if err := json.Unmarshal(data, &s.models); err != nil {
+		return fmt.Errorf("decode model registry: %w", err)
+	}
+	return nil
+}
+
+// saveModels persists models and installs them as the current registry.
+// Callers must hold s.mu.
+func (s *FileStore) saveModels(models []EmbeddingModel) error {
+	data, err := json.MarshalIndent(models, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode model registry: %w", err)
+	}
+
+	path := filepath.Join(s.root, fileModelsName)
+	tmp, err := os.CreateTemp(s.root, fileModelsName+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("create model registry: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write model registry: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("sync model registry: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("close model registry: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("replace model registry: %w", err)
+	}
+
+	s.models = models
+	return nil
+}
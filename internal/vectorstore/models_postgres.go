@@ -0,0 +1,202 @@
+package vectorstore
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Models lists the registered embedding models.
+func (s *Store) Models(ctx context.Context) ([]EmbeddingModel, error) {
+	rows, err := s.pool.Query(ctx, `SELECT name, dimension, state, created_at, activated_at FROM embedding_models ORDER BY created_at`)
+	if err != nil {
+		return nil, fmt.Errorf("query embedding models: %w", err)
+	}
+	defer rows.Close()
+
+	var models []EmbeddingModel
+	for rows.Next() {
+		var (
+			model       EmbeddingModel
+			activatedAt *time.Time
+		)
+		if err := rows.Scan(&model.Name, &model.Dimension, &model.State, &model.CreatedAt, &activatedAt); err != nil {
+			return nil, fmt.Errorf("scan embedding model: %w", err)
+		}
+		if activatedAt != nil {
+			model.ActivatedAt = *activatedAt
+		}
+		models = append(models, model)
+	}
+	return models, rows.Err()
+}
+
+// RegisterModel records a model in the given state and creates its vector
+// index. Re-registering a model with a different dimension discards its
+// existing chunks.
+func (s *Store) RegisterModel(ctx context.Context, name string, dimension int, state string) error {
+	if name == "" || dimension <= 0 {
+		return errors.New("embedding model needs a name and a positive dimension")
+	}
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var existing int
+	err = tx.QueryRow(ctx, `SELECT dimension FROM embedding_models WHERE name = $1`, name).Scan(&existing)
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+	case err != nil:
+		return fmt.Errorf("query embedding model: %w", err)
+	case existing != dimension:
+		if _, err := tx.Exec(ctx, `DELETE FROM document_chunks WHERE embedding_model = $1`, name); err != nil {
+			return fmt.Errorf("delete stale chunks: %w", err)
+		}
+		if _, err := tx.Exec(ctx, fmt.Sprintf(`DROP INDEX IF EXISTS %s`, pgx.Identifier{modelIndexName(name)}.Sanitize())); err != nil {
+			return fmt.Errorf("drop stale index: %w", err)
+		}
+	}
+
+	if _, err := tx.Exec(ctx, `
+INSERT INTO embedding_models (name, dimension, state, activated_at)
+VALUES ($1, $2, $3, CASE WHEN $3 = 'active' THEN NOW() END)
+ON CONFLICT (name) DO UPDATE SET
+	dimension = excluded.dimension,
+	state = excluded.state,
+	activated_at = COALESCE(excluded.activated_at, embedding_models.activated_at)`,
+		name, dimension, state); err != nil {
+		return fmt.Errorf("register embedding model: %w", err)
+	}
+
+	if _, err := s.ensureModelIndex(ctx, tx, name, dimension); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("commit transaction: %w", err)
+	}
+
+	s.mu.Lock()
+	s.dimensions[name] = dimension
+	s.mu.Unlock()
+	return nil
+}
+
+// ActivateModel makes name the active model. The previously active model is
+// retired and its chunks and index are dropped in the same transaction, so
+// queries switch atomically from the old index to the new one.
+func (s *Store) ActivateModel(ctx context.Context, name string) error {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx, `SELECT name FROM embedding_models WHERE state <> 'retired' AND name <> $1`, name)
+	if err != nil {
+		return fmt.Errorf("query embedding models: %w", err)
+	}
+	retiring, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return fmt.Errorf("scan embedding models: %w", err)
+	}
+
+	for _, old := range retiring {
+		if _, err := tx.Exec(ctx, `UPDATE embedding_models SET state = 'retired' WHERE name = $1`, old); err != nil {
+			return fmt.Errorf("retire model %s: %w", old, err)
+		}
+		if _, err := tx.Exec(ctx, `DELETE FROM document_chunks WHERE embedding_model = $1`, old); err != nil {
+			return fmt.Errorf("delete chunks of %s: %w", old, err)
+		}
+		if _, err := tx.Exec(ctx, fmt.Sprintf(`DROP INDEX IF EXISTS %s`, pgx.Identifier{modelIndexName(old)}.Sanitize())); err != nil {
+			return fmt.Errorf("drop index of %s: %w", old, err)
+		}
+	}
+
+	tag, err := tx.Exec(ctx, `UPDATE embedding_models SET state = 'active', activated_at = NOW() WHERE name = $1`, name)
+	if err != nil {
+		return fmt.Errorf("activate model %s: %w", name, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%w: %s", ErrUnknownModel, name)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("commit transaction: %w", err)
+	}
+
+	// IVF centroids are chosen when the index is built, so build them from
+	// the freshly backfilled rows rather than the empty table of registration.
+	if s.index.Type == IndexIVFFlat {
+		if _, err := s.RebuildIndex(ctx, name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AdoptUntaggedChunks assigns chunks written before models were tracked to
+// model. Untagged chunks whose dimension differs cannot belong to it and are
+// removed; their documents are re-embedded by the caller.
+func (s *Store) AdoptUntaggedChunks(ctx context.Context, model string, dimension int) (adopted, dropped int64, err error) {
+	tag, err := s.pool.Exec(ctx, `UPDATE document_chunks SET embedding_model = $1 WHERE embedding_model = '' AND vector_dims(embedding) = $2`, model, dimension)
+	if err != nil {
+		return 0, 0, fmt.Errorf("adopt untagged chunks: %w", err)
+	}
+	adopted = tag.RowsAffected()
+
+	tag, err = s.pool.Exec(ctx, `DELETE FROM document_chunks WHERE embedding_model = ''`)
+	if err != nil {
+		return adopted, 0, fmt.Errorf("drop untagged chunks: %w", err)
+	}
+	return adopted, tag.RowsAffected(), nil
+}
+
+func (s *Store) modelDimension(ctx context.Context, model string) (int, error) {
+	s.mu.RLock()
+	dimension, ok := s.dimensions[model]
+	s.mu.RUnlock()
+	if ok {
+		return dimension, nil
+	}
+
+	err := s.pool.QueryRow(ctx, `SELECT dimension FROM embedding_models WHERE name = $1 AND state <> 'retired'`, model).Scan(&dimension)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, fmt.Errorf("%w: %s", ErrUnknownModel, model)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("query embedding model: %w", err)
+	}
+
+	s.mu.Lock()
+	s.dimensions[model] = dimension
+	s.mu.Unlock()
+	return dimension, nil
+}
+
+var nonIdentifier = regexp.MustCompile(`[^a-z0-9]+`)
+
+// modelIndexName derives a stable, valid index name for a model. A short hash
+// keeps names unique after sanitising and within Postgres' 63-byte limit.
+func modelIndexName(model string) string {
+	slug := strings.Trim(nonIdentifier.ReplaceAllString(strings.ToLower(model), "_"), "_")
+	if len(slug) > 32 {
+		slug = slug[:32]
+	}
+	sum := sha256.Sum256([]byte(model))
+	return fmt.Sprintf("document_chunks_embedding_%s_%s", slug, hex.EncodeToString(sum[:4]))
+}
+
+func quoteLiteral(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+}
@@ -2,14 +2,16 @@ package vectorstore
 
 import (
 	"context"
-	"errors"
 	"fmt"
-	"strings"
+	"sort"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/pgvector/pgvector-go"
+	pgxvec "github.com/pgvector/pgvector-go/pgx"
 )
 
 // Chunk represents a retrieved document snippet along with metadata.
@@ -17,18 +19,108 @@ type Chunk struct {
 	ID             uuid.UUID
 	DocumentID     string
 	ConversationID string
+	ChunkIndex     int
 	Content        string
+	Metadata       Metadata
 	Score          float32
+	// ParentID is the enclosing section of a two-level chunking, or
+	// uuid.Nil.
+	ParentID uuid.UUID
 }
 
 // Store persists and retrieves embeddings from Postgres + pgvector.
 type Store struct {
-	pool      *pgxpool.Pool
-	dimension int
+	pool  *pgxpool.Pool
+	index IndexOptions
+	// iterativeScan is set when pgvector can keep scanning an index until
+	// enough rows pass a query's filters.
+	iterativeScan bool
+
+	mu         sync.RWMutex
+	dimensions map[string]int
 }
 
-// NewPostgresStore connects to Postgres and ensures the necessary schema exists.
-func NewPostgresStore(ctx context.Context, dsn string, maxConns int, dimension int) (*Store, error) {
+// NewPostgresStore connects to Postgres and applies any pending schema
+// migrations. It refuses to start if the database was migrated by a newer
+// release. dimension only shapes migrations that predate per-model chunks.
+// Vector indexes of registered models are (re)built if index asks for a
+// different method than the one in place.
+func NewPostgresStore(ctx context.Context, dsn string, maxConns int, dimension int, index IndexOptions) (*Store, error) {
+	pool, err := Connect(ctx, dsn, maxConns)
+	if err != nil {
+		return nil, err
+	}
+
+	migrator, err := NewMigrator(pool, dimension)
+	if err != nil {
+		pool.Close()
+		return nil, err
+	}
+	if _, err := migrator.Up(ctx); err != nil {
+		pool.Close()
+		return nil, fmt.Errorf("migrate schema: %w", err)
+	}
+	// Connections opened before the migrations created the vector
+	// extension lack its binary codec, which COPY needs.
+	pool.Reset()
+
+	if index.Type == "" {
+		index = DefaultIndexOptions
+	}
+
+	store := &Store{
+		pool:       pool,
+		index:      index,
+		dimensions: make(map[string]int),
+	}
+	if store.iterativeScan, err = supportsIterativeScan(ctx, pool); err != nil {
+		pool.Close()
+		return nil, err
+	}
+	if err := store.ensureIndexes(ctx); err != nil {
+		pool.Close()
+		return nil, err
+	}
+	return store, nil
+}
+
+// NewReadOnlyPostgresStore connects to Postgres without migrating the schema
+// or rebuilding vector indexes, for commands that only inspect the store. It
+// fails unless the schema is up to date.
+func NewReadOnlyPostgresStore(ctx context.Context, dsn string, maxConns int, dimension int, index IndexOptions) (*Store, error) {
+	pool, err := Connect(ctx, dsn, maxConns)
+	if err != nil {
+		return nil, err
+	}
+
+	migrator, err := NewMigrator(pool, dimension)
+	if err != nil {
+		pool.Close()
+		return nil, err
+	}
+	if err := migrator.RequireLatest(ctx); err != nil {
+		pool.Close()
+		return nil, err
+	}
+
+	if index.Type == "" {
+		index = DefaultIndexOptions
+	}
+
+	store := &Store{
+		pool:       pool,
+		index:      index,
+		dimensions: make(map[string]int),
+	}
+	if store.iterativeScan, err = supportsIterativeScan(ctx, pool); err != nil {
+		pool.Close()
+		return nil, err
+	}
+	return store, nil
+}
+
+// Connect opens a connection pool for dsn.
+func Connect(ctx context.Context, dsn string, maxConns int) (*pgxpool.Pool, error) {
 	cfg, err := pgxpool.ParseConfig(dsn)
 	if err != nil {
 		return nil, fmt.Errorf("parse database URL: %w", err)
@@ -37,23 +129,26 @@ func NewPostgresStore(ctx context.Context, dsn string, maxConns int, dimension i
 	if maxConns > 0 {
 		cfg.MaxConns = int32(maxConns)
 	}
+	cfg.AfterConnect = registerVectorTypes
 
 	pool, err := pgxpool.NewWithConfig(ctx, cfg)
 	if err != nil {
 		return nil, fmt.Errorf("connect database: %w", err)
 	}
+	return pool, nil
+}
 
-	store := &Store{
-		pool:      pool,
-		dimension: dimension,
+// registerVectorTypes teaches conn the pgvector types once the extension
+// exists, so vectors can be sent in binary form.
+func registerVectorTypes(ctx context.Context, conn *pgx.Conn) error {
+	var installed bool
+	if err := conn.QueryRow(ctx, `SELECT to_regtype('vector') IS NOT NULL`).Scan(&installed); err != nil {
+		return fmt.Errorf("check vector extension: %w", err)
 	}
-
-	if err := store.ensureSchema(ctx); err != nil {
-		pool.Close()
-		return nil, err
+	if !installed {
+		return nil
 	}
-
-	return store, nil
+	return pgxvec.RegisterTypes(ctx, conn)
 }
 
 // Close releases the underlying database resources.
@@ -61,54 +156,51 @@ func (s *Store) Close() {
 	s.pool.Close()
 }
 
-func (s *Store) ensureSchema(ctx context.Context) error {
-	const statements = `
-CREATE EXTENSION IF NOT EXISTS vector;
-
-CREATE TABLE IF NOT EXISTS document_chunks (
-	id UUID PRIMARY KEY,
-	conversation_id TEXT NOT NULL,
-	document_id TEXT NOT NULL,
-	chunk_index INT NOT NULL,
-	content TEXT NOT NULL,
-	embedding vector(%[1]d) NOT NULL,
-	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
-);
-
-CREATE INDEX IF NOT EXISTS document_chunks_conversation_idx
-	ON document_chunks (conversation_id);
-
-CREATE INDEX IF NOT EXISTS document_chunks_document_idx
-	ON document_chunks (document_id);
-
--- Create the IVF index if it is missing. This is idempotent because we guard it.
-DO $$
-BEGIN
-	IF NOT EXISTS (
-		SELECT 1
-		FROM pg_indexes
-		WHERE schemaname = current_schema()
-			AND indexname = 'document_chunks_embedding_idx'
-	) THEN
-		EXECUTE 'CREATE INDEX document_chunks_embedding_idx ON document_chunks USING ivfflat (embedding vector_cosine_ops) WITH (lists = 100);';
-	END IF;
-END
-$$;
-`
-
-	_, err := s.pool.Exec(ctx, fmt.Sprintf(statements, s.dimension))
-	if err != nil && strings.Contains(err.Error(), "ivfflat") {
-		// IVF requires an approximate index; if it fails (e.g. insufficient rows),
-		// we ignore and continue.
-		err = nil
-	}
-	return err
+// Ping verifies a connection to the database can be acquired and used.
+func (s *Store) Ping(ctx context.Context) error {
+	return s.pool.Ping(ctx)
 }
 
-// UpsertDocumentChunks replaces the embeddings for a given document.
-func (s *Store) UpsertDocumentChunks(ctx context.Context, conversationID, documentID string, contents []string, vectors [][]float32) error {
-	if len(contents) != len(vectors) {
-		return fmt.Errorf("contents and vectors length mismatch")
+// UpsertDocumentChunks replaces the embeddings a model holds for a document.
+func (s *Store) UpsertDocumentChunks(ctx context.Context, model, conversationID, documentID string, chunking Chunking, vectors [][]float32) error {
+	if err := chunking.validate(vectors); err != nil {
+		return err
+	}
+
+	dimension, err := s.modelDimension(ctx, model)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	rows := make([][]any, 0, len(chunking.Sections)+len(chunking.Contents))
+
+	// Sections go first so the chunks that reference them follow.
+	sectionIDs := make([]uuid.UUID, len(chunking.Sections))
+	for idx, section := range chunking.Sections {
+		_, attributes, err := section.Metadata.normalize()
+		if err != nil {
+			return err
+		}
+		sectionIDs[idx] = uuid.New()
+		rows = append(rows, []any{sectionIDs[idx], conversationID, documentID, idx, section.Content, nil, model, attributes, nil, now})
+	}
+
+	for idx, content := range chunking.Contents {
+		if len(vectors[idx]) != dimension {
+			return fmt.Errorf("vector dimension mismatch: expected %d got %d", dimension, len(vectors[idx]))
+		}
+		attributes := []byte("{}")
+		if chunking.Metadata != nil {
+			if _, attributes, err = chunking.Metadata[idx].normalize(); err != nil {
+				return err
+			}
+		}
+		var parent any
+		if len(sectionIDs) > 0 {
+			parent = sectionIDs[chunking.Parents[idx]]
+		}
+		rows = append(rows, []any{uuid.New(), conversationID, documentID, idx, content, pgvector.NewVector(vectors[idx]), model, attributes, parent, now})
 	}
 
 	tx, err := s.pool.Begin(ctx)
@@ -117,30 +209,14 @@ func (s *Store) UpsertDocumentChunks(ctx context.Context, conversationID, docume
 	}
 	defer tx.Rollback(ctx)
 
-	if _, err := tx.Exec(ctx, `DELETE FROM document_chunks WHERE conversation_id = $1 AND document_id = $2`, conversationID, documentID); err != nil {
+	if _, err := tx.Exec(ctx, `DELETE FROM document_chunks WHERE embedding_model = $1 AND conversation_id = $2 AND document_id = $3`, model, conversationID, documentID); err != nil {
 		return fmt.Errorf("delete existing chunks: %w", err)
 	}
 
-	for idx, content := range contents {
-		if len(vectors[idx]) != s.dimension {
-			return fmt.Errorf("vector dimension mismatch: expected %d got %d", s.dimension, len(vectors[idx]))
-		}
-
-		id := uuid.New()
-		if _, err := tx.Exec(
-			ctx,
-			`INSERT INTO document_chunks (id, conversation_id, document_id, chunk_index, content, embedding, created_at)
-				 VALUES ($1, $2, $3, $4, $5, $6, $7)`,
-			id,
-			conversationID,
-			documentID,
-			idx,
-			content,
-			pgvector.NewVector(vectors[idx]),
-			time.Now().UTC(),
-		); err != nil {
-			return fmt.Errorf("insert chunk: %w", err)
-		}
+	// COPY streams every chunk in one round trip, which matters for books
+	// with thousands of chunks.
+	if _, err := tx.CopyFrom(ctx, pgx.Identifier{"document_chunks"}, chunkColumns, pgx.CopyFromRows(rows)); err != nil {
+		return fmt.Errorf("copy chunks: %w", err)
 	}
 
 	if err := tx.Commit(ctx); err != nil {
@@ -150,18 +226,45 @@ func (s *Store) UpsertDocumentChunks(ctx context.Context, conversationID, docume
 	return nil
 }
 
-// QuerySimilar returns the most relevant chunks for the provided embedding.
-func (s *Store) QuerySimilar(ctx context.Context, conversationID string, embedding []float32, limit int) ([]Chunk, error) {
-	if len(embedding) != s.dimension {
-		return nil, fmt.Errorf("embedding dimension mismatch: expected %d got %d", s.dimension, len(embedding))
+var chunkColumns = []string{"id", "conversation_id", "document_id", "chunk_index", "content", "embedding", "embedding_model", "metadata", "parent_id", "created_at"}
+
+// QuerySimilar returns the most relevant chunks of a model for the provided
+// embedding, restricted to chunks whose metadata matches filter.
+func (s *Store) QuerySimilar(ctx context.Context, model, conversationID string, embedding []float32, limit int, filter Filter) ([]Chunk, error) {
+	if err := filter.Validate(); err != nil {
+		return nil, err
+	}
+	dimension, err := s.modelDimension(ctx, model)
+	if err != nil {
+		return nil, err
+	}
+	if len(embedding) != dimension {
+		return nil, fmt.Errorf("embedding dimension mismatch: expected %d got %d", dimension, len(embedding))
 	}
 
-	rows, err := s.pool.Query(ctx, `
-SELECT id, document_id, content, 1 - (embedding <=> $1) AS score
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if err := s.setSearchParameters(ctx, tx, limit, len(filter) > 0); err != nil {
+		return nil, err
+	}
+
+	args := []any{pgvector.NewVector(embedding), model, conversationID, limit}
+	where := "embedding_model = $2 AND conversation_id = $3 AND embedding IS NOT NULL"
+	for _, condition := range filter {
+		where += " AND " + condition.sqlCondition(&args)
+	}
+
+	// The cast matches the per-model partial expression index.
+	rows, err := tx.Query(ctx, fmt.Sprintf(`
+SELECT id, document_id, chunk_index, content, metadata, parent_id, 1 - (embedding::vector(%[1]d) <=> $1) AS score
 FROM document_chunks
-WHERE conversation_id = $2
-ORDER BY embedding <=> $1
-LIMIT $3`, pgvector.NewVector(embedding), conversationID, limit)
+WHERE %[2]s
+ORDER BY embedding::vector(%[1]d) <=> $1
+LIMIT $4`, dimension, where), args...)
 	if err != nil {
 		return nil, fmt.Errorf("query similar chunks: %w", err)
 	}
@@ -169,11 +272,17 @@ LIMIT $3`, pgvector.NewVector(embedding), conversationID, limit)
 
 	var chunks []Chunk
 	for rows.Next() {
-		var chunk Chunk
+		var (
+			chunk  Chunk
+			parent *uuid.UUID
+		)
 		chunk.ConversationID = conversationID
-		if err := rows.Scan(&chunk.ID, &chunk.DocumentID, &chunk.Content, &chunk.Score); err != nil {
+		if err := rows.Scan(&chunk.ID, &chunk.DocumentID, &chunk.ChunkIndex, &chunk.Content, &chunk.Metadata, &parent, &chunk.Score); err != nil {
 			return nil, fmt.Errorf("scan chunk: %w", err)
 		}
+		if parent != nil {
+			chunk.ParentID = *parent
+		}
 		chunks = append(chunks, chunk)
 	}
 
@@ -181,33 +290,128 @@ LIMIT $3`, pgvector.NewVector(embedding), conversationID, limit)
 		return nil, fmt.Errorf("iterate chunks: %w", err)
 	}
 
+	// IVFFlat's iterative scan may return rows slightly out of order.
+	sort.SliceStable(chunks, func(i, j int) bool { return chunks[i].Score > chunks[j].Score })
 	return chunks, nil
 }
 
-// DeleteConversation removes all embeddings for the given conversation.
-func (s *Store) DeleteConversation(ctx context.Context, conversationID string) error {
-	_, err := s.pool.Exec(ctx, `DELETE FROM document_chunks WHERE conversation_id = $1`, conversationID)
-	return err
-}
+// ChunkRange returns a model's chunks of a document whose index lies in
+// [first, last], ordered by index.
+func (s *Store) ChunkRange(ctx context.Context, model, conversationID, documentID string, first, last int) ([]Chunk, error) {
+	rows, err := s.pool.Query(ctx, `
+SELECT id, chunk_index, content, metadata, parent_id
+FROM document_chunks
+WHERE embedding_model = $1 AND conversation_id = $2 AND document_id = $3 AND embedding IS NOT NULL AND chunk_index BETWEEN $4 AND $5
+ORDER BY chunk_index`, model, conversationID, documentID, first, last)
+	if err != nil {
+		return nil, fmt.Errorf("query chunk range: %w", err)
+	}
+	defer rows.Close()
 
-// RefreshDocument is a helper that reindexes a single document by running the provided function to generate chunks.
-func (s *Store) RefreshDocument(ctx context.Context, conversationID, documentID string, chunkFn func() ([]string, error), embedFn func(context.Context, []string) ([][]float32, error)) error {
-	if chunkFn == nil || embedFn == nil {
-		return errors.New("chunk function and embed function must be provided")
+	var chunks []Chunk
+	for rows.Next() {
+		var parent *uuid.UUID
+		chunk := Chunk{ConversationID: conversationID, DocumentID: documentID}
+		if err := rows.Scan(&chunk.ID, &chunk.ChunkIndex, &chunk.Content, &chunk.Metadata, &parent); err != nil {
+			return nil, fmt.Errorf("scan chunk: %w", err)
+		}
+		if parent != nil {
+			chunk.ParentID = *parent
+		}
+		chunks = append(chunks, chunk)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate chunks: %w", err)
+	}
+	return chunks, nil
+}
 
-	contents, err := chunkFn()
+// Sections returns the sections of a model with the given IDs, in no
+// particular order. Unknown IDs are skipped.
+func (s *Store) Sections(ctx context.Context, model, conversationID string, ids []uuid.UUID) ([]Chunk, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = id.String()
+	}
+	rows, err := s.pool.Query(ctx, `
+SELECT id, document_id, chunk_index, content, metadata
+FROM document_chunks
+WHERE embedding_model = $1 AND conversation_id = $2 AND embedding IS NULL AND id = ANY($3::uuid[])`, model, conversationID, keys)
 	if err != nil {
-		return fmt.Errorf("chunk document: %w", err)
+		return nil, fmt.Errorf("query sections: %w", err)
+	}
+	defer rows.Close()
+
+	var sections []Chunk
+	for rows.Next() {
+		section := Chunk{ConversationID: conversationID}
+		if err := rows.Scan(&section.ID, &section.DocumentID, &section.ChunkIndex, &section.Content, &section.Metadata); err != nil {
+			return nil, fmt.Errorf("scan section: %w", err)
+		}
+		sections = append(sections, section)
 	}
-	if len(contents) == 0 {
-		return s.UpsertDocumentChunks(ctx, conversationID, documentID, []string{}, [][]float32{})
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate sections: %w", err)
 	}
+	return sections, nil
+}
 
-	vectors, err := embedFn(ctx, contents)
+// CountDocumentChunks returns how many chunks a model holds for a document.
+func (s *Store) CountDocumentChunks(ctx context.Context, model, conversationID, documentID string) (int, error) {
+	var count int
+	err := s.pool.QueryRow(ctx,
+		`SELECT COUNT(*) FROM document_chunks WHERE embedding_model = $1 AND conversation_id = $2 AND document_id = $3 AND embedding IS NOT NULL`,
+		model, conversationID, documentID,
+	).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("count chunks: %w", err)
+	}
+	return count, nil
+}
+
+// ListDocumentChunks returns chunk counts per document and model.
+func (s *Store) ListDocumentChunks(ctx context.Context) ([]DocumentChunks, error) {
+	rows, err := s.pool.Query(ctx, `
+SELECT conversation_id, document_id, embedding_model, COUNT(*)
+FROM document_chunks
+WHERE embedding IS NOT NULL
+GROUP BY conversation_id, document_id, embedding_model
+ORDER BY conversation_id, document_id, embedding_model`)
 	if err != nil {
-		return fmt.Errorf("embed document: %w", err)
+		return nil, fmt.Errorf("list document chunks: %w", err)
 	}
+	defer rows.Close()
+
+	var documents []DocumentChunks
+	for rows.Next() {
+		var doc DocumentChunks
+		if err := rows.Scan(&doc.ConversationID, &doc.DocumentID, &doc.Model, &doc.Chunks); err != nil {
+			return nil, fmt.Errorf("scan document chunks: %w", err)
+		}
+		documents = append(documents, doc)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate document chunks: %w", err)
+	}
+	return documents, nil
+}
+
+// DeleteDocumentChunks removes the embeddings of every model for a document.
+func (s *Store) DeleteDocumentChunks(ctx context.Context, conversationID, documentID string) error {
+	_, err := s.pool.Exec(ctx, `DELETE FROM document_chunks WHERE conversation_id = $1 AND document_id = $2`, conversationID, documentID)
+	return err
+}
 
-	return s.UpsertDocumentChunks(ctx, conversationID, documentID, contents, vectors)
+// DeleteConversation removes all embeddings for the given conversation.
+func (s *Store) DeleteConversation(ctx context.Context, conversationID string) error {
+	_, err := s.pool.Exec(ctx, `DELETE FROM document_chunks WHERE conversation_id = $1`, conversationID)
+	return err
+}
+
+// RefreshDocument is a helper that reindexes a single document by running the provided function to generate chunks.
+func (s *Store) RefreshDocument(ctx context.Context, model, conversationID, documentID string, chunkFn func() (Chunking, error), embedFn func(context.Context, []string) ([][]float32, error)) error {
+	return RefreshDocument(ctx, s, model, conversationID, documentID, chunkFn, embedFn)
 }
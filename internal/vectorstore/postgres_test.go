@@ -0,0 +1,67 @@
+package vectorstore
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"os"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// benchmarkDSNEnv names a Postgres database with pgvector that benchmarks may
+// write to. Benchmarks needing it are skipped when it is unset.
+const benchmarkDSNEnv = "VECTORSTORE_BENCH_DSN"
+
+// BenchmarkUpsertDocumentChunks measures replacing a 10k-chunk document, the
+// size of a long book, through COPY.
+func BenchmarkUpsertDocumentChunks(b *testing.B) {
+	dsn := os.Getenv(benchmarkDSNEnv)
+	if dsn == "" {
+		b.Skipf("%s not set", benchmarkDSNEnv)
+	}
+	const (
+		chunks    = 10_000
+		dimension = 768
+	)
+
+	ctx := context.Background()
+	store, err := NewPostgresStore(ctx, dsn, 4, dimension, DefaultIndexOptions)
+	if err != nil {
+		b.Fatalf("open store: %v", err)
+	}
+	defer store.Close()
+
+	model := "bench-" + uuid.NewString()
+	if err := store.RegisterModel(ctx, model, dimension, ModelBuilding); err != nil {
+		b.Fatalf("register model: %v", err)
+	}
+	conversationID := "bench-" + uuid.NewString()
+	b.Cleanup(func() {
+		store.pool.Exec(ctx, `DELETE FROM document_chunks WHERE embedding_model = $1`, model)
+		store.pool.Exec(ctx, fmt.Sprintf(`DROP INDEX IF EXISTS %s`, pgx.Identifier{modelIndexName(model)}.Sanitize()))
+		store.pool.Exec(ctx, `DELETE FROM embedding_models WHERE name = $1`, model)
+	})
+
+	rng := rand.New(rand.NewSource(1))
+	chunking := Chunking{Contents: make([]string, chunks), Metadata: make([]Metadata, chunks)}
+	vectors := make([][]float32, chunks)
+	for i := range vectors {
+		chunking.Contents[i] = fmt.Sprintf("chunk %d of a long book", i)
+		chunking.Metadata[i] = Metadata{"document_name": "book.txt", "tags": []string{"bench"}}
+		vectors[i] = make([]float32, dimension)
+		for j := range vectors[i] {
+			vectors[i][j] = rng.Float32()
+		}
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := store.UpsertDocumentChunks(ctx, model, conversationID, "book", chunking, vectors); err != nil {
+			b.Fatalf("upsert: %v", err)
+		}
+	}
+	b.ReportMetric(float64(b.N*chunks)/b.Elapsed().Seconds(), "chunks/s")
+}
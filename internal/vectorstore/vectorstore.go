@@ -0,0 +1,109 @@
+package vectorstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+)
+
+// VectorStore persists document chunk embeddings and answers similarity
+// queries scoped to a conversation. Every chunk is tagged with the embedding
+// model that produced it, so several models can coexist while documents are
+// re-embedded. Scores are cosine similarities. Sections of a two-level
+// chunking are only reachable through Sections; every other method deals in
+// embedded chunks.
+type VectorStore interface {
+	UpsertDocumentChunks(ctx context.Context, model, conversationID, documentID string, chunking Chunking, vectors [][]float32) error
+	QuerySimilar(ctx context.Context, model, conversationID string, embedding []float32, limit int, filter Filter) ([]Chunk, error)
+	ChunkRange(ctx context.Context, model, conversationID, documentID string, first, last int) ([]Chunk, error)
+	Sections(ctx context.Context, model, conversationID string, ids []uuid.UUID) ([]Chunk, error)
+	CountDocumentChunks(ctx context.Context, model, conversationID, documentID string) (int, error)
+	ListDocumentChunks(ctx context.Context) ([]DocumentChunks, error)
+	DeleteDocumentChunks(ctx context.Context, conversationID, documentID string) error
+	DeleteConversation(ctx context.Context, conversationID string) error
+
+	Models(ctx context.Context) ([]EmbeddingModel, error)
+	RegisterModel(ctx context.Context, name string, dimension int, state string) error
+	ActivateModel(ctx context.Context, name string) error
+	AdoptUntaggedChunks(ctx context.Context, model string, dimension int) (adopted, dropped int64, err error)
+
+	Ping(ctx context.Context) error
+	Close()
+}
+
+// Chunking is a document split for indexing. Contents are embedded and
+// searched. When Sections is set, Parents[i] is the index of the section that
+// encloses chunk i: sections are stored without embeddings and a search can
+// return them in place of the small chunks that matched.
+type Chunking struct {
+	Contents []string
+	Metadata []Metadata
+	Sections []Section
+	Parents  []int
+}
+
+// Section is a parent chunk of a two-level chunking.
+type Section struct {
+	Content  string
+	Metadata Metadata
+}
+
+// validate checks that the slices of c line up with vectors.
+func (c Chunking) validate(vectors [][]float32) error {
+	if len(c.Contents) != len(vectors) {
+		return fmt.Errorf("contents and vectors length mismatch")
+	}
+	if c.Metadata != nil && len(c.Metadata) != len(c.Contents) {
+		return fmt.Errorf("contents and metadata length mismatch")
+	}
+	if len(c.Sections) == 0 {
+		return nil
+	}
+	if len(c.Parents) != len(c.Contents) {
+		return fmt.Errorf("contents and parents length mismatch")
+	}
+	for _, parent := range c.Parents {
+		if parent < 0 || parent >= len(c.Sections) {
+			return fmt.Errorf("parent section %d out of range", parent)
+		}
+	}
+	return nil
+}
+
+// DocumentChunks counts the chunks a model holds for one document.
+type DocumentChunks struct {
+	ConversationID string `json:"conversation_id"`
+	DocumentID     string `json:"document_id"`
+	Model          string `json:"model"`
+	Chunks         int    `json:"chunks"`
+}
+
+var (
+	_ VectorStore = (*Store)(nil)
+	_ VectorStore = (*FileStore)(nil)
+)
+
+// RefreshDocument reindexes a single document in store by running the provided
+// functions to generate chunks, their metadata and their embeddings.
+func RefreshDocument(ctx context.Context, store VectorStore, model, conversationID, documentID string, chunkFn func() (Chunking, error), embedFn func(context.Context, []string) ([][]float32, error)) error {
+	if chunkFn == nil || embedFn == nil {
+		return errors.New("chunk function and embed function must be provided")
+	}
+
+	chunking, err := chunkFn()
+	if err != nil {
+		return fmt.Errorf("chunk document: %w", err)
+	}
+	if len(chunking.Contents) == 0 {
+		return store.UpsertDocumentChunks(ctx, model, conversationID, documentID, Chunking{}, [][]float32{})
+	}
+
+	vectors, err := embedFn(ctx, chunking.Contents)
+	if err != nil {
+		return fmt.Errorf("embed document: %w", err)
+	}
+
+	return store.UpsertDocumentChunks(ctx, model, conversationID, documentID, chunking, vectors)
+}